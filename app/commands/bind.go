@@ -0,0 +1,216 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyBindings are the key bindings of the line editor, keymap
+// is the one of the editing mode when it's empty
+type KeyBindings interface {
+	// Functions returns the names of the editing functions
+	Functions() []string
+	Bindings(keymap string) ([]KeyBinding, error)
+	// Bind reads a line of the inputrc file
+	Bind(keymap, line string) error
+	ReadFile(keymap, path string) error
+	Unbind(keymap, keyseq string) error
+	UnbindFunction(keymap, function string) error
+}
+
+// KeyBinding is a key sequence in the notation of the inputrc
+// file, like \C-a, and the function or the macro it runs
+type KeyBinding struct {
+	Keys     string
+	Function string
+	Macro    string
+}
+
+const bindUsage = "bind: usage: bind [-lpsPS] [-m keymap] [-f filename] [-q name] [-u name] [-r keyseq] [keyseq:readline-function or readline-command]"
+
+// bind [-lpsPS] [-m keymap] [-f filename] [-q name] [-u name] [-r keyseq]
+// [keyseq:readline-function or readline-command]
+func (c *Command) bind() int {
+	kb := c.state.Bindings
+	if kb == nil {
+		fmt.Fprintln(c.Stderr, "bash: bind: warning: line editing not enabled")
+		return 0
+	}
+
+	args := c.Args
+	var keymap, file, query, unbindFunction, unbindKeys string
+	var list, printKeys, printReadable, macros, macrosReadable bool
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i := 1; i < len(arg); i++ {
+			switch arg[i] {
+			case 'l':
+				list = true
+			case 'p':
+				printKeys = true
+			case 'P':
+				printReadable = true
+			case 's':
+				macros = true
+			case 'S':
+				macrosReadable = true
+			case 'm', 'f', 'q', 'u', 'r':
+				value := arg[i+1:]
+				if value == "" {
+					if len(args) == 0 {
+						fmt.Fprintf(c.Stderr, "bash: bind: -%c: option requires an argument\n", arg[i])
+						fmt.Fprintln(c.Stderr, bindUsage)
+						return 2
+					}
+					value, args = args[0], args[1:]
+				}
+				switch arg[i] {
+				case 'm':
+					keymap = value
+				case 'f':
+					file = value
+				case 'q':
+					query = value
+				case 'u':
+					unbindFunction = value
+				case 'r':
+					unbindKeys = value
+				}
+				i = len(arg)
+			default:
+				fmt.Fprintf(c.Stderr, "bash: bind: -%c: invalid option\n", arg[i])
+				fmt.Fprintln(c.Stderr, bindUsage)
+				return 2
+			}
+		}
+	}
+
+	bindings, err := kb.Bindings(keymap)
+	if err != nil {
+		fmt.Fprintf(c.Stderr, "bash: bind: %v\n", err)
+		return 1
+	}
+
+	if list {
+		for _, name := range kb.Functions() {
+			fmt.Fprintln(c.Stdout, name)
+		}
+	}
+	if printKeys || printReadable {
+		c.printBindings(kb.Functions(), bindings, printReadable)
+	}
+	if macros || macrosReadable {
+		for _, b := range bindings {
+			switch {
+			case b.Macro == "":
+			case macrosReadable:
+				fmt.Fprintf(c.Stdout, "%s outputs %s\n", b.Keys, b.Macro)
+			default:
+				fmt.Fprintf(c.Stdout, "\"%s\": \"%s\"\n", b.Keys, b.Macro)
+			}
+		}
+	}
+
+	exitCode := 0
+	if file != "" {
+		if err := kb.ReadFile(keymap, file); err != nil {
+			fmt.Fprintln(c.Stderr, bindError(err))
+			exitCode = 1
+		}
+	}
+	if query != "" {
+		exitCode = max(exitCode, c.queryBinding(kb, bindings, query))
+	}
+	if unbindFunction != "" {
+		if err := kb.UnbindFunction(keymap, unbindFunction); err != nil {
+			fmt.Fprintf(c.Stderr, "bash: bind: %v\n", err)
+			exitCode = 1
+		}
+	}
+	if unbindKeys != "" {
+		if err := kb.Unbind(keymap, unbindKeys); err != nil {
+			fmt.Fprintf(c.Stderr, "bash: bind: %v\n", err)
+			exitCode = 1
+		}
+	}
+
+	for _, line := range args {
+		if err := kb.Bind(keymap, line); err != nil {
+			fmt.Fprintf(c.Stderr, "bash: bind: %v\n", err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// bindError shows the errors of a file read by readline as they are
+func bindError(err error) string {
+	if strings.HasPrefix(err.Error(), "readline: ") {
+		return err.Error()
+	}
+	return "bash: bind: " + err.Error()
+}
+
+// printBindings lists every function with its key sequences, as lines of
+// the inputrc file or in sentences with readable
+func (c *Command) printBindings(functions []string, bindings []KeyBinding, readable bool) {
+	keys := map[string][]string{}
+	for _, b := range bindings {
+		if b.Macro == "" {
+			keys[b.Function] = append(keys[b.Function], b.Keys)
+		}
+	}
+
+	for _, name := range functions {
+		seqs := keys[name]
+		switch {
+		case readable && len(seqs) == 0:
+			fmt.Fprintf(c.Stdout, "%s is not bound to any keys\n", name)
+		case readable:
+			fmt.Fprintf(c.Stdout, "%s can be found on %s.\n", name, quoteKeys(seqs))
+		case len(seqs) == 0:
+			fmt.Fprintf(c.Stdout, "# %s (not bound)\n", name)
+		default:
+			for _, seq := range seqs {
+				fmt.Fprintf(c.Stdout, "\"%s\": %s\n", seq, name)
+			}
+		}
+	}
+}
+
+// queryBinding tells which keys run the function name
+func (c *Command) queryBinding(kb KeyBindings, bindings []KeyBinding, name string) int {
+	known := false
+	for _, function := range kb.Functions() {
+		known = known || function == name
+	}
+	if !known {
+		fmt.Fprintf(c.Stderr, "bash: bind: `%s': unknown function name\n", name)
+		return 1
+	}
+
+	seqs := []string{}
+	for _, b := range bindings {
+		if b.Function == name && b.Macro == "" {
+			seqs = append(seqs, b.Keys)
+		}
+	}
+	if len(seqs) == 0 {
+		fmt.Fprintf(c.Stdout, "%s is not bound to any keys.\n", name)
+		return 1
+	}
+	fmt.Fprintf(c.Stdout, "%s can be invoked via %s.\n", name, quoteKeys(seqs))
+	return 0
+}
+
+func quoteKeys(seqs []string) string {
+	quoted := make([]string, len(seqs))
+	for i, seq := range seqs {
+		quoted[i] = "\"" + seq + "\""
+	}
+	return strings.Join(quoted, ", ")
+}
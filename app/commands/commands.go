@@ -1,12 +1,20 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/codecrafters-io/shell-starter-go/app/shellparser"
 )
 
 type Command struct {
@@ -15,105 +23,414 @@ type Command struct {
 	Stdin  io.Reader
 	Stdout io.Writer
 	Stderr io.Writer
+
+	// environment of programs started by the command
+	Env []string
+	// NAME=value pairs written before the command name
+	Assigns []string
+
+	state *State
+	// job the command is part of and the function
+	// to call once its program started
+	job      *Job
+	launched func()
+	proc     *process
+
+	// every file descriptor of the command, Stdin, Stdout and Stderr
+	// are 0, 1 and 2 of it and the others are passed on to programs
+	fds Fds
+	// files and pipe ends to close once the command is done,
+	// pipes are the ends of the pipes of its pipeline among them
+	owned []io.Closer
+	pipes []io.Closer
+	// its redirections failed, it isn't run and its status is 1
+	failed bool
+	// an if or a loop run instead of a name
+	compound shellparser.Compound
 }
 
-func splitOnPipes(input []string) [][]string {
-	res := [][]string{}
-	cmd := []string{}
+var builtins = []string{
+	"exit", "echo", "type", "pwd", "cd", "export", "unset", "readonly", "env", "set", "shopt",
+	"jobs", "fg", "bg", "wait", "disown", "history", "complete", "compgen",
+	"hash", "rehash", "bind", "exec",
+}
 
-	for _, s := range input {
-		if s == "|" {
-			res = append(res, cmd)
-			cmd = []string{}
-		} else {
-			cmd = append(cmd, s)
+func IsBuiltin(name string) bool {
+	return slices.Contains(builtins, name)
+}
+
+// Builtins returns the names of all builtin commands
+func Builtins() []string {
+	return slices.Clone(builtins)
+}
+
+// ErrAborted is returned when an expansion error like ${NAME?message}
+// or a foreground job killed by Ctrl-C drops the rest of the input,
+// the way an interactive bash does
+var ErrAborted = errors.New("aborted")
+
+// StartCommands runs every and-or list in order, the exit status
+// of each pipeline is recorded in state as it finishes
+func StartCommands(state *State, list *shellparser.List) (bool, int, error) {
+	return startList(state, list)
+}
+
+func startList(state *State, list *shellparser.List) (bool, int, error) {
+	isExit, exitCode := false, state.LastStatus
+	for _, andOr := range list.Items {
+		var err error
+		isExit, exitCode, err = startAndOr(state, andOr)
+		if isExit || err != nil {
+			return isExit, exitCode, err
 		}
 	}
-	if len(cmd) > 0 {
-		res = append(res, cmd)
+	return isExit, exitCode, nil
+}
+
+// startAndOr runs the first pipeline then decides for each following
+// one based on the exit status of the last pipeline that ran
+func startAndOr(state *State, andOr *shellparser.AndOr) (bool, int, error) {
+	if andOr.Background {
+		return false, startBackground(state, andOr), nil
 	}
-	return res
+	return runAndOr(state, andOr)
 }
 
-func StartCommands(input []string) (bool, int) {
-	rawCmds := splitOnPipes(input)
-	count := len(rawCmds)
+func runAndOr(state *State, andOr *shellparser.AndOr) (bool, int, error) {
+	isExit, exitCode, err := startPipeline(state, andOr.Pipelines[0])
+
+	for i, op := range andOr.Ops {
+		if isExit || err != nil {
+			break
+		}
+
+		if (op == shellparser.OpAnd) != (exitCode == 0) {
+			continue
+		}
+
+		isExit, exitCode, err = startPipeline(state, andOr.Pipelines[i+1])
+	}
+
+	return isExit, exitCode, err
+}
+
+func startPipeline(state *State, pipeline *shellparser.Pipeline) (isExit bool, exitCode int, err error) {
+	count := len(pipeline.Commands)
 	if count == 0 {
-		return false, 0
+		return false, state.LastStatus, nil
 	}
 
+	defer func() {
+		if !isExit {
+			state.LastStatus = exitCode
+		}
+	}()
+
 	cmds := make([]*Command, 0, count)
-	for _, cmdFields := range rawCmds {
-		if len(cmdFields) == 0 {
-			continue
+	// the reading end of the pipe from the command before
+	var pipeIn *os.File
+	for i, simpleCmd := range pipeline.Commands {
+		// with several commands each one runs in a subshell
+		// so what it assigns doesn't reach the shell
+		cmdState := state
+		if count > 1 {
+			cmdState = state.stage()
 		}
+		cmd := NewCommand("", nil)
+		cmd.state = cmdState
+		cmds = append(cmds, cmd)
 
-		name := cmdFields[0]
-		args, stdin, stdout, stderr, err := Redirect(cmdFields[1:])
+		// the pipes are connected before the redirections
+		// so 2>&1 sends the errors down the pipe too
+		fds := maps.Clone(state.fds)
+		if pipeIn != nil {
+			fds[0] = pipeIn
+			cmd.owned = append(cmd.owned, pipeIn)
+			cmd.pipes = append(cmd.pipes, pipeIn)
+			pipeIn = nil
+		}
+		if i < count-1 {
+			// a program gets the pipe itself, so what it
+			// doesn't read is left for the next one
+			r, w, err := os.Pipe()
+			if err != nil {
+				fmt.Fprintf(state.stderr(), "bash: pipe error: %s\n", errnoText(err))
+				for _, cmd := range cmds {
+					cmd.closeFiles()
+				}
+				return false, 1, ErrAborted
+			}
+			fds[1] = w
+			cmd.owned = append(cmd.owned, w)
+			cmd.pipes = append(cmd.pipes, w)
+			pipeIn = r
+		}
 
+		fields, assigns, err := expandCommand(cmdState, simpleCmd)
 		if err != nil {
-			return false, 0
+			fmt.Fprintln(state.stderr(), err)
+			for _, cmd := range cmds {
+				cmd.closeFiles()
+			}
+			if pipeIn != nil {
+				pipeIn.Close()
+			}
+			// a pattern without a match only fails its command
+			var noMatch *shellparser.NoMatchError
+			if errors.As(err, &noMatch) {
+				return false, 1, nil
+			}
+			return false, 1, ErrAborted
+		}
+		if cmdState.Options.Flag("xtrace") {
+			traceCommand(cmdState, state.stderr(), fields, assigns)
 		}
 
-		if stdin == nil {
-			stdin = os.Stdin
+		opened, err := Redirect(cmdState, simpleCmd.Redirects, fds)
+		if err != nil {
+			// only this stage fails, its pipe ends are closed
+			// so the stages around it see the end of the pipe
+			fmt.Fprintln(state.stderr(), err)
+			cmd.closeFiles()
+			cmd.failed = true
+			continue
 		}
 
-		if stdout == nil {
-			stdout = os.Stdout
+		if len(fields) > 0 {
+			cmd.Name, cmd.Args = fields[0], fields[1:]
 		}
+		cmd.Assigns = assigns
+		cmd.compound = simpleCmd.Compound
+		cmd.Env = cmdState.Vars.Environ(assigns...)
+		for _, file := range opened {
+			cmd.owned = append(cmd.owned, file)
+		}
+		cmd.setFds(fds)
+	}
 
-		if stderr == nil {
-			stderr = os.Stderr
+	// inside a background job or an if or a loop of a pipeline every
+	// pipeline is part of that job, like a subshell it stops at a
+	// program ended with Ctrl-C
+	if state.job != nil {
+		isExit, exitCode = runStages(state.job, cmds)
+		if !isExit && state.job.interrupted() {
+			return false, exitCode, ErrAborted
 		}
+		return isExit, exitCode, nil
+	}
 
-		cmd := &Command{
-			Name:   name,
-			Args:   args,
-			Stdin:  stdin,
-			Stdout: stdout,
-			Stderr: stderr,
+	// builtins change the shell itself so a lone one runs right here,
+	// so does a lone if or loop with the commands in it
+	if count == 1 && cmds[0].runsInShell() {
+		defer cmds[0].closeFiles()
+		if cmds[0].compound != nil && !cmds[0].failed {
+			return cmds[0].runCompound()
 		}
+		isExit, exitCode = cmds[0].Execute()
+		return isExit, exitCode, nil
+	}
 
-		cmds = append(cmds, cmd)
+	// like a subshell, exit inside a pipeline only ends that command
+	job := state.Jobs.newJob(pipeline.String(), false)
+	go func() {
+		_, exitCode := runStages(job, cmds)
+		state.Jobs.finish(job, exitCode)
+	}()
+	exitCode = state.Jobs.foreground(job, false, state.stderr())
+	if job.signal == syscall.SIGINT {
+		return false, exitCode, ErrAborted
 	}
+	return false, exitCode, nil
+}
 
-	// connect with pipes
-	for i := range count - 1 {
-		r, w := io.Pipe()
-		if cmds[i].Stdout == os.Stdout {
-			cmds[i].Stdout = w
-		}
-		if cmds[i+1].Stdin == os.Stdin {
-			cmds[i+1].Stdin = r
-		}
+// runStages runs every command of a pipeline at the same time
+// as part of job and returns the status of the last one, exit
+// ends the subshell of the job only when it's the whole pipeline
+func runStages(job *Job, cmds []*Command) (bool, int) {
+	codes := make([]int, len(cmds))
+	exits := make([]bool, len(cmds))
+	var wg sync.WaitGroup
+
+	job.table.countLaunching(job, len(cmds))
+	for i, cmd := range cmds {
+		var once sync.Once
+		cmd.job = job
+		cmd.launched = func() { once.Do(func() { job.table.countLaunching(job, -1) }) }
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cmd.closeFiles()
+			defer cmd.launched()
+
+			// builtins have no program to wait for
+			if IsBuiltin(cmd.Name) || cmd.Name == "" {
+				cmd.launched()
+			}
+			exits[i], codes[i] = cmd.Execute()
+		}()
 	}
 
-	closeRecourses := func(cmd *Command) {
-		if closer, ok := cmd.Stdout.(io.Closer); ok && cmd.Stdout != os.Stdout {
-			closer.Close()
-		}
+	job.table.waitLaunched(job)
+	if last := cmds[len(cmds)-1]; last.proc != nil {
+		job.markStarted(last.proc.pid)
+	} else {
+		job.markStarted(0)
+	}
+
+	wg.Wait()
+	return len(cmds) == 1 && exits[0], codes[len(codes)-1]
+}
+
+// startBackground starts the and-or list as a job in a subshell,
+// it's added to the job table and its number and pid printed
+func startBackground(state *State, andOr *shellparser.AndOr) int {
+	jobs := state.Jobs
+	job := jobs.newJob(andOr.String(), true)
 
-		if closer, ok := cmd.Stdin.(io.Closer); ok && cmd.Stdin != os.Stdin {
-			closer.Close()
+	sub := state.subshell()
+	sub.job = job
+	if cwd, err := state.getwd(); err == nil {
+		sub.dir = cwd
+	}
+	go func() {
+		_, exitCode, _ := runAndOr(sub, andOr)
+		jobs.finish(job, exitCode)
+	}()
+	<-job.started
+
+	jobs.mu.Lock()
+	jobs.add(job)
+	jobs.mu.Unlock()
+
+	if job.lastPid != 0 {
+		state.lastBackground = job.lastPid
+	}
+
+	// like bash only an interactive shell tells about new jobs
+	switch {
+	case !jobs.interactive:
+	case job.lastPid != 0:
+		fmt.Fprintf(state.stderr(), "[%d] %d\n", job.ID, job.lastPid)
+	default:
+		fmt.Fprintf(state.stderr(), "[%d]\n", job.ID)
+	}
+	return 0
+}
+
+// setFds connects the command to fds, what it owns that no descriptor
+// refers to anymore is closed right away so the other end of a pipe
+// replaced by a redirection sees it closed, a closed standard descriptor
+// is /dev/null opened the other way round so every use of it fails
+func (c *Command) setFds(fds Fds) {
+	c.owned = slices.DeleteFunc(c.owned, func(closer io.Closer) bool {
+		for _, stream := range fds {
+			if stream == closer {
+				return false
+			}
 		}
+		closer.Close()
+		return true
+	})
+	c.fds = fds
+
+	if in, ok := fds[0].(io.Reader); ok {
+		c.Stdin = in
+	} else {
+		c.Stdin = c.closedFile(os.O_WRONLY)
+	}
+	if out, ok := fds[1].(io.Writer); ok {
+		c.Stdout = out
+	} else {
+		c.Stdout = c.closedFile(os.O_RDONLY)
+	}
+	if errOut, ok := fds[2].(io.Writer); ok {
+		c.Stderr = errOut
+	} else {
+		c.Stderr = c.closedFile(os.O_RDONLY)
+	}
+}
+
+func (c *Command) closedFile(flag int) *os.File {
+	file, _ := os.OpenFile(os.DevNull, flag, 0)
+	c.owned = append(c.owned, file)
+	return file
+}
+
+func (c *Command) closeFiles() {
+	for _, closer := range c.owned {
+		closer.Close()
+	}
+	c.owned = nil
+}
+
+// runsInShell reports if the command has to run in the shell process,
+// env is a builtin only to set the environment of the program it runs
+func (c *Command) runsInShell() bool {
+	return c.Name == "" || (IsBuiltin(c.Name) && c.Name != "env")
+}
 
-		if closer, ok := cmd.Stderr.(io.Closer); ok && cmd.Stderr != os.Stderr {
-			closer.Close()
+// expandCommand expands the words and the assignments of a simple
+// command, fields is empty when it's only made of assignments, each
+// assignment is expanded with the ones before it already made
+func expandCommand(state *State, simpleCmd *shellparser.SimpleCommand) (fields, assigns []string, err error) {
+	state.substituted = false
+
+	fields, err = shellparser.ExpandWords(simpleCmd.Words, state)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pending := &pendingAssigns{State: state, assigns: make([]string, 0, len(simpleCmd.Assigns))}
+	for _, a := range simpleCmd.Assigns {
+		value, err := shellparser.ExpandWord(a.Value, pending)
+		if err != nil {
+			return nil, nil, err
 		}
+		pending.assigns = append(pending.assigns, a.Name+"="+value)
 	}
+	return fields, pending.assigns, nil
+}
 
-	for i := range count - 1 {
-		go func(cmd *Command) {
-			cmd.Execute()
-			closeRecourses(cmd)
+// pendingAssigns expands the assignments of a command, the ones
+// already expanded are seen by those after them before they are
+// made, or only given to the program in front of a command name
+type pendingAssigns struct {
+	*State
+	assigns []string
+}
 
-		}(cmds[i])
+func (p *pendingAssigns) Get(name string) (string, bool) {
+	for _, assign := range slices.Backward(p.assigns) {
+		if assignName, value, _ := strings.Cut(assign, "="); assignName == name {
+			return value, true
+		}
 	}
+	return p.State.Get(name)
+}
 
-	defer closeRecourses(cmds[count-1])
-	return cmds[count-1].Execute()
+func (p *pendingAssigns) Substitute(list *shellparser.List) (string, error) {
+	return p.State.substitute(list, p.assigns)
 }
+
+// traceCommand prints an expanded command after PS4 for set -x,
+// every assignment on its own line like bash
+func traceCommand(state *State, w io.Writer, fields, assigns []string) {
+	ps4 := state.Prompt("PS4")
+	for _, assign := range assigns {
+		name, value, _ := strings.Cut(assign, "=")
+		fmt.Fprintf(w, "%s%s=%s\n", ps4, name, quoteValue(value))
+	}
+	if len(fields) == 0 {
+		return
+	}
+	quoted := make([]string, len(fields))
+	for i, field := range fields {
+		quoted[i] = quoteValue(field)
+	}
+	fmt.Fprintf(w, "%s%s\n", ps4, strings.Join(quoted, " "))
+}
+
 func NewCommand(name string, args []string) *Command {
 
 	return &Command{
@@ -125,62 +442,131 @@ func NewCommand(name string, args []string) *Command {
 	}
 }
 
-// exitCode can be used later to report the exit code of every command
+// exitCode is the exit status of the command, or the
+// code the shell should exit with when isExit is true
 func (c *Command) Execute() (isExit bool, exitCode int) {
+	if c.failed {
+		return false, 1
+	}
+	if c.compound != nil {
+		isExit, exitCode, _ = c.runCompound()
+		return isExit, exitCode
+	}
+
+	// builtins tell when their output can't be written like bash, env
+	// and exec only print errors when they don't pass Stdout on to a program
+	if IsBuiltin(c.Name) && c.Name != "env" && c.Name != "exec" {
+		out := &checkedWriter{w: c.Stdout}
+		c.Stdout = out
+		defer func() {
+			c.Stdout = out.w
+			if failed, code := c.writeFailed(out.err); failed {
+				exitCode = code
+			}
+		}()
+	}
 
 	// builtin and empty string
 	switch c.Name {
 	case "":
-		return
+		exitCode = c.assignVariables()
 	case "exit":
 		isExit, exitCode = c.exit()
 	case "echo":
-		c.echo()
+		exitCode = c.echo()
 	case "type":
-		c.typeCommand()
+		exitCode = c.typeCommand()
 	case "pwd":
-		c.pwd()
+		exitCode = c.pwd()
 	case "cd":
-		c.cd()
+		exitCode = c.cd()
+	case "export":
+		exitCode = c.export()
+	case "unset":
+		exitCode = c.unset()
+	case "readonly":
+		exitCode = c.readonly()
+	case "env":
+		exitCode = c.env()
+	case "set":
+		exitCode = c.set()
+	case "shopt":
+		exitCode = c.shopt()
+	case "jobs":
+		exitCode = c.jobs()
+	case "fg":
+		exitCode = c.fg()
+	case "bg":
+		exitCode = c.bg()
+	case "wait":
+		exitCode = c.wait()
+	case "disown":
+		exitCode = c.disown()
+	case "history":
+		exitCode = c.history()
+	case "complete":
+		exitCode = c.complete()
+	case "compgen":
+		exitCode = c.compgen()
+	case "hash":
+		exitCode = c.hash()
+	case "rehash":
+		exitCode = c.rehash()
+	case "bind":
+		exitCode = c.bind()
+	case "exec":
+		isExit, exitCode = c.exec()
 	default:
+		if strings.Contains(c.Name, "/") {
+			exitCode = c.runPath()
+			break
+		}
+
 		// executables found in PATH
 		location := c.searchPath()
 		if location != "" {
-			c.run()
+			exitCode = c.run(location)
 		} else {
 			fmt.Fprintf(c.Stderr, "%s: command not found\n", strings.Join(append([]string{c.Name}, c.Args...), " "))
+			exitCode = 127
 		}
 	}
 
 	return isExit, exitCode
 }
 
+// exit without a code uses the status of the last pipeline
 func (c *Command) exit() (bool, int) {
 	if len(c.Args) == 0 {
-		fmt.Fprint(c.Stderr, "Invalid exit code\n")
-		return false, 0
+		return true, c.state.LastStatus
 	}
 	code, err := strconv.Atoi(c.Args[0])
 	if err != nil {
-		fmt.Fprint(c.Stderr, "Invalid exit code\n")
-		return false, 0
+		fmt.Fprintf(c.Stderr, "bash: exit: %s: numeric argument required\n", c.Args[0])
+		return true, 2
+	}
+	if len(c.Args) > 1 {
+		fmt.Fprint(c.Stderr, "bash: exit: too many arguments\n")
+		return false, 1
 	}
-	return true, code
+	return true, code & 0xff
 }
 
-func (c *Command) echo() {
+func (c *Command) echo() int {
 	fmt.Fprintf(c.Stdout, "%s\n", strings.Join(c.Args, " "))
+	return 0
 }
 
-func (c *Command) typeCommand() {
+func (c *Command) typeCommand() int {
 	var name string
 	if len(c.Args) != 0 {
 		name = c.Args[0]
 	}
 
 	typeCmd := NewCommand(name, nil)
-	switch typeCmd.Name {
-	case "exit", "echo", "type", "pwd", "cd":
+	typeCmd.state = c.state
+	switch {
+	case IsBuiltin(typeCmd.Name):
 		fmt.Fprintf(c.Stdout, "%s is a shell builtin\n", typeCmd.Name)
 	default:
 		// executables found in PATH
@@ -189,51 +575,263 @@ func (c *Command) typeCommand() {
 			fmt.Fprintf(c.Stdout, "%s is %s\n", typeCmd.Name, location)
 		} else {
 			fmt.Fprintf(c.Stderr, "%s: not found\n", typeCmd.Name)
+			return 1
 		}
 	}
+	return 0
 }
 
-func (c *Command) pwd() {
-	cwd, err := os.Getwd()
+func (c *Command) pwd() int {
+	cwd, err := c.state.getwd()
 	if err != nil {
 		fmt.Fprintf(c.Stderr, "Couldn't retrieve the current working directory: %s\n", err.Error())
-		return
+		return 1
 	}
 	fmt.Fprintf(c.Stdout, "%s\n", cwd)
+	return 0
 }
 
-func (c *Command) cd() {
+func (c *Command) cd() int {
 	if len(c.Args) == 0 {
-		return
+		return 0
 	}
 
 	if len(c.Args) > 1 {
 		fmt.Fprint(c.Stderr, "bash: cd: too many arguments\n")
-		return
+		return 1
 	}
 
 	newDir := c.Args[0]
-	err := os.Chdir(newDir)
+	err := c.state.chdir(newDir)
 
 	if err != nil {
 		fmt.Fprintf(c.Stderr, "bash: cd: %s: No such file or directory\n", newDir)
+		return 1
 	}
+	return 0
 }
 
-func (c *Command) run() {
-	program := exec.Command(c.Name, c.Args...)
+// assignVariables handles a command made only of NAME=value pairs,
+// its status is the one of the last command substitution if any
+func (c *Command) assignVariables() int {
+	for _, assign := range c.Assigns {
+		name, value, _ := strings.Cut(assign, "=")
+		if err := c.state.Vars.Set(name, value); err != nil {
+			fmt.Fprintln(c.Stderr, err)
+			return 1
+		}
+	}
+	if c.state.substituted {
+		return c.state.substStatus
+	}
+	return 0
+}
+
+// run starts the program at path, Name is still what it sees as argv[0]
+func (c *Command) run(path string) int {
+	program := exec.Command(path, c.Args...)
+	program.Args[0] = c.Name
+	program.Dir = c.state.dir
+	program.Env = c.Env
 	program.Stdin = c.Stdin
 	program.Stdout = c.Stdout
 	program.Stderr = c.Stderr
+	extra, done := c.extraFiles()
+	program.ExtraFiles = extra
+
+	var err error
+	if c.job != nil {
+		err = c.runInJob(program)
+	} else {
+		err = program.Run()
+	}
+	done()
 
-	program.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		fmt.Fprintf(c.Stderr, "bash: %s: %s\n", c.Name, err.Error())
+	}
+	return exitStatus(err)
 }
 
-// Using built-in in GO
-func (c *Command) searchPath() string {
-	filePath, err := exec.LookPath(c.Name)
+// extraFiles are the descriptors from 3 up for a program, which only takes
+// files, so the ends of the pipes of the shell are copied through one,
+// done closes what was made for the program and waits for the copies
+func (c *Command) extraFiles() (files []*os.File, done func()) {
+	last := 2
+	for fd := range c.fds {
+		last = max(last, fd)
+	}
+
+	var ends []*os.File
+	var copies sync.WaitGroup
+	for fd := 3; fd <= last; fd++ {
+		switch stream := c.fds[fd].(type) {
+		case *os.File:
+			files = append(files, stream)
+		case io.Writer:
+			r, w, err := os.Pipe()
+			if err != nil {
+				files = append(files, nil)
+				continue
+			}
+			files, ends = append(files, w), append(ends, w)
+			copies.Add(1)
+			go func() {
+				defer copies.Done()
+				io.Copy(stream, r)
+				r.Close()
+			}()
+		case io.Reader:
+			r, w, err := os.Pipe()
+			if err != nil {
+				files = append(files, nil)
+				continue
+			}
+			files, ends = append(files, r), append(ends, r)
+			go func() {
+				io.Copy(w, stream)
+				w.Close()
+			}()
+		default:
+			// closed
+			files = append(files, nil)
+		}
+	}
+
+	return files, func() {
+		for _, end := range ends {
+			end.Close()
+		}
+		copies.Wait()
+	}
+}
+
+// runInJob starts the program as part of the job of the command
+// and waits for it, even while the job is stopped
+func (c *Command) runInJob(program *exec.Cmd) error {
+	jobs := c.job.table
+	proc, err := jobs.start(c.job, program)
+	c.proc = proc
+	if c.launched != nil {
+		c.launched()
+	}
 	if err != nil {
-		return ""
+		return err
+	}
+	return jobs.wait(c.job, proc, program)
+}
+
+// checkedWriter remembers the first error writing to w
+type checkedWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (cw *checkedWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	if err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return n, err
+}
+
+// writeFailed reports the error writing the output of a builtin and the
+// status it ends with, a pipe closed by the next stage ends it silently
+// like the SIGPIPE that kills a program
+func (c *Command) writeFailed(err error) (failed bool, exitCode int) {
+	switch {
+	case err == nil:
+		return false, 0
+	case errors.Is(err, io.ErrClosedPipe) || errors.Is(err, syscall.EPIPE):
+		return true, 128 + int(syscall.SIGPIPE)
+	}
+	fmt.Fprintf(c.Stderr, "bash: %s: write error: %s\n", c.Name, errnoText(err))
+	return true, 1
+}
+
+// errnoText is the message of the system error in err the
+// way bash prints it, like No such file or directory
+func errnoText(err error) string {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return err.Error()
+	}
+	text := errno.Error()
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+// runPath runs a command given as a path like ./script, reporting
+// why it can't be executed the way bash does
+func (c *Command) runPath() int {
+	// relative to the directory of the subshell, not of the process
+	path := c.state.resolve(c.Name)
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		fmt.Fprintf(c.Stderr, "bash: %s: No such file or directory\n", c.Name)
+		return 127
+	case info.IsDir():
+		fmt.Fprintf(c.Stderr, "bash: %s: Is a directory\n", c.Name)
+		return 126
+	case info.Mode().Perm()&0111 == 0:
+		fmt.Fprintf(c.Stderr, "bash: %s: Permission denied\n", c.Name)
+		return 126
+	}
+	return c.run(path)
+}
+
+// exitStatus converts the result of running a program into a shell
+// exit status, 128+N when it was killed by signal N
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+
+	// the program couldn't be started at all
+	if errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.ENOEXEC) {
+		return 126
+	}
+	return 127
+}
+
+// searchPath looks for an executable in the PATH of the shell through
+// the hash table, or in the one assigned before the command like
+// "PATH=/bin ls" which is searched without it
+func (c *Command) searchPath() string {
+	pathVar, _ := c.state.Vars.Get("PATH")
+	assigned := false
+	for _, assign := range c.Assigns {
+		if value, found := strings.CutPrefix(assign, "PATH="); found {
+			pathVar, assigned = value, true
+		}
+	}
+	if !assigned {
+		return c.state.Hash.Lookup(pathVar, c.Name)
+	}
+	return searchDirs(pathVar, c.Name)
+}
+
+// searchDirs looks for an executable name in the directories
+// of pathVar without the hash table, an empty one is .
+func searchDirs(pathVar, name string) string {
+	for dir := range strings.SplitSeq(pathVar, ":") {
+		if dir == "" {
+			dir = "."
+		}
+		filePath := filepath.Join(dir, name)
+		info, err := os.Stat(filePath)
+		if err == nil && !info.IsDir() && info.Mode().Perm()&0111 != 0 {
+			return filePath
+		}
 	}
-	return filePath
+	return ""
 }
@@ -0,0 +1,185 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestBuiltinWriteErrors(t *testing.T) {
+	closedPipe := func(t *testing.T) io.Writer {
+		r, w := io.Pipe()
+		r.Close()
+		return w
+	}
+	full := func(t *testing.T) io.Writer {
+		f, err := os.OpenFile("/dev/full", os.O_WRONLY, 0)
+		if err != nil {
+			t.Skip(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+
+	table := []struct {
+		name     string
+		cmd      string
+		args     []string
+		stdout   func(t *testing.T) io.Writer
+		wantCode int
+		wantErr  string
+	}{
+		{"closed", "echo", []string{"a"}, nil, 1, "bash: echo: write error: Bad file descriptor\n"},
+		{"full", "echo", []string{"a"}, full, 1, "bash: echo: write error: No space left on device\n"},
+		{"pwd closed", "pwd", nil, nil, 1, "bash: pwd: write error: Bad file descriptor\n"},
+		{"env closed", "env", nil, nil, 1, "bash: env: write error: Bad file descriptor\n"},
+		{"closed pipe", "echo", []string{"a"}, closedPipe, 141, ""},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			var stderr strings.Builder
+			fds := Fds{2: &stderr}
+			if entry.stdout != nil {
+				fds[1] = entry.stdout(t)
+			}
+
+			cmd := NewCommand(entry.cmd, entry.args)
+			cmd.state = NewState()
+			cmd.Env = []string{"A=1"}
+			cmd.setFds(fds)
+			defer cmd.closeFiles()
+
+			_, code := cmd.Execute()
+			if code != entry.wantCode {
+				t.Errorf("Wanted status %d, Got %d", entry.wantCode, code)
+			}
+			if stderr.String() != entry.wantErr {
+				t.Errorf("Wanted %q, Got %q", entry.wantErr, stderr.String())
+			}
+		})
+	}
+}
+
+// testCommand is a builtin of state writing to the returned buffers
+func testCommand(state *State, name string, args ...string) (cmd *Command, stdout, stderr *strings.Builder) {
+	stdout, stderr = &strings.Builder{}, &strings.Builder{}
+	cmd = NewCommand(name, args)
+	cmd.state = state
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	return cmd, stdout, stderr
+}
+
+func TestRunPathRelative(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "run.sh"), []byte("#!/bin/sh\nexit 3\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// a subshell that ran cd has its own directory, not the process one
+	state := NewState()
+	state.dir = dir
+
+	table := []struct {
+		name     string
+		wantCode int
+		wantErr  string
+	}{
+		{"./run.sh", 3, ""},
+		{"./missing.sh", 127, "bash: ./missing.sh: No such file or directory\n"},
+		{"./", 126, "bash: ./: Is a directory\n"},
+	}
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			cmd, _, stderr := testCommand(state, entry.name)
+			cmd.Env = os.Environ()
+			_, code := cmd.Execute()
+			if code != entry.wantCode {
+				t.Errorf("Wanted status %d, Got %d", entry.wantCode, code)
+			}
+			if stderr.String() != entry.wantErr {
+				t.Errorf("Wanted %q, Got %q", entry.wantErr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	notExecutable := filepath.Join(dir, "plain")
+	noFormat := filepath.Join(dir, "garbage")
+	if err := os.WriteFile(notExecutable, []byte("exit 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(noFormat, []byte("\x7fELF garbage"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		name string
+		cmd  *exec.Cmd
+		want int
+	}{
+		{"success", exec.Command("true"), 0},
+		{"exit code", exec.Command("sh", "-c", "exit 3"), 3},
+		{"killed by a signal", exec.Command("sh", "-c", "kill -TERM $$"), 128 + int(syscall.SIGTERM)},
+		{"not found", exec.Command(filepath.Join(dir, "missing")), 127},
+		{"not executable", exec.Command(notExecutable), 126},
+		{"not a program", exec.Command(noFormat), 126},
+	}
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			if got := exitStatus(entry.cmd.Run()); got != entry.want {
+				t.Errorf("Wanted %d, Got %d", entry.want, got)
+			}
+		})
+	}
+}
+
+func TestExit(t *testing.T) {
+	table := []struct {
+		args     []string
+		wantExit bool
+		wantCode int
+		wantErr  string
+	}{
+		{nil, true, 5, ""},
+		{[]string{"3"}, true, 3, ""},
+		{[]string{"263"}, true, 7, ""},
+		{[]string{"-1"}, true, 255, ""},
+		{[]string{"abc"}, true, 2, "bash: exit: abc: numeric argument required\n"},
+		{[]string{"1", "2"}, false, 1, "bash: exit: too many arguments\n"},
+	}
+	for _, entry := range table {
+		t.Run(strings.Join(entry.args, " "), func(t *testing.T) {
+			state := NewState()
+			// without a code exit uses $?
+			state.LastStatus = 5
+			cmd, _, stderr := testCommand(state, "exit", entry.args...)
+			isExit, code := cmd.Execute()
+			if isExit != entry.wantExit || code != entry.wantCode {
+				t.Errorf("Wanted %v %d, Got %v %d", entry.wantExit, entry.wantCode, isExit, code)
+			}
+			if stderr.String() != entry.wantErr {
+				t.Errorf("Wanted %q, Got %q", entry.wantErr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCommandNotFound(t *testing.T) {
+	state := NewState()
+	state.Vars.Set("PATH", t.TempDir())
+	cmd, _, stderr := testCommand(state, "nosuchprogram", "arg")
+	cmd.Env = os.Environ()
+	if _, code := cmd.Execute(); code != 127 {
+		t.Errorf("Wanted status 127, Got %d", code)
+	}
+	if want := "nosuchprogram arg: command not found\n"; stderr.String() != want {
+		t.Errorf("Wanted %q, Got %q", want, stderr.String())
+	}
+}
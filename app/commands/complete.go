@@ -0,0 +1,534 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/codecrafters-io/shell-starter-go/app/shellparser"
+)
+
+// CompSpec is how the arguments of a command are completed, set with complete
+type CompSpec struct {
+	actions  []string
+	options  []string
+	globPat  string
+	wordList string
+	command  string
+	filter   string
+	prefix   string
+	suffix   string
+}
+
+// compActions are the actions of -A, with the flag that is short for each
+var compActions = map[string]byte{
+	"builtin":   'b',
+	"command":   'c',
+	"directory": 'd',
+	"export":    'e',
+	"file":      'f',
+	"group":     'g',
+	"job":       'j',
+	"running":   0,
+	"stopped":   0,
+	"user":      'u',
+	"variable":  'v',
+}
+
+// compOptions are the options of -o
+var compOptions = []string{"bashdefault", "default", "dirnames", "filenames", "nospace", "plusdirs"}
+
+func (spec *CompSpec) hasOption(name string) bool {
+	return slices.Contains(spec.options, name)
+}
+
+// String writes the spec back as the complete command that sets it
+func (spec *CompSpec) String() string {
+	var sb strings.Builder
+	sb.WriteString("complete")
+	for _, option := range spec.options {
+		fmt.Fprintf(&sb, " -o %s", option)
+	}
+	for _, action := range spec.actions {
+		if flag := compActions[action]; flag != 0 {
+			fmt.Fprintf(&sb, " -%c", flag)
+		} else {
+			fmt.Fprintf(&sb, " -A %s", action)
+		}
+	}
+	for _, arg := range []struct {
+		flag  byte
+		value string
+	}{
+		{'G', spec.globPat}, {'W', spec.wordList}, {'C', spec.command},
+		{'X', spec.filter}, {'P', spec.prefix}, {'S', spec.suffix},
+	} {
+		if arg.value != "" {
+			fmt.Fprintf(&sb, " -%c %s", arg.flag, quoteValue(arg.value))
+		}
+	}
+	return sb.String()
+}
+
+// Completions is the table of completion specs by command name
+type Completions struct {
+	mu    sync.RWMutex
+	specs map[string]*CompSpec
+}
+
+func NewCompletions() *Completions {
+	return &Completions{specs: map[string]*CompSpec{}}
+}
+
+// clone copies the table for a subshell
+func (c *Completions) clone() *Completions {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return &Completions{specs: maps.Clone(c.specs)}
+}
+
+// get returns the spec of a command, looked up by its
+// full name and then by the last element of its path
+func (c *Completions) get(name string) (*CompSpec, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if spec, found := c.specs[name]; found {
+		return spec, true
+	}
+	spec, found := c.specs[filepath.Base(name)]
+	return spec, found
+}
+
+func (c *Completions) set(name string, spec *CompSpec) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.specs[name] = spec
+}
+
+// remove deletes the spec of name, every spec without a name
+func (c *Completions) remove(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name == "" {
+		clear(c.specs)
+		return true
+	}
+	_, found := c.specs[name]
+	delete(c.specs, name)
+	return found
+}
+
+func (c *Completions) names() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Sorted(maps.Keys(c.specs))
+}
+
+// CompResult are the completions a spec generated and
+// the -o options saying how the line editor inserts them
+type CompResult struct {
+	Words []string
+	// no space is added after a single completion
+	NoSpace bool
+	// words are paths, directories get a slash
+	Filenames bool
+	// paths (-o default and -o bashdefault) or directories (-o dirnames)
+	// are completed instead when the spec generates nothing
+	Default  bool
+	DirNames bool
+}
+
+// compContext is the command line the words are generated for
+type compContext struct {
+	cmd  string
+	word string
+	prev string
+	line string
+	// index of word in the line
+	cword int
+}
+
+// Complete generates the completions of the last of words, the word being
+// typed, with the spec of the command words[0], line is the input up to the
+// cursor, found is false when the command has no spec
+func (s *State) Complete(words []string, line string) (CompResult, bool) {
+	if len(words) < 2 {
+		return CompResult{}, false
+	}
+	spec, found := s.Completions.get(words[0])
+	if !found {
+		return CompResult{}, false
+	}
+
+	ctx := compContext{
+		cmd:   words[0],
+		word:  words[len(words)-1],
+		prev:  words[len(words)-2],
+		line:  line,
+		cword: len(words) - 1,
+	}
+	return CompResult{
+		Words:     s.generate(spec, ctx, os.Stderr),
+		NoSpace:   spec.hasOption("nospace"),
+		Filenames: spec.hasOption("filenames"),
+		Default:   spec.hasOption("default") || spec.hasOption("bashdefault"),
+		DirNames:  spec.hasOption("dirnames"),
+	}, true
+}
+
+// generate returns the sorted words spec generates for the word of ctx,
+// the output of -C is used as is, everything else has to start with word
+func (s *State) generate(spec *CompSpec, ctx compContext, stderr io.Writer) []string {
+	words := []string{}
+	for _, action := range spec.actions {
+		words = append(words, s.actionWords(action, ctx.word)...)
+	}
+	if spec.globPat != "" {
+		words = append(words, shellparser.Glob(spec.globPat, s.GlobOptions())...)
+	}
+	if spec.wordList != "" {
+		for _, w := range s.expandWordList(spec.wordList, stderr) {
+			if strings.HasPrefix(w, ctx.word) {
+				words = append(words, w)
+			}
+		}
+	}
+	if spec.command != "" {
+		words = append(words, s.runCompCommand(spec.command, ctx, stderr)...)
+	}
+
+	// -X removes what matches, or with ! what doesn't, & is the word
+	if filter := spec.filter; filter != "" {
+		negate := strings.HasPrefix(filter, "!")
+		pattern := strings.ReplaceAll(strings.TrimPrefix(filter, "!"), "&", shellparser.QuotePattern(ctx.word))
+		words = slices.DeleteFunc(words, func(w string) bool {
+			return shellparser.MatchPattern(pattern, w) != negate
+		})
+	}
+
+	for i, w := range words {
+		words[i] = spec.prefix + w + spec.suffix
+	}
+	if spec.hasOption("plusdirs") {
+		words = append(words, s.actionWords("directory", ctx.word)...)
+	}
+
+	slices.Sort(words)
+	return slices.Compact(words)
+}
+
+// actionWords returns the names of an -A action starting with word
+func (s *State) actionWords(action, word string) []string {
+	var names []string
+	switch action {
+	case "builtin":
+		names = Builtins()
+	case "command":
+		if strings.Contains(word, "/") {
+			return s.pathWords(word, func(info os.FileInfo) bool {
+				return !info.IsDir() && info.Mode()&0o111 != 0
+			})
+		}
+		programs, _ := s.CommandNames()
+		names = append(Builtins(), programs...)
+	case "directory":
+		return s.pathWords(word, os.FileInfo.IsDir)
+	case "file":
+		return s.pathWords(word, nil)
+	case "export":
+		names = s.Vars.names(func(vr *variable) bool { return vr.exported })
+	case "variable":
+		names = s.Vars.names(func(vr *variable) bool { return true })
+	case "job", "running", "stopped":
+		names = s.Jobs.commandNames(action)
+	case "user":
+		names = readNames("/etc/passwd")
+	case "group":
+		names = readNames("/etc/group")
+	}
+
+	res := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, word) {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// pathWords returns the paths starting with word that
+// pass keep, a nil keep keeps all of them
+func (s *State) pathWords(word string, keep func(info os.FileInfo) bool) []string {
+	home, _ := s.Vars.Get("HOME")
+	glob := word
+	tilde := strings.HasPrefix(word, "~/")
+	if tilde {
+		glob = home + word[1:]
+	}
+
+	res := []string{}
+	for _, path := range shellparser.Glob(shellparser.QuotePattern(glob)+"*", s.GlobOptions()) {
+		info, err := os.Stat(s.resolve(path))
+		if err != nil || (keep != nil && !keep(info)) {
+			continue
+		}
+		if tilde {
+			path = "~" + strings.TrimPrefix(path, home)
+		}
+		res = append(res, path)
+	}
+	return res
+}
+
+// readNames returns the first field of every line of
+// a colon separated file like /etc/passwd
+func readNames(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	names := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if name, _, found := strings.Cut(scanner.Text(), ":"); found && !strings.HasPrefix(name, "#") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// expandWordList expands the words of -W like the arguments of a command
+func (s *State) expandWordList(wordList string, stderr io.Writer) []string {
+	list, err := shellparser.NewParser().Parse([]byte(wordList))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil
+	}
+
+	words := []string{}
+	for _, andOr := range list.Items {
+		for _, pipeline := range andOr.Pipelines {
+			for _, cmd := range pipeline.Commands {
+				for _, assign := range cmd.Assigns {
+					value, err := shellparser.ExpandWord(assign.Value, s)
+					if err != nil {
+						fmt.Fprintln(stderr, err)
+						return nil
+					}
+					words = append(words, assign.Name+"="+value)
+				}
+				fields, err := shellparser.ExpandWords(cmd.Words, s)
+				if err != nil {
+					fmt.Fprintln(stderr, err)
+					return nil
+				}
+				words = append(words, fields...)
+			}
+		}
+	}
+	return words
+}
+
+// runCompCommand runs the command of -C in a subshell with the command
+// name, the word and the word before it as arguments and COMP_LINE,
+// COMP_POINT and COMP_CWORD set, every line it prints is a completion
+func (s *State) runCompCommand(command string, ctx compContext, stderr io.Writer) []string {
+	line := fmt.Sprintf("%s %s %s %s", command, quoteValue(ctx.cmd), quoteValue(ctx.word), quoteValue(ctx.prev))
+	list, err := shellparser.NewParser().Parse([]byte(line))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil
+	}
+
+	sub := s.subshell()
+	for name, value := range map[string]string{
+		"COMP_LINE":  ctx.line,
+		"COMP_POINT": strconv.Itoa(len(ctx.line)),
+		"COMP_CWORD": strconv.Itoa(ctx.cword),
+	} {
+		sub.Vars.Set(name, value)
+		sub.Vars.Export(name, true)
+	}
+
+	out, err := sub.Substitute(list)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil
+	}
+
+	words := []string{}
+	for w := range strings.SplitSeq(strings.TrimRight(out, "\n"), "\n") {
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// parseCompSpec reads the options of complete and compgen, usage is the
+// synopsis shown on errors, -p and -r of complete are returned in flags
+func (c *Command) parseCompSpec(usage string) (spec *CompSpec, flags map[byte]bool, args []string, ok bool) {
+	spec, flags, args = &CompSpec{}, map[byte]bool{}, c.Args
+
+	invalid := func(format string, a ...any) (*CompSpec, map[byte]bool, []string, bool) {
+		fmt.Fprintf(c.Stderr, "bash: %s: "+format+"\n", append([]any{c.Name}, a...)...)
+		fmt.Fprintf(c.Stderr, "%s: usage: %s %s\n", c.Name, c.Name, usage)
+		return nil, nil, nil, false
+	}
+
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+
+		for i := 1; i < len(arg); i++ {
+			flag := arg[i]
+			if !strings.ContainsRune("oAGWFCXPS", rune(flag)) {
+				switch {
+				case strings.IndexByte("bcdefgjuv", flag) >= 0:
+					for action, short := range compActions {
+						if short == flag {
+							spec.actions = append(spec.actions, action)
+						}
+					}
+				case c.Name == "complete" && (flag == 'p' || flag == 'r'):
+					flags[flag] = true
+				default:
+					return invalid("-%c: invalid option", flag)
+				}
+				continue
+			}
+
+			// the value is the rest of this argument or the next one
+			value := arg[i+1:]
+			if value == "" {
+				if len(args) == 0 {
+					return invalid("-%c: option requires an argument", flag)
+				}
+				value, args = args[0], args[1:]
+			}
+			i = len(arg)
+
+			switch flag {
+			case 'o':
+				if !slices.Contains(compOptions, value) {
+					return invalid("%s: invalid option name", value)
+				}
+				spec.options = append(spec.options, value)
+			case 'A':
+				if _, found := compActions[value]; !found {
+					return invalid("%s: invalid action name", value)
+				}
+				spec.actions = append(spec.actions, value)
+			case 'G':
+				spec.globPat = value
+			case 'W':
+				spec.wordList = value
+			case 'F':
+				fmt.Fprintf(c.Stderr, "bash: %s: -F: shell functions are not supported, use -C\n", c.Name)
+				return nil, nil, nil, false
+			case 'C':
+				spec.command = value
+			case 'X':
+				spec.filter = value
+			case 'P':
+				spec.prefix = value
+			case 'S':
+				spec.suffix = value
+			}
+		}
+	}
+	return spec, flags, args, true
+}
+
+// complete [-pr] [-bcdefgjuv] [-o option] [-A action] [-G globpat]
+// [-W wordlist] [-C command] [-X filterpat] [-P prefix] [-S suffix] [name ...]
+func (c *Command) complete() int {
+	spec, flags, args, ok := c.parseCompSpec("[-pr] [-bcdefgjuv] [-o option] [-A action] [-G globpat] [-W wordlist] [-C command] [-X filterpat] [-P prefix] [-S suffix] [name ...]")
+	if !ok {
+		return 2
+	}
+	table := c.state.Completions
+
+	if flags['r'] {
+		if len(args) == 0 {
+			table.remove("")
+			return 0
+		}
+		exitCode := 0
+		for _, name := range args {
+			if !table.remove(name) {
+				fmt.Fprintf(c.Stderr, "bash: complete: %s: no completion specification\n", name)
+				exitCode = 1
+			}
+		}
+		return exitCode
+	}
+
+	if flags['p'] || len(args) == 0 {
+		names := args
+		if len(names) == 0 {
+			names = table.names()
+		}
+		exitCode := 0
+		for _, name := range names {
+			spec, found := table.get(name)
+			if !found {
+				fmt.Fprintf(c.Stderr, "bash: complete: %s: no completion specification\n", name)
+				exitCode = 1
+				continue
+			}
+			fmt.Fprintf(c.Stdout, "%s %s\n", spec, quoteValue(name))
+		}
+		return exitCode
+	}
+
+	for _, name := range args {
+		table.set(name, spec)
+	}
+	return 0
+}
+
+// compgen [-bcdefgjuv] [-o option] [-A action] [-G globpat] [-W wordlist]
+// [-C command] [-X filterpat] [-P prefix] [-S suffix] [word]
+func (c *Command) compgen() int {
+	spec, _, args, ok := c.parseCompSpec("[-bcdefgjuv] [-o option] [-A action] [-G globpat] [-W wordlist] [-C command] [-X filterpat] [-P prefix] [-S suffix] [word]")
+	if !ok {
+		return 2
+	}
+
+	ctx := compContext{cmd: "compgen"}
+	if len(args) > 0 {
+		ctx.word = args[0]
+	}
+	ctx.line = "compgen " + ctx.word
+
+	words := c.state.generate(spec, ctx, c.Stderr)
+	if len(words) == 0 {
+		switch {
+		case spec.hasOption("default"), spec.hasOption("bashdefault"):
+			words = c.state.actionWords("file", ctx.word)
+		case spec.hasOption("dirnames"):
+			words = c.state.actionWords("directory", ctx.word)
+		}
+	}
+
+	for _, w := range words {
+		fmt.Fprintln(c.Stdout, w)
+	}
+	if len(words) == 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,164 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/shell-starter-go/app/shellparser"
+)
+
+func TestParseCompSpec(t *testing.T) {
+	table := []struct {
+		name string
+		args []string
+		// the spec as complete -p shows it, or the error
+		want     string
+		wantArgs []string
+		wantErr  string
+	}{
+		{"flags", []string{"-df", "ls"}, "complete -d -f", []string{"ls"}, ""},
+		{"actions", []string{"-A", "stopped", "-A", "user", "fg"}, "complete -A stopped -u", []string{"fg"}, ""},
+		{"options", []string{"-o", "nospace", "-o", "plusdirs", "x"}, "complete -o nospace -o plusdirs", []string{"x"}, ""},
+		{"value in the same argument", []string{"-Wa b", "-Pp", "x"}, "complete -W 'a b' -P p", []string{"x"}, ""},
+		{"values after flags", []string{"-fX", "*.o", "x"}, "complete -f -X '*.o'", []string{"x"}, ""},
+		{"all the values", []string{"-G", "*.go", "-C", "cmd", "-S", "/", "x", "y"}, "complete -G '*.go' -C cmd -S /", []string{"x", "y"}, ""},
+		{"-- ends the options", []string{"-f", "--", "-x"}, "complete -f", []string{"-x"}, ""},
+		{"invalid flag", []string{"-z", "x"}, "", nil, "bash: complete: -z: invalid option\n"},
+		{"missing value", []string{"-W"}, "", nil, "bash: complete: -W: option requires an argument\n"},
+		{"invalid option name", []string{"-o", "bad", "x"}, "", nil, "bash: complete: bad: invalid option name\n"},
+		{"invalid action", []string{"-A", "bad", "x"}, "", nil, "bash: complete: bad: invalid action name\n"},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			cmd, _, stderr := testCommand(NewState(), "complete", entry.args...)
+			spec, _, args, ok := cmd.parseCompSpec("[usage]")
+			if ok != (entry.wantErr == "") {
+				t.Fatalf("Wanted ok %v, Got %v", entry.wantErr == "", ok)
+			}
+			if !ok {
+				want := entry.wantErr + "complete: usage: complete [usage]\n"
+				if stderr.String() != want {
+					t.Errorf("Wanted %q, Got %q", want, stderr.String())
+				}
+				return
+			}
+			if spec.String() != entry.want {
+				t.Errorf("Wanted %q, Got %q", entry.want, spec.String())
+			}
+			if !slices.Equal(args, entry.wantArgs) {
+				t.Errorf("Wanted %q, Got %q", entry.wantArgs, args)
+			}
+		})
+	}
+
+	// -p and -r are only options of complete
+	cmd, _, _ := testCommand(NewState(), "complete", "-pr", "x")
+	if _, flags, _, ok := cmd.parseCompSpec(""); !ok || !flags['p'] || !flags['r'] {
+		t.Errorf("Wanted -p and -r, Got %v", flags)
+	}
+	cmd, _, stderr := testCommand(NewState(), "compgen", "-p")
+	if _, _, _, ok := cmd.parseCompSpec(""); ok || !strings.HasPrefix(stderr.String(), "bash: compgen: -p: invalid option\n") {
+		t.Errorf("Wanted -p to be invalid, Got %q", stderr.String())
+	}
+}
+
+func TestCompSpecRoundTrip(t *testing.T) {
+	table := [][]string{
+		{"-o", "default", "-A", "running", "-b"},
+		{"-W", "$HOME 'a b' it's", "-X", "!&*"},
+		{"-G", "*.[ch]", "-P", "pre fix", "-S", `\`},
+		{"-C", "echo a; echo b"},
+	}
+
+	for _, args := range table {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			state := NewState()
+			cmd, _, _ := testCommand(state, "complete", append(args, "first")...)
+			cmd.Execute()
+			cmd, printed, _ := testCommand(state, "complete", "-p", "first")
+			cmd.Execute()
+
+			// running what -p prints sets the same spec
+			line := strings.Replace(printed.String(), " first\n", " second", 1)
+			list, err := shellparser.NewParser().Parse([]byte(line))
+			if err != nil {
+				t.Fatal(err)
+			}
+			words, err := shellparser.ExpandWords(list.Items[0].Pipelines[0].Commands[0].Words, state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd, _, _ = testCommand(state, words[0], words[1:]...)
+			cmd.Execute()
+
+			first, _ := state.Completions.get("first")
+			second, _ := state.Completions.get("second")
+			if first.String() != second.String() {
+				t.Errorf("Wanted %q, Got %q", first, second)
+			}
+		})
+	}
+}
+
+func TestCompgen(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"dir1", "dir2"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file1"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		name     string
+		args     []string
+		want     []string
+		wantCode int
+	}{
+		{"word list", []string{"-W", "apple banana avocado", "a"}, []string{"apple", "avocado"}, 0},
+		{"expanded word list", []string{"-W", "$FRUIT 'a b'"}, []string{"a b", "kiwi"}, 0},
+		{"sorted without duplicates", []string{"-W", "b a b"}, []string{"a", "b"}, 0},
+		{"nothing generated", []string{"-W", "apple", "x"}, nil, 1},
+		{"-X removes matches", []string{"-W", "apple banana cherry", "-X", "a*"}, []string{"banana", "cherry"}, 0},
+		{"-X ! keeps matches", []string{"-W", "apple banana cherry", "-X", "!a*"}, []string{"apple"}, 0},
+		{"-X & is the word", []string{"-W", "foo foobar", "-X", "&", "foo"}, []string{"foobar"}, 0},
+		{"-X !& keeps the word", []string{"-W", "foo foobar", "-X", "!&", "foo"}, []string{"foo"}, 0},
+		{"-X & is quoted", []string{"-W", "'a*' 'a*b'", "-X", "&", "a*"}, []string{"a*b"}, 0},
+		{"-P and -S", []string{"-W", "a b", "-P", "<", "-S", ">"}, []string{"<a>", "<b>"}, 0},
+		{"-X before -P", []string{"-W", "a b", "-X", "!a", "-P", "x"}, []string{"xa"}, 0},
+		{"plusdirs", []string{"-W", dir + "/x", "-P", "p", "-o", "plusdirs", dir + "/"}, []string{dir + "/dir1", dir + "/dir2", "p" + dir + "/x"}, 0},
+		{"directories", []string{"-d", dir + "/"}, []string{dir + "/dir1", dir + "/dir2"}, 0},
+		{"files", []string{"-f", dir + "/f"}, []string{dir + "/file1"}, 0},
+		{"default when nothing", []string{"-W", "x", "-o", "default", dir + "/f"}, []string{dir + "/file1"}, 0},
+		{"dirnames when nothing", []string{"-W", "x", "-o", "dirnames", dir + "/d"}, []string{dir + "/dir1", dir + "/dir2"}, 0},
+		{"builtins", []string{"-b", "ech"}, []string{"echo"}, 0},
+		{"variables", []string{"-v", "FRU"}, []string{"FRUIT"}, 0},
+		{"command gets its arguments", []string{"-C", `printf '%s\n' x`, "w"}, []string{"compgen", "w", "x"}, 0},
+		{"invalid option", []string{"-o", "bad"}, nil, 2},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			state := NewState()
+			state.Vars.Set("FRUIT", "kiwi")
+			cmd, stdout, _ := testCommand(state, "compgen", entry.args...)
+			_, code := cmd.Execute()
+			if code != entry.wantCode {
+				t.Errorf("Wanted status %d, Got %d", entry.wantCode, code)
+			}
+			want := ""
+			for _, w := range entry.want {
+				want += w + "\n"
+			}
+			if stdout.String() != want {
+				t.Errorf("Wanted %q, Got %q", want, stdout.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package commands
+
+import "github.com/codecrafters-io/shell-starter-go/app/shellparser"
+
+// runCompound runs the if or the loop of the command with its
+// descriptors, in the shell when it's alone or else in the subshell
+// of its pipeline stage, where its pipelines join the job of the stage
+func (c *Command) runCompound() (bool, int, error) {
+	state := c.state
+	if c.job != nil {
+		state.job = c.job
+	}
+	fds := state.fds
+	state.fds = c.fds
+	defer func() { state.fds = fds }()
+
+	switch compound := c.compound.(type) {
+	case *shellparser.IfClause:
+		return runIf(state, compound)
+	case *shellparser.LoopClause:
+		// the shell gets Ctrl-C itself while no program has the
+		// terminal, a loop of builtins in the foreground stops at it
+		jobs := state.Jobs
+		if c.job != nil {
+			jobs = c.job.table
+		}
+		interrupted := func() bool { return false }
+		if c.job == nil || !c.job.background {
+			var stop func()
+			interrupted, stop = jobs.watchInterrupts()
+			defer stop()
+		}
+		return runLoop(state, compound, interrupted)
+	}
+	return false, 0, nil
+}
+
+// runIf runs the body of the first condition that succeeds,
+// its status is 0 when no body runs like in bash
+func runIf(state *State, clause *shellparser.IfClause) (bool, int, error) {
+	for i, cond := range clause.Conds {
+		isExit, exitCode, err := startList(state, cond)
+		if isExit || err != nil {
+			return isExit, exitCode, err
+		}
+		if exitCode == 0 {
+			return startList(state, clause.Bodies[i])
+		}
+	}
+	if clause.Else != nil {
+		return startList(state, clause.Else)
+	}
+	return false, 0, nil
+}
+
+// runLoop runs the body as long as the condition allows it,
+// its status is the one of the last body run or 0
+func runLoop(state *State, loop *shellparser.LoopClause, interrupted func() bool) (bool, int, error) {
+	status := 0
+	for {
+		if interrupted() {
+			return false, 130, ErrAborted
+		}
+		isExit, exitCode, err := startList(state, loop.Cond)
+		if isExit || err != nil {
+			return isExit, exitCode, err
+		}
+		if (exitCode == 0) == loop.Until {
+			return false, status, nil
+		}
+		isExit, status, err = startList(state, loop.Body)
+		if isExit || err != nil {
+			return isExit, status, err
+		}
+	}
+}
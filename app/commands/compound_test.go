@@ -0,0 +1,44 @@
+package commands
+
+import "testing"
+
+func TestCompoundCommands(t *testing.T) {
+	table := []struct {
+		name       string
+		lines      []string
+		wantOut    string
+		wantStatus int
+	}{
+		{"if", []string{"if true; then echo a; else echo b; fi"}, "a\n", 0},
+		{"else", []string{"if false; then echo a; else echo b; fi"}, "b\n", 0},
+		{"elif", []string{"if false; then echo a; elif true; then echo c; fi"}, "c\n", 0},
+		{"no body run", []string{"if false; then echo a; fi", "echo $?"}, "0\n", 0},
+		{"status of the body", []string{"if true; then false; fi"}, "", 1},
+		{"while", []string{"i=", "while test \"$i\" != xxx; do i=${i}x; echo $i; done"}, "x\nxx\nxxx\n", 0},
+		{"until", []string{"until test \"$i\" = xx; do i=${i}x; done", "echo $i"}, "xx\n", 0},
+		{"exit in a loop", []string{"while true; do echo once; exit 3; done"}, "once\n", 0},
+		{"redirected", []string{"if true; then echo a; echo b; fi >f", "cat f"}, "a\nb\n", 0},
+		{"in a pipeline", []string{"echo hi | if true; then cat; fi"}, "hi\n", 0},
+		{"piped", []string{"while true; do echo a; echo b; exit; done | wc -l"}, "2\n", 0},
+		{"stage in a subshell", []string{"x=1", "echo | if true; then x=2; fi", "echo $x"}, "1\n", 0},
+		{"in the background", []string{"if true; then echo bg; fi &", "wait"}, "bg\n", 0},
+		{"nested", []string{"if true; then while false; do :; done; echo n; fi"}, "n\n", 0},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			state := NewState()
+			state.dir = t.TempDir()
+			stdout, stderr := runLines(t, state, entry.lines...)
+			if stdout.String() != entry.wantOut {
+				t.Errorf("Wanted %q, Got %q", entry.wantOut, stdout.String())
+			}
+			if stderr.String() != "" {
+				t.Errorf("Didn't expect errors but got %q", stderr.String())
+			}
+			if state.LastStatus != entry.wantStatus {
+				t.Errorf("Wanted status %d, Got %d", entry.wantStatus, state.LastStatus)
+			}
+		})
+	}
+}
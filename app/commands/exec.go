@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const execUsage = "exec: usage: exec [-cl] [-a name] [command [argument ...]] [redirection ...]"
+
+// exec [-cl] [-a name] [command [argument ...]] [redirection ...]
+func (c *Command) exec() (bool, int) {
+	args := c.Args
+	argv0, login, clean := "", false, false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i := 1; i < len(arg); i++ {
+			switch arg[i] {
+			case 'c':
+				clean = true
+			case 'l':
+				login = true
+			case 'a':
+				if len(args) == 0 {
+					fmt.Fprintln(c.Stderr, "bash: exec: -a: option requires an argument")
+					fmt.Fprintln(c.Stderr, execUsage)
+					return false, 2
+				}
+				argv0, args = args[0], args[1:]
+			default:
+				fmt.Fprintf(c.Stderr, "bash: exec: -%c: invalid option\n", arg[i])
+				fmt.Fprintln(c.Stderr, execUsage)
+				return false, 2
+			}
+		}
+	}
+
+	if len(args) == 0 {
+		c.keepFds()
+		return false, 0
+	}
+
+	cmd := NewCommand(args[0], args[1:])
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = c.Stdin, c.Stdout, c.Stderr
+	cmd.fds = c.fds
+	cmd.state = c.state
+	cmd.job, cmd.launched = c.job, c.launched
+	cmd.Assigns, cmd.Env = c.Assigns, c.Env
+	if clean {
+		cmd.Env = []string{}
+	}
+
+	// exec only runs programs, never builtins
+	path := cmd.Name
+	if !strings.Contains(path, "/") {
+		path = cmd.searchPath()
+	}
+	if info, err := os.Stat(c.state.resolve(path)); path == "" || err != nil || info.IsDir() {
+		fmt.Fprintf(c.Stderr, "bash: exec: %s: not found\n", cmd.Name)
+		return c.state.child, 127
+	}
+	if argv0 != "" {
+		cmd.Name = argv0
+	}
+	if login {
+		cmd.Name = "-" + cmd.Name
+	}
+
+	// a subshell has no process of its own to replace,
+	// it runs the program and ends with it instead
+	if c.state.child {
+		return true, cmd.run(c.state.resolve(path))
+	}
+	return false, cmd.replaceShell(path)
+}
+
+// keepFds makes the descriptors of exec without a command the ones of
+// the commands after it, the files it opened stay open with them while
+// the pipe ends of a pipeline stage are still closed with the stage
+func (c *Command) keepFds() {
+	var pipes, opened []io.Closer
+	for _, closer := range c.owned {
+		if slices.Contains(c.pipes, closer) {
+			pipes = append(pipes, closer)
+		} else {
+			opened = append(opened, closer)
+		}
+	}
+	c.owned = pipes
+	c.state.setFds(c.fds, opened)
+}
+
+// replaceShell runs the program at path in place of the shell with the
+// descriptors of the command, it only returns when that fails
+func (c *Command) replaceShell(path string) int {
+	files := map[int]*os.File{}
+	for fd, stream := range c.fds {
+		file, ok := stream.(*os.File)
+		if !ok {
+			fmt.Fprintf(c.Stderr, "bash: exec: %d: not a file\n", fd)
+			return 1
+		}
+		files[fd] = file
+	}
+
+	// the descriptors are copied out of the way first so none is
+	// overwritten before it's moved, the shell's own are kept to
+	// be put back if the program can't be run
+	targets := []int{0, 1, 2}
+	moved, saved := map[int]int{}, map[int]int{}
+	for fd, file := range files {
+		targets = append(targets, fd)
+		copied, err := unix.FcntlInt(file.Fd(), unix.F_DUPFD_CLOEXEC, 3)
+		if err != nil {
+			fmt.Fprintf(c.Stderr, "bash: exec: %d: %s\n", fd, errnoText(err))
+			return 1
+		}
+		moved[fd] = copied
+	}
+	slices.Sort(targets)
+	targets = slices.Compact(targets)
+	for _, fd := range targets {
+		if copied, err := unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 3); err == nil {
+			saved[fd] = copied
+		}
+	}
+	defer func() {
+		for _, fd := range moved {
+			unix.Close(fd)
+		}
+		for _, fd := range saved {
+			unix.Close(fd)
+		}
+	}()
+
+	for _, fd := range targets {
+		if copied, found := moved[fd]; found {
+			unix.Dup3(copied, fd, 0)
+		} else {
+			// closed with <&- or >&-
+			unix.Close(fd)
+		}
+	}
+
+	takeBack := c.state.Jobs.handOver()
+	argv := append([]string{c.Name}, c.Args...)
+	err := syscall.Exec(c.state.resolve(path), argv, c.Env)
+	takeBack()
+
+	for _, fd := range targets {
+		flags := unix.O_CLOEXEC
+		if fd <= 2 {
+			flags = 0
+		}
+		if copied, found := saved[fd]; found {
+			unix.Dup3(copied, fd, flags)
+		} else {
+			unix.Close(fd)
+		}
+	}
+	fmt.Fprintf(c.Stderr, "bash: exec: %s: cannot execute: %s\n", c.Name, errnoText(err))
+	return 126
+}
@@ -0,0 +1,313 @@
+package commands
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hashDir is a directory of PATH and the names of the files in it
+type hashDir struct {
+	path  string
+	mtime time.Time
+	names map[string]bool
+}
+
+// hashEntry is where a command was found and how many times it was used
+type hashEntry struct {
+	path string
+	hits int
+}
+
+// CommandHash remembers where the programs of PATH are, like the hash
+// table of bash, and the names of every program for completion, it's
+// emptied when PATH changes and a directory is read again when its
+// modification time changes
+type CommandHash struct {
+	mu sync.Mutex
+	// PATH the table was built for
+	path string
+	dirs []*hashDir
+	// the commands found so far, listed by hash
+	entries map[string]*hashEntry
+	// changes whenever the names in the directories may have changed
+	version int
+}
+
+func NewCommandHash() *CommandHash {
+	return &CommandHash{entries: map[string]*hashEntry{}}
+}
+
+// refresh reads the directories of pathVar again when PATH changed
+// or a directory was modified, the caller must hold h.mu
+func (h *CommandHash) refresh(pathVar string) {
+	if pathVar != h.path || h.dirs == nil {
+		h.path = pathVar
+		h.dirs = nil
+		clear(h.entries)
+		for dir := range strings.SplitSeq(pathVar, ":") {
+			if dir == "" {
+				dir = "."
+			}
+			h.dirs = append(h.dirs, &hashDir{path: dir})
+		}
+		h.version++
+	}
+
+	for _, dir := range h.dirs {
+		info, err := os.Stat(dir.path)
+		if err != nil {
+			if dir.names != nil {
+				dir.names, dir.mtime = nil, time.Time{}
+				h.version++
+			}
+			continue
+		}
+		// relative directories change with the working directory
+		if dir.names != nil && info.ModTime().Equal(dir.mtime) && filepath.IsAbs(dir.path) {
+			continue
+		}
+
+		entries, _ := os.ReadDir(dir.path)
+		names := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				names[entry.Name()] = true
+			}
+		}
+		if !maps.Equal(names, dir.names) {
+			h.version++
+		}
+		dir.names, dir.mtime = names, info.ModTime()
+	}
+}
+
+// Lookup returns the path of the program name in pathVar, a program
+// already found is used again as long as it's still there
+func (h *CommandHash) Lookup(pathVar, name string) string {
+	return h.lookup(pathVar, name, 1)
+}
+
+// lookup is Lookup counting hits uses of the command
+func (h *CommandHash) lookup(pathVar, name string, hits int) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if pathVar != h.path {
+		h.refresh(pathVar)
+	}
+	if entry, found := h.entries[name]; found && isExecutable(entry.path) {
+		entry.hits += hits
+		return entry.path
+	}
+
+	h.refresh(pathVar)
+	path := h.search(name)
+	if path != "" && filepath.IsAbs(path) {
+		h.entries[name] = &hashEntry{path: path, hits: hits}
+	}
+	return path
+}
+
+// search looks for name in the directories, the caller must hold h.mu
+func (h *CommandHash) search(name string) string {
+	for _, dir := range h.dirs {
+		if !dir.names[name] {
+			continue
+		}
+		path := filepath.Join(dir.path, name)
+		if isExecutable(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode().Perm()&0111 != 0
+}
+
+// Names returns every file name in the directories of pathVar and
+// the version of the table, which changes when the names may have
+func (h *CommandHash) Names(pathVar string) ([]string, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.refresh(pathVar)
+	names := []string{}
+	for _, dir := range h.dirs {
+		for name := range dir.names {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names), h.version
+}
+
+// Rehash forgets every command and every directory
+func (h *CommandHash) Rehash() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.dirs = nil
+	clear(h.entries)
+	h.version++
+}
+
+func (h *CommandHash) set(pathVar, name, path string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if pathVar != h.path {
+		h.refresh(pathVar)
+	}
+	h.entries[name] = &hashEntry{path: path}
+}
+
+func (h *CommandHash) get(name string) (hashEntry, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if entry, found := h.entries[name]; found {
+		return *entry, true
+	}
+	return hashEntry{}, false
+}
+
+func (h *CommandHash) forget(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, found := h.entries[name]
+	delete(h.entries, name)
+	return found
+}
+
+// list returns the commands found so far sorted by name
+func (h *CommandHash) list() ([]string, []hashEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	names := slices.Sorted(maps.Keys(h.entries))
+	entries := make([]hashEntry, len(names))
+	for i, name := range names {
+		entries[i] = *h.entries[name]
+	}
+	return names, entries
+}
+
+// CommandNames returns the programs of PATH for completion and
+// a version that changes when they may have changed
+func (s *State) CommandNames() ([]string, int) {
+	pathVar, _ := s.Vars.Get("PATH")
+	return s.Hash.Names(pathVar)
+}
+
+// hash [-lrt] [-p pathname] [-d] [name ...]
+func (c *Command) hash() int {
+	args := c.Args
+	var remove, forget, show, list bool
+	pathname := ""
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		for i := 1; i < len(arg); i++ {
+			switch arg[i] {
+			case 'r':
+				remove = true
+			case 'd':
+				forget = true
+			case 't':
+				show = true
+			case 'l':
+				list = true
+			case 'p':
+				pathname = arg[i+1:]
+				if pathname == "" {
+					if len(args) == 0 {
+						fmt.Fprintln(c.Stderr, "bash: hash: -p: option requires an argument")
+						fmt.Fprintln(c.Stderr, "hash: usage: hash [-lr] [-p pathname] [-dt] [name ...]")
+						return 2
+					}
+					pathname, args = args[0], args[1:]
+				}
+				i = len(arg)
+			default:
+				fmt.Fprintf(c.Stderr, "bash: hash: -%c: invalid option\n", arg[i])
+				fmt.Fprintln(c.Stderr, "hash: usage: hash [-lr] [-p pathname] [-dt] [name ...]")
+				return 2
+			}
+		}
+	}
+
+	table := c.state.Hash
+	if remove {
+		table.Rehash()
+	}
+
+	if len(args) == 0 {
+		if remove {
+			return 0
+		}
+		names, entries := table.list()
+		if len(names) == 0 {
+			fmt.Fprintln(c.Stdout, "hash: hash table empty")
+			return 0
+		}
+		if !list {
+			fmt.Fprintln(c.Stdout, "hits\tcommand")
+		}
+		for i, name := range names {
+			if list {
+				fmt.Fprintf(c.Stdout, "builtin hash -p %s %s\n", entries[i].path, name)
+			} else {
+				fmt.Fprintf(c.Stdout, "%4d\t%s\n", entries[i].hits, entries[i].path)
+			}
+		}
+		return 0
+	}
+
+	exitCode := 0
+	pathVar, _ := c.state.Vars.Get("PATH")
+	for _, name := range args {
+		switch {
+		case pathname != "":
+			table.set(pathVar, name, pathname)
+		case forget:
+			if !table.forget(name) {
+				fmt.Fprintf(c.Stderr, "bash: hash: %s: not found\n", name)
+				exitCode = 1
+			}
+		case show:
+			entry, found := table.get(name)
+			if !found {
+				fmt.Fprintf(c.Stderr, "bash: hash: %s: not found\n", name)
+				exitCode = 1
+				continue
+			}
+			if len(args) > 1 {
+				fmt.Fprintf(c.Stdout, "%s\t", name)
+			}
+			fmt.Fprintln(c.Stdout, entry.path)
+		case IsBuiltin(name) || strings.Contains(name, "/"):
+			// nothing to look for
+		default:
+			// looking it up here doesn't count as using it
+			if table.lookup(pathVar, name, 0) == "" {
+				fmt.Fprintf(c.Stderr, "bash: hash: %s: not found\n", name)
+				exitCode = 1
+			}
+		}
+	}
+	return exitCode
+}
+
+// rehash forgets every command and reads PATH again
+func (c *Command) rehash() int {
+	c.state.Hash.Rehash()
+	c.state.CommandNames()
+	return 0
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// History is the list of lines entered in the shell, kept by the line editor
+type History interface {
+	// Entries returns the lines from the oldest, first is its number
+	Entries() (first int, entries []HistoryEntry)
+	Clear()
+}
+
+// HistoryEntry is a line of the history and when it was entered,
+// the zero time when it was read from a file without timestamps
+type HistoryEntry struct {
+	Line string
+	Time time.Time
+}
+
+// history [-c] [n]
+func (c *Command) history() int {
+	h := c.state.History
+	if h == nil {
+		return 0
+	}
+
+	args := c.Args
+	if len(args) > 0 && args[0] == "-c" {
+		h.Clear()
+		return 0
+	}
+	if len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		fmt.Fprintf(c.Stderr, "bash: history: %s: invalid option\n", args[0])
+		fmt.Fprintln(c.Stderr, "history: usage: history [-c] [n]")
+		return 2
+	}
+	if len(args) > 1 {
+		fmt.Fprintln(c.Stderr, "bash: history: too many arguments")
+		return 1
+	}
+
+	first, entries := h.Entries()
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			fmt.Fprintf(c.Stderr, "bash: history: %s: numeric argument required\n", args[0])
+			return 1
+		}
+		if n < len(entries) {
+			first += len(entries) - n
+			entries = entries[len(entries)-n:]
+		}
+	}
+
+	// with HISTTIMEFORMAT set every line is shown with its time
+	timeFormat, showTime := c.state.Vars.Get("HISTTIMEFORMAT")
+	for i, entry := range entries {
+		stamp := ""
+		if showTime && !entry.Time.IsZero() {
+			stamp = strftime(timeFormat, entry.Time)
+		}
+		fmt.Fprintf(c.Stdout, "%5d  %s%s\n", first+i, stamp, entry.Line)
+	}
+	return 0
+}
+
+// strftimeLayouts are the conversions of strftime(3) people put
+// in HISTTIMEFORMAT, as layouts of time.Format
+var strftimeLayouts = map[byte]string{
+	'a': "Mon", 'b': "Jan", 'd': "02", 'e': "_2", 'm': "01", 'y': "06", 'Y': "2006",
+	'H': "15", 'M': "04", 'S': "05", 'p': "PM",
+	'F': "2006-01-02", 'T': "15:04:05", 'D': "01/02/06", 'R': "15:04",
+}
+
+// strftime formats t with those conversions, %s and %%,
+// the other ones are kept as they are
+func strftime(format string, t time.Time) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			sb.WriteByte(format[i])
+			continue
+		}
+		i++
+		layout, found := strftimeLayouts[format[i]]
+		switch {
+		case found:
+			sb.WriteString(t.Format(layout))
+		case format[i] == 's':
+			sb.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case format[i] == '%':
+			sb.WriteByte('%')
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(format[i])
+		}
+	}
+	return sb.String()
+}
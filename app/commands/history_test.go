@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStrftime(t *testing.T) {
+	at := time.Date(2024, time.March, 5, 14, 7, 9, 0, time.UTC)
+	table := []struct {
+		format string
+		want   string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		{"%F %T ", "2024-03-05 14:07:09 "},
+		{"%d/%m/%y %H:%M", "05/03/24 14:07"},
+		{"%a %b %e %p", "Tue Mar  5 PM"},
+		{"%D %R", "03/05/24 14:07"},
+		{"%s", "1709647629"},
+		{"%Y%%", "2024%"},
+		{"%q %A and %", "%q %A and %"},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.format, func(t *testing.T) {
+			got := strftime(entry.format, at)
+			if got != entry.want {
+				t.Errorf("Wanted %q, Got %q", entry.want, got)
+			}
+		})
+	}
+}
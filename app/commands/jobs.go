@@ -0,0 +1,841 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// si_code values of SIGCHLD, missing from x/sys/unix
+const (
+	cldStopped   = 5
+	cldContinued = 6
+)
+
+// status of a job stopped from the terminal, 128+SIGTSTP
+const stoppedStatus = 128 + int(syscall.SIGTSTP)
+
+type JobState int
+
+const (
+	JobRunning JobState = iota
+	JobStopped
+	JobDone
+)
+
+// process is a program started by a job
+type process struct {
+	pid     int
+	stopped bool
+	exited  bool
+	// signal that killed the process, if any
+	signal syscall.Signal
+}
+
+// Job is a pipeline started by the shell, or an and-or list put in the
+// background, its programs share a process group so that the signals
+// sent from the terminal reach all of them at once
+type Job struct {
+	// ID is the job number, 0 until the job is added to the table
+	ID      int
+	Command string
+
+	table      *Jobs
+	pgid       int
+	background bool
+	procs      []*process
+	done       bool
+	status     int
+	signal     syscall.Signal
+	// pid of the last command of the first pipeline, expanded by $!
+	lastPid int
+	// last state the user was told about
+	reported JobState
+	// terminal modes of the job saved when it was stopped
+	tmodes *unix.Termios
+
+	// counts the commands of the running pipelines that are not started
+	// yet, an if or a loop in one of them starts more pipelines in the job
+	launching int
+	// closed once the first pipeline of the job started
+	started     chan struct{}
+	startedOnce sync.Once
+}
+
+// Jobs is the job table, jobs are added when they are put in
+// the background or stopped and removed once the user was told
+// they are done
+type Jobs struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	list []*Job
+	// ids of the jobs by how recently they were stopped or put in the
+	// background, the last is the current job and the one before the previous
+	recent []int
+
+	// interactive is true when the shell owns a terminal, only then
+	// jobs get their own process group and the terminal is handed over
+	interactive bool
+	ttyFd       int
+	pgid        int
+	// process group owning the terminal before the shell took it
+	origPgid int
+	// terminal modes of the shell, restored after every foreground job
+	tmodes *unix.Termios
+	// the signals the shell gets from the terminal
+	interrupts <-chan os.Signal
+}
+
+func newJobs() *Jobs {
+	t := &Jobs{}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// NewJobs creates the job table, when stdin is a terminal the shell
+// moves to its own process group and takes the terminal over
+func NewJobs() *Jobs {
+	t := newJobs()
+
+	fd := int(os.Stdin.Fd())
+	tmodes, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return t
+	}
+	origPgid, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil {
+		return t
+	}
+
+	pid := os.Getpid()
+	if unix.Getpgrp() != pid {
+		if err := unix.Setpgid(0, 0); err != nil {
+			return t
+		}
+	}
+	if err := setForeground(fd, pid); err != nil {
+		return t
+	}
+
+	t.interactive = true
+	t.ttyFd, t.pgid, t.origPgid, t.tmodes = fd, pid, origPgid, tmodes
+	return t
+}
+
+// Release gives the terminal back to whoever owned it before the shell
+func (t *Jobs) Release() {
+	if t.interactive {
+		setForeground(t.ttyFd, t.origPgid)
+	}
+}
+
+// handOver puts the shell back in the process group it was started in and
+// gives it the terminal, for exec to run a program in place of the shell,
+// takeBack takes them over again when that fails
+func (t *Jobs) handOver() (takeBack func()) {
+	if !t.interactive {
+		return func() {}
+	}
+	setForeground(t.ttyFd, t.origPgid)
+	unix.Setpgid(0, t.origPgid)
+	return func() {
+		unix.Setpgid(0, 0)
+		setForeground(t.ttyFd, t.pgid)
+	}
+}
+
+// setForeground makes pgid the foreground process group of the terminal,
+// SIGTTOU is blocked meanwhile otherwise the shell gets stopped when it
+// takes the terminal back from the background, it can't be ignored
+// instead because programs started by the shell would inherit that
+func setForeground(fd, pgid int) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var set, old unix.Sigset_t
+	bits := uint(unsafe.Sizeof(set.Val[0])) * 8
+	sig := uint(syscall.SIGTTOU) - 1
+	set.Val[sig/bits] |= 1 << (sig % bits)
+
+	if err := unix.PthreadSigmask(unix.SIG_BLOCK, &set, &old); err != nil {
+		return err
+	}
+	defer unix.PthreadSigmask(unix.SIG_SETMASK, &old, nil)
+
+	return unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, pgid)
+}
+
+// newJob creates a job that is not in the table yet
+func (t *Jobs) newJob(command string, background bool) *Job {
+	return &Job{
+		Command:    command,
+		table:      t,
+		background: background,
+		started:    make(chan struct{}),
+	}
+}
+
+// add puts the job in the table and makes it the current job,
+// the caller must hold t.mu
+func (t *Jobs) add(j *Job) {
+	if j.ID == 0 {
+		j.ID = 1
+		if len(t.list) > 0 {
+			j.ID = t.list[len(t.list)-1].ID + 1
+		}
+		t.list = append(t.list, j)
+	}
+	t.recent = slices.DeleteFunc(t.recent, func(id int) bool { return id == j.ID })
+	t.recent = append(t.recent, j.ID)
+}
+
+// remove takes the job out of the table, the caller must hold t.mu
+func (t *Jobs) remove(j *Job) {
+	t.list = slices.DeleteFunc(t.list, func(other *Job) bool { return other == j })
+	t.recent = slices.DeleteFunc(t.recent, func(id int) bool { return id == j.ID })
+}
+
+// mark is + for the current job, - for the previous one
+func (t *Jobs) mark(j *Job) byte {
+	switch n := len(t.recent); {
+	case n > 0 && t.recent[n-1] == j.ID:
+		return '+'
+	case n > 1 && t.recent[n-2] == j.ID:
+		return '-'
+	}
+	return ' '
+}
+
+// count returns the number of jobs in the table
+func (t *Jobs) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.list)
+}
+
+// commandNames returns the first word of the command of every job,
+// with "running" or "stopped" only of the jobs in that state
+func (t *Jobs) commandNames(which string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	names := []string{}
+	for _, j := range t.list {
+		state := j.state()
+		if (which == "running" && state != JobRunning) || (which == "stopped" && state != JobStopped) {
+			continue
+		}
+		if name, _, _ := strings.Cut(j.Command, " "); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// state is what the job is doing, it's stopped once every
+// process still alive is stopped, the caller must hold t.mu
+func (j *Job) state() JobState {
+	if j.done {
+		return JobDone
+	}
+	stopped := false
+	for _, p := range j.procs {
+		if p.exited {
+			continue
+		}
+		if !p.stopped {
+			return JobRunning
+		}
+		stopped = true
+	}
+	if stopped {
+		return JobStopped
+	}
+	return JobRunning
+}
+
+// pid is the process group of the job, or its first process when
+// the shell has no job control and every job shares its group
+func (j *Job) pid() int {
+	if j.pgid == 0 && len(j.procs) > 0 {
+		return j.procs[0].pid
+	}
+	return j.pgid
+}
+
+// describe is the state of the job the way jobs prints it
+func (j *Job) describe() string {
+	switch j.state() {
+	case JobRunning:
+		return "Running"
+	case JobStopped:
+		return "Stopped"
+	}
+	if j.signal != 0 {
+		desc := j.signal.String()
+		return strings.ToUpper(desc[:1]) + desc[1:]
+	}
+	if j.status != 0 {
+		return "Exit " + strconv.Itoa(j.status)
+	}
+	return "Done"
+}
+
+// format is the line jobs prints for j, the caller must hold t.mu
+func (t *Jobs) format(j *Job, long bool) string {
+	command := j.Command
+	if j.state() == JobRunning {
+		command += " &"
+	}
+	if long {
+		return fmt.Sprintf("[%d]%c %d %-24s%s", j.ID, t.mark(j), j.pid(), j.describe(), command)
+	}
+	return fmt.Sprintf("[%d]%c  %-24s%s", j.ID, t.mark(j), j.describe(), command)
+}
+
+// start starts program as part of the job, the first program
+// of the job leads its process group and the others join it
+func (t *Jobs) start(j *Job, program *exec.Cmd) (*process, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// the group is gone once all the programs of the job exited,
+	// like between the pipelines of an and-or list
+	if !slices.ContainsFunc(j.procs, func(p *process) bool { return !p.exited }) {
+		j.pgid = 0
+	}
+
+	if t.interactive {
+		program.SysProcAttr = &syscall.SysProcAttr{
+			Setpgid: true,
+			Pgid:    j.pgid,
+			// the child takes the terminal itself before running
+			// the program so it never reads it from the background
+			Foreground: !j.background,
+			Ctty:       t.ttyFd,
+		}
+	}
+
+	if err := program.Start(); err != nil {
+		return nil, err
+	}
+
+	proc := &process{pid: program.Process.Pid}
+	if t.interactive && j.pgid == 0 {
+		j.pgid = proc.pid
+	}
+	j.procs = append(j.procs, proc)
+	t.cond.Broadcast()
+	return proc, nil
+}
+
+// wait waits for a program of the job to exit, recording
+// when it gets stopped and continued on the way
+func (t *Jobs) wait(j *Job, proc *process, program *exec.Cmd) error {
+	for {
+		// WNOWAIT leaves the exit of the process to program.Wait
+		var info unix.Siginfo
+		err := unix.Waitid(unix.P_PID, proc.pid, &info, unix.WEXITED|unix.WSTOPPED|unix.WCONTINUED|unix.WNOWAIT, nil)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil || (info.Code != cldStopped && info.Code != cldContinued) {
+			break
+		}
+
+		// consume the event so it's only reported once
+		option := unix.WSTOPPED
+		if info.Code == cldContinued {
+			option = unix.WCONTINUED
+		}
+		unix.Waitid(unix.P_PID, proc.pid, &info, option|unix.WNOHANG, nil)
+
+		t.mu.Lock()
+		proc.stopped = option == unix.WSTOPPED
+		t.cond.Broadcast()
+		t.mu.Unlock()
+	}
+
+	// a zombie leader keeps the process group alive
+	// until every program of the pipeline joined it
+	t.waitLaunched(j)
+	err := program.Wait()
+
+	t.mu.Lock()
+	proc.exited = true
+	if status, ok := program.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		proc.signal = status.Signal()
+	}
+	t.cond.Broadcast()
+	t.mu.Unlock()
+	return err
+}
+
+// countLaunching counts n more commands of the job to start, or one
+// fewer when n is -1
+func (t *Jobs) countLaunching(j *Job, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	j.launching += n
+	t.cond.Broadcast()
+}
+
+// waitLaunched waits until no command of the job is left to start
+func (t *Jobs) waitLaunched(j *Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for j.launching > 0 {
+		t.cond.Wait()
+	}
+}
+
+// interrupted reports if a program of the job was ended with Ctrl-C
+func (j *Job) interrupted() bool {
+	j.table.mu.Lock()
+	defer j.table.mu.Unlock()
+	return slices.ContainsFunc(j.procs, func(p *process) bool { return p.signal == syscall.SIGINT })
+}
+
+// markStarted wakes up whoever waits for the job to start,
+// only the pid given the first time is kept
+func (j *Job) markStarted(lastPid int) {
+	j.startedOnce.Do(func() {
+		j.lastPid = lastPid
+		close(j.started)
+	})
+}
+
+// finish records the exit status of a job once all its commands ran
+func (t *Jobs) finish(j *Job, status int) {
+	j.markStarted(0)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	j.done, j.status = true, status
+	if n := len(j.procs); n > 0 {
+		if sig := j.procs[n-1].signal; sig != 0 && status == 128+int(sig) {
+			j.signal = sig
+		}
+	}
+	t.cond.Broadcast()
+}
+
+// continueJob sends SIGCONT to every process of a stopped job
+func (t *Jobs) continueJob(j *Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	j.reported = JobRunning
+	if j.pgid != 0 {
+		syscall.Kill(-j.pgid, syscall.SIGCONT)
+	} else {
+		for _, p := range j.procs {
+			if !p.exited {
+				syscall.Kill(p.pid, syscall.SIGCONT)
+			}
+		}
+	}
+	for _, p := range j.procs {
+		p.stopped = false
+	}
+}
+
+// foreground waits for the job until it's done or stopped and returns
+// its exit status, cont continues a job that was stopped or in the
+// background after giving it the terminal
+func (t *Jobs) foreground(j *Job, cont bool, stderr io.Writer) int {
+	if cont {
+		if t.interactive && j.pgid != 0 {
+			if j.tmodes != nil {
+				unix.IoctlSetTermios(t.ttyFd, unix.TCSETSW, j.tmodes)
+			}
+			setForeground(t.ttyFd, j.pgid)
+		}
+		t.continueJob(j)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for j.state() == JobRunning {
+		t.cond.Wait()
+	}
+	state := j.state()
+
+	if t.interactive && j.pgid != 0 {
+		if state == JobStopped {
+			j.tmodes, _ = unix.IoctlGetTermios(t.ttyFd, unix.TCGETS)
+		}
+		setForeground(t.ttyFd, t.pgid)
+		unix.IoctlSetTermios(t.ttyFd, unix.TCSETSW, t.tmodes)
+	}
+
+	if state == JobStopped {
+		t.add(j)
+		j.reported = JobStopped
+		fmt.Fprintf(stderr, "\n%s\n", t.format(j, false))
+		return stoppedStatus
+	}
+
+	// the terminal echoed ^C, the prompt goes on the next line
+	if j.signal == syscall.SIGINT {
+		fmt.Fprintln(stderr)
+	}
+	t.remove(j)
+	return j.status
+}
+
+// Notify tells about the jobs that finished or got stopped
+// since the last prompt and removes the finished ones
+func (t *Jobs) Notify(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, j := range slices.Clone(t.list) {
+		state := j.state()
+		if state == JobRunning || state == j.reported {
+			continue
+		}
+		fmt.Fprintln(w, t.format(j, false))
+		j.reported = state
+		if state == JobDone {
+			t.remove(j)
+		}
+	}
+}
+
+// find looks up a job by a job spec like %1, %+, %-, %name or %?name,
+// the % is optional and an empty spec is the current job, the caller
+// must hold t.mu
+func (t *Jobs) find(spec string) (*Job, error) {
+	spec = strings.TrimPrefix(spec, "%")
+	byID := func(id int) *Job {
+		for _, j := range t.list {
+			if j.ID == id {
+				return j
+			}
+		}
+		return nil
+	}
+
+	switch {
+	case spec == "" || spec == "+" || spec == "%":
+		if n := len(t.recent); n > 0 {
+			return byID(t.recent[n-1]), nil
+		}
+		return nil, errors.New("current: no such job")
+	case spec == "-":
+		if n := len(t.recent); n > 1 {
+			return byID(t.recent[n-2]), nil
+		}
+		return nil, errors.New("previous: no such job")
+	}
+
+	if id, err := strconv.Atoi(spec); err == nil {
+		if j := byID(id); j != nil {
+			return j, nil
+		}
+		return nil, fmt.Errorf("%%%s: no such job", spec)
+	}
+
+	var found *Job
+	for _, j := range t.list {
+		match := strings.HasPrefix(j.Command, spec)
+		if sub, ok := strings.CutPrefix(spec, "?"); ok {
+			match = strings.Contains(j.Command, sub)
+		}
+		if !match {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%s: ambiguous job spec", spec)
+		}
+		found = j
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	return found, nil
+}
+
+// jobs [-lp] [jobspec ...]
+func (c *Command) jobs() int {
+	args := c.Args
+	long, pids := false, false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 'l':
+				long = true
+			case 'p':
+				pids = true
+			default:
+				fmt.Fprintf(c.Stderr, "bash: jobs: -%c: invalid option\n", flag)
+				fmt.Fprintln(c.Stderr, "jobs: usage: jobs [-lp] [jobspec ...]")
+				return 2
+			}
+		}
+		args = args[1:]
+	}
+
+	t := c.state.Jobs
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	exitCode := 0
+	list := slices.Clone(t.list)
+	if len(args) > 0 {
+		list = nil
+		for _, spec := range args {
+			j, err := t.find(spec)
+			if err != nil {
+				fmt.Fprintf(c.Stderr, "bash: jobs: %s\n", err)
+				exitCode = 1
+				continue
+			}
+			list = append(list, j)
+		}
+	}
+
+	for _, j := range list {
+		if pids {
+			fmt.Fprintln(c.Stdout, j.pid())
+		} else {
+			fmt.Fprintln(c.Stdout, t.format(j, long))
+		}
+		j.reported = j.state()
+		if j.reported == JobDone {
+			t.remove(j)
+		}
+	}
+	return exitCode
+}
+
+// lookupJob finds the job of a job control builtin, printing why it can't
+func (c *Command) lookupJob(spec string) *Job {
+	t := c.state.Jobs
+	if !t.interactive {
+		fmt.Fprintf(c.Stderr, "bash: %s: no job control\n", c.Name)
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	j, err := t.find(spec)
+	if err != nil {
+		fmt.Fprintf(c.Stderr, "bash: %s: %s\n", c.Name, err)
+		return nil
+	}
+	if j.state() == JobDone {
+		fmt.Fprintf(c.Stderr, "bash: %s: job has terminated\n", c.Name)
+		t.remove(j)
+		return nil
+	}
+	return j
+}
+
+// fg [jobspec]
+func (c *Command) fg() int {
+	spec := ""
+	if len(c.Args) > 0 {
+		spec = c.Args[0]
+	}
+
+	j := c.lookupJob(spec)
+	if j == nil {
+		return 1
+	}
+
+	fmt.Fprintln(c.Stdout, j.Command)
+	j.background = false
+	return c.state.Jobs.foreground(j, true, c.Stderr)
+}
+
+// bg [jobspec ...]
+func (c *Command) bg() int {
+	specs := c.Args
+	if len(specs) == 0 {
+		specs = []string{""}
+	}
+
+	t := c.state.Jobs
+	exitCode := 0
+	for _, spec := range specs {
+		j := c.lookupJob(spec)
+		if j == nil {
+			exitCode = 1
+			continue
+		}
+
+		t.mu.Lock()
+		running := j.state() == JobRunning
+		t.mu.Unlock()
+		if running {
+			fmt.Fprintf(c.Stderr, "bash: bg: job %d already in background\n", j.ID)
+			continue
+		}
+
+		j.background = true
+		t.continueJob(j)
+
+		t.mu.Lock()
+		t.add(j)
+		fmt.Fprintf(c.Stdout, "[%d]%c %s &\n", j.ID, t.mark(j), j.Command)
+		t.mu.Unlock()
+	}
+	return exitCode
+}
+
+// wait [jobspec or pid ...] waits for every background job
+// without arguments, the status is the one of the last job
+func (c *Command) wait() int {
+	t := c.state.Jobs
+	interrupted, stop := t.watchInterrupts()
+	defer stop()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(c.Args) == 0 {
+		for _, j := range slices.Clone(t.list) {
+			for j.state() == JobRunning && !interrupted() {
+				t.cond.Wait()
+			}
+			if interrupted() {
+				return 128 + int(unix.SIGINT)
+			}
+			if j.state() == JobDone {
+				t.remove(j)
+			}
+		}
+		return 0
+	}
+
+	exitCode := 0
+	for _, arg := range c.Args {
+		j, err := c.waitTarget(arg)
+		if err != nil {
+			fmt.Fprintf(c.Stderr, "bash: wait: %s\n", err)
+			exitCode = 127
+			continue
+		}
+
+		for j.state() == JobRunning && !interrupted() {
+			t.cond.Wait()
+		}
+		if interrupted() {
+			return 128 + int(unix.SIGINT)
+		}
+		if j.state() == JobStopped {
+			exitCode = stoppedStatus
+			continue
+		}
+		exitCode = j.status
+		t.remove(j)
+	}
+	return exitCode
+}
+
+// SetInterrupts gives the table the channel the shell gets SIGINT
+// and SIGQUIT on, while no program has the terminal
+func (t *Jobs) SetInterrupts(interrupts <-chan os.Signal) {
+	t.interrupts = interrupts
+}
+
+// watchInterrupts lets a builtin waiting on the table give up on Ctrl-C,
+// a SIGINT wakes it up and interrupted reports it until stop is called
+func (t *Jobs) watchInterrupts() (interrupted func() bool, stop func()) {
+	// one from before the wait isn't for it
+	for drained := false; !drained; {
+		select {
+		case <-t.interrupts:
+		default:
+			drained = true
+		}
+	}
+
+	var got atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-t.interrupts:
+				if sig == os.Interrupt {
+					got.Store(true)
+					t.mu.Lock()
+					t.cond.Broadcast()
+					t.mu.Unlock()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return got.Load, func() { close(done) }
+}
+
+// waitTarget finds the job of a wait argument, either a job spec or the
+// pid of one of its processes, the caller must hold the table lock
+func (c *Command) waitTarget(arg string) (*Job, error) {
+	t := c.state.Jobs
+	if strings.HasPrefix(arg, "%") {
+		return t.find(arg)
+	}
+
+	pid, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("`%s': not a pid or valid job spec", arg)
+	}
+	for _, j := range t.list {
+		for _, p := range j.procs {
+			if p.pid == pid {
+				return j, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("pid %d is not a child of this shell", pid)
+}
+
+// disown [-a] [jobspec ...]
+func (c *Command) disown() int {
+	t := c.state.Jobs
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	args := c.Args
+	if len(args) > 0 && args[0] == "-a" {
+		for _, j := range slices.Clone(t.list) {
+			t.remove(j)
+		}
+		return 0
+	}
+	if len(args) == 0 {
+		args = []string{""}
+	}
+
+	exitCode := 0
+	for _, spec := range args {
+		j, err := t.find(spec)
+		if err != nil {
+			fmt.Fprintf(c.Stderr, "bash: disown: %s\n", err)
+			exitCode = 1
+			continue
+		}
+		t.remove(j)
+	}
+	return exitCode
+}
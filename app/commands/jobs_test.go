@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// testJobs is a job table with jobs that have no programs, their
+// state comes from the fields set on them
+func testJobs(commands ...string) (*Jobs, []*Job) {
+	t := newJobs()
+	jobs := []*Job{}
+	for _, command := range commands {
+		j := t.newJob(command, true)
+		j.procs = []*process{{pid: 1000 + len(jobs)}}
+		t.add(j)
+		jobs = append(jobs, j)
+	}
+	return t, jobs
+}
+
+func TestJobsFind(t *testing.T) {
+	table, jobs := testJobs("sleep 10", "vim notes.txt", "sleep 20")
+
+	found := []struct {
+		spec string
+		want *Job
+	}{
+		{"%1", jobs[0]},
+		{"2", jobs[1]},
+		{"", jobs[2]},
+		{"%+", jobs[2]},
+		{"%%", jobs[2]},
+		{"%-", jobs[1]},
+		{"%vim", jobs[1]},
+		{"%?notes", jobs[1]},
+		{"%?20", jobs[2]},
+	}
+	for _, entry := range found {
+		t.Run(entry.spec, func(t *testing.T) {
+			got, err := table.find(entry.spec)
+			if err != nil {
+				t.Fatalf("Didn't expect an error but got %v", err)
+			}
+			if got != entry.want {
+				t.Errorf("Wanted job %d, Got job %d", entry.want.ID, got.ID)
+			}
+		})
+	}
+
+	failed := []struct {
+		spec string
+		want string
+	}{
+		{"%4", "%4: no such job"},
+		{"%sleep", "sleep: ambiguous job spec"},
+		{"%?zzz", "?zzz: no such job"},
+		{"%emacs", "emacs: no such job"},
+	}
+	for _, entry := range failed {
+		t.Run(entry.spec, func(t *testing.T) {
+			_, err := table.find(entry.spec)
+			if err == nil || err.Error() != entry.want {
+				t.Errorf("Wanted %q, Got %v", entry.want, err)
+			}
+		})
+	}
+
+	t.Run("the current job moves to the one added last", func(t *testing.T) {
+		table.add(jobs[0])
+		current, _ := table.find("%+")
+		previous, _ := table.find("%-")
+		if current != jobs[0] || previous != jobs[2] {
+			t.Errorf("Wanted jobs 1 and 3, Got %d and %d", current.ID, previous.ID)
+		}
+	})
+
+	t.Run("without jobs there is no current or previous one", func(t *testing.T) {
+		empty, _ := testJobs()
+		if _, err := empty.find("%+"); err == nil || err.Error() != "current: no such job" {
+			t.Errorf("Wanted no current job, Got %v", err)
+		}
+		single, _ := testJobs("ls")
+		if _, err := single.find("%-"); err == nil || err.Error() != "previous: no such job" {
+			t.Errorf("Wanted no previous job, Got %v", err)
+		}
+	})
+}
+
+func TestJobsNotify(t *testing.T) {
+	table, jobs := testJobs("sleep 10", "false", "vim", "yes", "true")
+	jobs[1].done, jobs[1].status = true, 1
+	jobs[2].procs[0].stopped = true
+	jobs[3].done, jobs[3].status, jobs[3].signal = true, 128+int(syscall.SIGTERM), syscall.SIGTERM
+	jobs[4].done = true
+
+	var out strings.Builder
+	table.Notify(&out)
+	want := "[2]   Exit 1                  false\n" +
+		"[3]   Stopped                 vim\n" +
+		"[4]-  Terminated              yes\n" +
+		"[5]+  Done                    true\n"
+	if out.String() != want {
+		t.Errorf("Wanted %q, Got %q", want, out.String())
+	}
+	if table.count() != 2 {
+		t.Errorf("Wanted the running and the stopped job left, Got %d jobs", table.count())
+	}
+
+	// what was told isn't told again
+	out.Reset()
+	table.Notify(&out)
+	if out.String() != "" {
+		t.Errorf("Wanted nothing, Got %q", out.String())
+	}
+}
+
+func TestWaitAndDisown(t *testing.T) {
+	newState := func() (*State, []*Job) {
+		state := NewState()
+		table, jobs := testJobs("false", "vim", "sleep 1", "true")
+		jobs[0].done, jobs[0].status = true, 1
+		jobs[1].procs[0].stopped = true
+		jobs[3].done = true
+		state.Jobs = table
+		return state, jobs
+	}
+
+	table := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantErr  string
+		left     int
+	}{
+		{"wait for a job", []string{"wait", "%1"}, 1, "", 3},
+		{"wait by pid", []string{"wait", "1003"}, 0, "", 3},
+		{"wait for the last", []string{"wait", "%4", "%1"}, 1, "", 2},
+		{"wait for a stopped job", []string{"wait", "%2"}, 148, "", 4},
+		{"wait for an unknown job", []string{"wait", "%9"}, 127, "bash: wait: %9: no such job\n", 4},
+		{"wait for an unknown pid", []string{"wait", "1"}, 127, "bash: wait: pid 1 is not a child of this shell\n", 4},
+		{"wait for a bad argument", []string{"wait", "x"}, 127, "bash: wait: `x': not a pid or valid job spec\n", 4},
+		{"disown the current job", []string{"disown"}, 0, "", 3},
+		{"disown jobs", []string{"disown", "%1", "%vim"}, 0, "", 2},
+		{"disown an unknown job", []string{"disown", "%9", "%1"}, 1, "bash: disown: %9: no such job\n", 3},
+		{"disown all", []string{"disown", "-a"}, 0, "", 0},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			state, _ := newState()
+			cmd, _, stderr := testCommand(state, entry.args[0], entry.args[1:]...)
+			_, code := cmd.Execute()
+			if code != entry.wantCode {
+				t.Errorf("Wanted status %d, Got %d", entry.wantCode, code)
+			}
+			if stderr.String() != entry.wantErr {
+				t.Errorf("Wanted %q, Got %q", entry.wantErr, stderr.String())
+			}
+			if left := state.Jobs.count(); left != entry.left {
+				t.Errorf("Wanted %d jobs left, Got %d", entry.left, left)
+			}
+		})
+	}
+}
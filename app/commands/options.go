@@ -0,0 +1,234 @@
+package commands
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/codecrafters-io/shell-starter-go/app/shellparser"
+)
+
+// Options are the shell options changed with shopt and set -o
+type Options struct {
+	mu    sync.RWMutex
+	flags map[string]bool
+	// the options of set -o
+	setFlags map[string]bool
+}
+
+// shoptNames are every option shopt knows, all off by default
+var shoptNames = []string{"dotglob", "failglob", "globstar", "nullglob"}
+
+func NewOptions() *Options {
+	o := &Options{
+		flags:    map[string]bool{},
+		setFlags: map[string]bool{"emacs": true, "noclobber": false, "vi": false, "xtrace": false},
+	}
+	for _, name := range shoptNames {
+		o.flags[name] = false
+	}
+	return o
+}
+
+// clone copies the options for a subshell
+func (o *Options) clone() *Options {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return &Options{flags: maps.Clone(o.flags), setFlags: maps.Clone(o.setFlags)}
+}
+
+// Get returns the value of an option and if it exists
+func (o *Options) Get(name string) (bool, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	on, found := o.flags[name]
+	return on, found
+}
+
+func (o *Options) Set(name string, on bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, found := o.flags[name]; !found {
+		return fmt.Errorf("bash: shopt: %s: invalid shell option name", name)
+	}
+	o.flags[name] = on
+	return nil
+}
+
+func (o *Options) names() []string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return slices.Sorted(maps.Keys(o.flags))
+}
+
+// Flag returns if the option name of set -o is on
+func (o *Options) Flag(name string) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.setFlags[name]
+}
+
+// SetFlag turns an option of set -o on or off, emacs and vi are
+// the editing modes so turning one on turns the other off
+func (o *Options) SetFlag(name string, on bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, found := o.setFlags[name]; !found {
+		return fmt.Errorf("bash: set: %s: invalid option name", name)
+	}
+	o.setFlags[name] = on
+	switch {
+	case name == "vi" && on:
+		o.setFlags["emacs"] = false
+	case name == "emacs" && on:
+		o.setFlags["vi"] = false
+	}
+	return nil
+}
+
+func (o *Options) flagNames() []string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return slices.Sorted(maps.Keys(o.setFlags))
+}
+
+// globOptions returns the options used by pathname expansion
+func (o *Options) globOptions() shellparser.GlobOptions {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return shellparser.GlobOptions{
+		NullGlob: o.flags["nullglob"],
+		FailGlob: o.flags["failglob"],
+		DotGlob:  o.flags["dotglob"],
+		GlobStar: o.flags["globstar"],
+	}
+}
+
+// set [-Cx] [-o option-name] [+Cx] [+o option-name], without
+// arguments every shell variable is listed
+func (c *Command) set() int {
+	args := c.Args
+	if len(args) == 0 {
+		for _, name := range c.state.Vars.names(func(vr *variable) bool { return true }) {
+			value, _ := c.state.Vars.Get(name)
+			fmt.Fprintf(c.Stdout, "%s=%s\n", name, quoteValue(value))
+		}
+		return 0
+	}
+
+	opts := c.state.Options
+	exitCode := 0
+	for len(args) > 0 {
+		arg := args[0]
+		args = args[1:]
+		switch arg {
+		case "-o", "+o":
+			if len(args) == 0 {
+				c.printFlags(arg == "+o")
+				continue
+			}
+			if err := opts.SetFlag(args[0], arg == "-o"); err != nil {
+				fmt.Fprintln(c.Stderr, err)
+				exitCode = 1
+			}
+			args = args[1:]
+		case "-x", "+x":
+			opts.SetFlag("xtrace", arg == "-x")
+		case "-C", "+C":
+			opts.SetFlag("noclobber", arg == "-C")
+		case "--":
+			args = nil
+		default:
+			fmt.Fprintf(c.Stderr, "bash: set: %s: invalid option\n", arg)
+			fmt.Fprintln(c.Stderr, "set: usage: set [-Cx] [-o option-name] [+Cx] [+o option-name]")
+			return 2
+		}
+	}
+	return exitCode
+}
+
+// printFlags lists the options of set -o, as set commands with asCommands
+func (c *Command) printFlags(asCommands bool) {
+	opts := c.state.Options
+	for _, name := range opts.flagNames() {
+		on := opts.Flag(name)
+		switch {
+		case asCommands && on:
+			fmt.Fprintf(c.Stdout, "set -o %s\n", name)
+		case asCommands:
+			fmt.Fprintf(c.Stdout, "set +o %s\n", name)
+		case on:
+			fmt.Fprintf(c.Stdout, "%-15s\ton\n", name)
+		default:
+			fmt.Fprintf(c.Stdout, "%-15s\toff\n", name)
+		}
+	}
+}
+
+// shopt [-s|-u] [-q] [optname ...]
+func (c *Command) shopt() int {
+	args := c.Args
+	set, unset, quiet := false, false, false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 's':
+				set = true
+			case 'u':
+				unset = true
+			case 'q':
+				quiet = true
+			default:
+				fmt.Fprintf(c.Stderr, "bash: shopt: -%c: invalid option\n", flag)
+				fmt.Fprintln(c.Stderr, "shopt: usage: shopt [-squ] [optname ...]")
+				return 2
+			}
+		}
+		args = args[1:]
+	}
+
+	if set && unset {
+		fmt.Fprintln(c.Stderr, "bash: shopt: cannot set and unset shell options simultaneously")
+		return 1
+	}
+
+	opts := c.state.Options
+	if set || unset {
+		exitCode := 0
+		for _, name := range args {
+			if err := opts.Set(name, set); err != nil {
+				fmt.Fprintln(c.Stderr, err)
+				exitCode = 1
+			}
+		}
+		return exitCode
+	}
+
+	names := args
+	if len(names) == 0 {
+		names = opts.names()
+	}
+
+	exitCode := 0
+	for _, name := range names {
+		on, found := opts.Get(name)
+		if !found {
+			fmt.Fprintf(c.Stderr, "bash: shopt: %s: invalid shell option name\n", name)
+			exitCode = 1
+			continue
+		}
+		if !on && len(args) > 0 {
+			exitCode = 1
+		}
+		if quiet {
+			continue
+		}
+		state := "off"
+		if on {
+			state = "on"
+		}
+		fmt.Fprintf(c.Stdout, "%-15s\t%s\n", name, state)
+	}
+	return exitCode
+}
@@ -0,0 +1,146 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/shell-starter-go/app/shellparser"
+)
+
+// the prompts the shell starts with, PS1 before every line, PS2 before
+// the lines continuing a command and PS4 before the commands traced by set -x
+var promptDefaults = map[string]string{"PS1": "$ ", "PS2": "> ", "PS4": "+ "}
+
+// Prompt returns the prompt in the variable name with its backslash
+// escapes replaced and then expanded like a double quoted word, the
+// text between \[ and \] is put between \x01 and \x02 like readline
+// does so the line editor knows it takes no room on the screen
+func (s *State) Prompt(name string) string {
+	ps, _ := s.Vars.Get(name)
+	decoded := s.decodePrompt(ps)
+
+	word, err := shellparser.ParseQuoted(decoded)
+	if err != nil {
+		return decoded
+	}
+	expanded, err := shellparser.ExpandWord(word, s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return decoded
+	}
+	return expanded
+}
+
+// decodePrompt replaces the backslash escapes of a prompt, what they
+// are replaced with is quoted so it isn't expanded afterwards
+func (s *State) decodePrompt(ps string) string {
+	var sb strings.Builder
+	for i := 0; i < len(ps); i++ {
+		switch {
+		case ps[i] == '"':
+			sb.WriteString(`\"`)
+			continue
+		case ps[i] != '\\' || i+1 == len(ps):
+			sb.WriteByte(ps[i])
+			continue
+		}
+		i++
+		switch ps[i] {
+		case 'u':
+			sb.WriteString(quotePrompt(userName()))
+		case 'h', 'H':
+			host, _ := os.Hostname()
+			if ps[i] == 'h' {
+				host, _, _ = strings.Cut(host, ".")
+			}
+			sb.WriteString(quotePrompt(host))
+		case 'w', 'W':
+			sb.WriteString(quotePrompt(s.promptDir(ps[i] == 'W')))
+		case '$':
+			if os.Geteuid() == 0 {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteString(`\$`)
+			}
+		case 't':
+			sb.WriteString(time.Now().Format("15:04:05"))
+		case 'j':
+			sb.WriteString(strconv.Itoa(s.Jobs.count()))
+		case '?':
+			sb.WriteString(strconv.Itoa(s.LastStatus))
+		case 's':
+			sb.WriteString("bash")
+		case 'n':
+			sb.WriteByte('\n')
+		case 'e':
+			sb.WriteByte('\x1b')
+		case 'a':
+			sb.WriteByte('\a')
+		case '[':
+			sb.WriteByte('\x01')
+		case ']':
+			sb.WriteByte('\x02')
+		case '\\':
+			sb.WriteString(`\\`)
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(ps[i])
+		}
+	}
+	return sb.String()
+}
+
+// promptDir is the working directory with HOME replaced by ~,
+// only its last element with base
+func (s *State) promptDir(base bool) string {
+	dir, _ := s.getwd()
+	home, _ := s.Vars.Get("HOME")
+	switch {
+	case home != "" && home != "/" && dir == home:
+		return "~"
+	case base && dir != "/":
+		return filepath.Base(dir)
+	case home != "" && home != "/" && strings.HasPrefix(dir, home+"/"):
+		return "~" + dir[len(home):]
+	}
+	return dir
+}
+
+func userName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// quotePrompt escapes what double quotes would expand
+func quotePrompt(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `$`, `\$`, "`", "\\`", `"`, `\"`).Replace(s)
+}
+
+// PromptCommand runs the commands of PROMPT_COMMAND before the
+// prompt, $? is still the status of the line before after them,
+// isExit is true when they run exit
+func (s *State) PromptCommand() (isExit bool, exitCode int) {
+	command, _ := s.Vars.Get("PROMPT_COMMAND")
+	if strings.TrimSpace(command) == "" {
+		return false, 0
+	}
+	list, err := shellparser.NewParser().Parse([]byte(command))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false, 0
+	}
+
+	status := s.LastStatus
+	isExit, exitCode, _ = StartCommands(s, list)
+	if !isExit {
+		s.LastStatus = status
+	}
+	return isExit, exitCode
+}
@@ -2,59 +2,157 @@ package commands
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"strconv"
+
+	"github.com/codecrafters-io/shell-starter-go/app/shellparser"
 )
 
-var ErrUnexpectedTokenRedirect = errors.New("bash: syntax error near unexpected token `newline'")
-
-func Redirect(input []string) (args []string, stdin *os.File, stdout *os.File, stderr *os.File, err error) {
-
-	for i := range input {
-		token := input[i]
-		remaining := input[i+1:]
-
-		if isRedirectOperator(token) {
-			switch token {
-			case "1>":
-				stdout, err = prepareOutput(remaining, false)
-			case "2>":
-				stderr, err = prepareOutput(remaining, false)
-			case "1>>":
-				stdout, err = prepareOutput(remaining, true)
-			case "2>>":
-				stderr, err = prepareOutput(remaining, true)
-			case "0<":
-				stdin, err = prepareInput(remaining)
-			}
+// Fds are the open file descriptors of a command, each one is an
+// io.Reader, an io.Writer or both, the ones missing are closed
+type Fds map[int]any
+
+// Redirect applies the redirections to fds from left to right, so 2>&1
+// copies what 1 is at that point, the files it opened are returned
+// to be closed once the command is done
+func Redirect(state *State, redirects []*shellparser.Redirect, fds Fds) (opened []*os.File, err error) {
+	for _, r := range redirects {
+		var file *os.File
+		file, err = redirect(state, r, fds)
+		if err != nil {
 			break
-		} else {
-			args = append(args, token)
+		}
+		if file != nil {
+			opened = append(opened, file)
 		}
 	}
 
 	if err != nil {
-		return nil, nil, nil, nil, err
+		for _, file := range opened {
+			file.Close()
+		}
+		return nil, err
 	}
+	return opened, nil
+}
 
-	return args, stdin, stdout, stderr, nil
+// redirect applies one redirection to fds and returns the file it opened
+func redirect(state *State, r *shellparser.Redirect, fds Fds) (*os.File, error) {
+	var file *os.File
+	var err error
+	switch r.Op {
+	case shellparser.RedirectHeredoc, shellparser.RedirectHeredocStrip:
+		var body string
+		body, err = shellparser.ExpandWord(r.Heredoc, state)
+		if err == nil {
+			file, err = prepareHeredoc(body)
+		}
+	case shellparser.RedirectHereString:
+		var text string
+		text, err = shellparser.ExpandWord(r.Target, state)
+		if err == nil {
+			file, err = prepareHeredoc(text + "\n")
+		}
+	case shellparser.RedirectDupInput, shellparser.RedirectDupOutput:
+		return duplicate(state, r, fds)
+	default:
+		var path string
+		path, err = expandTarget(state, r.Target)
+		if err == nil {
+			file, err = openTarget(state, r.Op, path)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fds[r.Fd] = file
+	if r.Op == shellparser.RedirectAll || r.Op == shellparser.RedirectAppendAll {
+		fds[2] = file
+	}
+	return file, nil
 }
 
-func isRedirectOperator(token string) bool {
-	if token == "1>" || token == "2>" || token == "1>>" || token == "2>>" || token == "0<" {
-		return true
+// duplicate makes Fd a copy of the descriptor of the target of <& or >&,
+// or closes it for -, >&file is the old way to write &>file
+func duplicate(state *State, r *shellparser.Redirect, fds Fds) (*os.File, error) {
+	target, err := expandTarget(state, r.Target)
+	if err != nil {
+		return nil, err
+	}
+	if target == "-" {
+		delete(fds, r.Fd)
+		return nil, nil
 	}
-	return false
+
+	from, err := strconv.Atoi(target)
+	switch {
+	case err == nil && from >= 0:
+		stream, open := fds[from]
+		if !open {
+			return nil, fmt.Errorf("bash: %d: Bad file descriptor", from)
+		}
+		fds[r.Fd] = stream
+		return nil, nil
+	case r.Op == shellparser.RedirectDupOutput && r.Fd == 1:
+		file, err := openTarget(state, shellparser.RedirectAll, target)
+		if err != nil {
+			return nil, err
+		}
+		fds[1], fds[2] = file, file
+		return file, nil
+	}
+	return nil, fmt.Errorf("bash: %s: ambiguous redirect", r.Target)
 }
 
-func prepareOutput(path []string, append bool) (*os.File, error) {
-	if len(path) == 0 || path[0] == "\n" {
-		return nil, ErrUnexpectedTokenRedirect
+// openTarget opens the file of a redirection to a file,
+// noclobber is ignored by >| and the appending ones
+func openTarget(state *State, op shellparser.RedirectOp, path string) (*os.File, error) {
+	resolved := state.resolve(path)
+	noclobber := state.Options.Flag("noclobber")
+
+	var file *os.File
+	var err error
+	switch op {
+	case shellparser.RedirectOutput, shellparser.RedirectAll:
+		file, err = prepareOutput(resolved, false, noclobber)
+	case shellparser.RedirectClobber:
+		file, err = prepareOutput(resolved, false, false)
+	case shellparser.RedirectAppend, shellparser.RedirectAppendAll:
+		file, err = prepareOutput(resolved, true, false)
+	case shellparser.RedirectReadWrite:
+		file, err = prepareReadWrite(resolved)
+	default:
+		file, err = prepareInput(resolved)
 	}
 
-	filepathStr := strings.Join(path, "")
+	// errors of the system are told with the name as it was written
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return nil, fmt.Errorf("bash: %s: %s", path, errnoText(pathErr.Err))
+	}
+	return file, err
+}
+
+// expandTarget expands the file name of a redirection,
+// it has to be exactly one field after splitting
+func expandTarget(state *State, target *shellparser.Word) (string, error) {
+	fields, err := shellparser.ExpandWords([]*shellparser.Word{target}, state)
+	if err != nil {
+		return "", err
+	}
+	if len(fields) != 1 {
+		return "", fmt.Errorf("bash: %s: ambiguous redirect", target)
+	}
+	return fields[0], nil
+}
 
+// prepareOutput opens a file to write to, with noclobber
+// an existing regular file is never truncated
+func prepareOutput(filepathStr string, append bool, noclobber bool) (*os.File, error) {
 	dirStr := filepath.Dir(filepathStr)
 
 	if err := os.MkdirAll(dirStr, 0777); err != nil {
@@ -68,6 +166,18 @@ func prepareOutput(path []string, append bool) (*os.File, error) {
 		flags |= os.O_TRUNC
 	}
 
+	if noclobber {
+		info, err := os.Stat(filepathStr)
+		switch {
+		case err != nil:
+			// nobody creates it in the meantime either
+			flags |= os.O_EXCL
+		case info.Mode().IsRegular():
+			// told with the name as it was written like the errors of the system
+			return nil, &os.PathError{Op: "open", Path: filepathStr, Err: errors.New("cannot overwrite existing file")}
+		}
+	}
+
 	file, err := os.OpenFile(filepathStr, flags, 0666)
 
 	if err != nil {
@@ -77,16 +187,35 @@ func prepareOutput(path []string, append bool) (*os.File, error) {
 	return file, nil
 }
 
-func prepareInput(path []string) (*os.File, error) {
-	if len(path) == 0 || path[0] == "\n" {
-		return nil, ErrUnexpectedTokenRedirect
+func prepareInput(filepathStr string) (*os.File, error) {
+	file, err := os.Open(filepathStr)
+	if err != nil {
+		return nil, err
 	}
 
-	filepathStr := strings.Join(path, "")
-	file, err := os.Open(filepathStr)
+	return file, nil
+}
+
+// prepareReadWrite opens a file for <>, creating it when it's missing
+func prepareReadWrite(filepathStr string) (*os.File, error) {
+	return os.OpenFile(filepathStr, os.O_RDWR|os.O_CREATE, 0666)
+}
+
+// prepareHeredoc puts the text of a here-document in a temporary file
+// the command reads from the start, the file is gone once it's closed
+func prepareHeredoc(text string) (*os.File, error) {
+	file, err := os.CreateTemp("", "sh-heredoc-")
 	if err != nil {
 		return nil, err
 	}
+	os.Remove(file.Name())
 
+	if _, err = file.WriteString(text); err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
 	return file, nil
 }
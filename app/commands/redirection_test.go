@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/shell-starter-go/app/shellparser"
+)
+
+// runLines runs each line in state in turn with its output in the returned buffers
+func runLines(t *testing.T, state *State, lines ...string) (stdout, stderr *strings.Builder) {
+	stdout, stderr = &strings.Builder{}, &strings.Builder{}
+	state.fds = Fds{0: strings.NewReader(""), 1: stdout, 2: stderr}
+	for _, line := range lines {
+		list, err := shellparser.NewParser().Parse([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		StartCommands(state, list)
+	}
+	return stdout, stderr
+}
+
+func TestRedirections(t *testing.T) {
+	table := []struct {
+		name       string
+		lines      []string
+		wantOut    string
+		wantErr    string
+		wantStatus int
+	}{
+		{"exec keeps a descriptor", []string{"exec 3>f", "echo x >&3", "echo y >&3", "cat f"}, "x\ny\n", "", 0},
+		{"exec closes a descriptor", []string{"exec 3>f", "exec 3>&-", "echo x >&3"}, "", "bash: 3: Bad file descriptor\n", 1},
+		{"closed descriptor", []string{"echo x 1>&-"}, "", "bash: echo: write error: Bad file descriptor\n", 1},
+		{"read and write", []string{"echo abc >f", "exec 4<>f", "cat <&4"}, "abc\n", "", 0},
+		{"both outputs", []string{"sh -c 'echo out; echo err >&2' &>f", "cat f"}, "out\nerr\n", "", 0},
+		{"appending both outputs", []string{"echo a >f", "sh -c 'echo err >&2' &>>f", "cat f"}, "a\nerr\n", "", 0},
+		{"duplicate before the file", []string{"sh -c 'echo err >&2' 2>&1 >f", "cat f"}, "err\n", "", 0},
+		{"duplicate after the file", []string{"sh -c 'echo err >&2' >f 2>&1", "cat f"}, "err\n", "", 0},
+		{"noclobber", []string{"echo a >f", "set -C", "echo b >f", "cat f"}, "a\n", "bash: f: cannot overwrite existing file\n", 0},
+		{"noclobber overridden", []string{"echo a >f", "set -C", "echo b >|f", "cat f"}, "b\n", "", 0},
+		{"noclobber appends", []string{"echo a >f", "set -C", "echo b >>f", "cat f"}, "a\nb\n", "", 0},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			state := NewState()
+			state.dir = t.TempDir()
+			stdout, stderr := runLines(t, state, entry.lines...)
+			if stdout.String() != entry.wantOut {
+				t.Errorf("Wanted %q, Got %q", entry.wantOut, stdout.String())
+			}
+			if stderr.String() != entry.wantErr {
+				t.Errorf("Wanted %q, Got %q", entry.wantErr, stderr.String())
+			}
+			if state.LastStatus != entry.wantStatus {
+				t.Errorf("Wanted status %d, Got %d", entry.wantStatus, state.LastStatus)
+			}
+		})
+	}
+}
+
+func TestExec(t *testing.T) {
+	table := []struct {
+		name    string
+		lines   []string
+		wantOut string
+		wantErr string
+	}{
+		{"replaces a subshell", []string{"echo $(exec echo a; echo b)"}, "a\n", ""},
+		{"runs programs only", []string{"echo $(exec pwd -P)"}, "/\n", ""},
+		{"not found", []string{"exec nosuchprogram", "echo on"}, "on\n", "bash: exec: nosuchprogram: not found\n"},
+		{"not found in a subshell", []string{"echo $(exec nosuchprogram; echo b)"}, "\n", "bash: exec: nosuchprogram: not found\n"},
+		{"argv0", []string{"echo $(exec -a name sh -c 'echo $0')"}, "name\n", ""},
+		{"clean environment", []string{"echo $(A=1 exec -c env)"}, "\n", ""},
+		{"invalid option", []string{"exec -x true"}, "", "bash: exec: -x: invalid option\n" + execUsage + "\n"},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			state := NewState()
+			state.dir = "/"
+			stdout, stderr := runLines(t, state, entry.lines...)
+			if stdout.String() != entry.wantOut {
+				t.Errorf("Wanted %q, Got %q", entry.wantOut, stdout.String())
+			}
+			if stderr.String() != entry.wantErr {
+				t.Errorf("Wanted %q, Got %q", entry.wantErr, stderr.String())
+			}
+		})
+	}
+
+	t.Run("the descriptors of a pipeline stage close with it", func(t *testing.T) {
+		state := NewState()
+		state.dir = t.TempDir()
+		stdout, _ := runLines(t, state, "exec 3>f | cat", "echo x >&3")
+		if stdout.String() != "" {
+			t.Errorf("Wanted no output, Got %q", stdout.String())
+		}
+		if _, err := os.Stat(filepath.Join(state.dir, "f")); err != nil {
+			t.Errorf("Wanted the file created, Got %v", err)
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/codecrafters-io/shell-starter-go/app/shellparser"
+)
+
+// State is what the shell remembers between commands
+type State struct {
+	// exit status of the last pipeline, expanded by $?
+	LastStatus int
+
+	Vars        *Variables
+	Options     *Options
+	Jobs        *Jobs
+	History     History
+	Bindings    KeyBindings
+	Completions *Completions
+	Hash        *CommandHash
+
+	// job the commands are part of in a background subshell
+	job *Job
+	// pid of the last background job, expanded by $!
+	lastBackground int
+	// working directory of a background subshell, which
+	// can't change the one of the shell process, empty otherwise
+	dir string
+	// the descriptors commands start with, exec without a command
+	// changes them for good and owns the files it opened
+	fds   Fds
+	owned []io.Closer
+	// a subshell, exec ends it instead of replacing the shell
+	child bool
+
+	// status of the last command substitution of the command being
+	// expanded, used as the status of commands that only assign
+	substStatus int
+	substituted bool
+}
+
+func NewState() *State {
+	s := &State{
+		Vars:        NewVariables(),
+		Options:     NewOptions(),
+		Jobs:        NewJobs(),
+		Completions: NewCompletions(),
+		Hash:        NewCommandHash(),
+		fds:         Fds{0: os.Stdin, 1: os.Stdout, 2: os.Stderr},
+	}
+	for name, value := range promptDefaults {
+		if _, found := s.Vars.Get(name); !found {
+			s.Vars.Set(name, value)
+		}
+	}
+	return s
+}
+
+// Get looks up a parameter for expansion, the shell has no
+// positional parameters so $1 to $9, $@ and $* are never set
+func (s *State) Get(name string) (string, bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(s.LastStatus), true
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "#":
+		return "0", true
+	case "0":
+		return os.Args[0], true
+	case "!":
+		if s.lastBackground == 0 {
+			return "", false
+		}
+		return strconv.Itoa(s.lastBackground), true
+	case "@", "*", "-":
+		return "", false
+	}
+	return s.Vars.Get(name)
+}
+
+// Substitute runs a command substitution in a subshell
+// and returns everything it wrote to stdout
+func (s *State) Substitute(list *shellparser.List) (string, error) {
+	return s.substitute(list, nil)
+}
+
+// substitute runs a command substitution with the NAME=value
+// pairs of assigns set in its subshell
+func (s *State) substitute(list *shellparser.List, assigns []string) (string, error) {
+	// like a subshell, cd inside the substitution stays inside
+	// without moving the process other commands run in meanwhile
+	sub := s.stage()
+	for _, assign := range assigns {
+		name, value, _ := strings.Cut(assign, "=")
+		sub.Vars.Set(name, value)
+	}
+
+	var out bytes.Buffer
+	sub.fds[1] = &out
+	_, exitCode, _ := startList(sub, list)
+
+	s.substStatus, s.substituted = exitCode, true
+	return out.String(), nil
+}
+
+// subshell copies the state for commands that must not change the
+// shell, they have no job control and their own job table
+func (s *State) subshell() *State {
+	return &State{
+		LastStatus:     s.LastStatus,
+		Vars:           s.Vars.clone(),
+		Options:        s.Options.clone(),
+		Jobs:           newJobs(),
+		History:        s.History,
+		Bindings:       s.Bindings,
+		Completions:    s.Completions.clone(),
+		Hash:           s.Hash,
+		lastBackground: s.lastBackground,
+		dir:            s.dir,
+		fds:            maps.Clone(s.fds),
+		child:          true,
+	}
+}
+
+// stage is the state of a command of a pipeline of several or of a
+// command substitution, a subshell in the working directory of the shell
+func (s *State) stage() *State {
+	sub := s.subshell()
+	if cwd, err := s.getwd(); err == nil {
+		sub.dir = cwd
+	}
+	return sub
+}
+
+// resolve makes a relative path relative to the
+// working directory of a background subshell
+func (s *State) resolve(path string) string {
+	if s.dir == "" || path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(s.dir, path)
+}
+
+func (s *State) getwd() (string, error) {
+	if s.dir != "" {
+		return s.dir, nil
+	}
+	return os.Getwd()
+}
+
+// chdir changes the working directory of the shell, in a
+// background subshell only its own directory changes
+func (s *State) chdir(dir string) error {
+	if s.dir == "" {
+		return os.Chdir(dir)
+	}
+
+	dir = s.resolve(dir)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return syscall.ENOTDIR
+	}
+	s.dir = filepath.Clean(dir)
+	return nil
+}
+
+// stderr is where the shell tells about the errors of commands
+func (s *State) stderr() io.Writer {
+	if w, ok := s.fds[2].(io.Writer); ok {
+		return w
+	}
+	return io.Discard
+}
+
+// setFds makes fds the descriptors of the commands after it, the files
+// of opened are kept open until no descriptor refers to them anymore
+func (s *State) setFds(fds Fds, opened []io.Closer) {
+	s.fds = fds
+	s.owned = slices.DeleteFunc(append(s.owned, opened...), func(closer io.Closer) bool {
+		for _, stream := range fds {
+			if stream == closer {
+				return false
+			}
+		}
+		closer.Close()
+		return true
+	})
+}
+
+// Set assigns a variable during expansion like ${NAME:=value}
+func (s *State) Set(name, value string) error {
+	return s.Vars.Set(name, value)
+}
+
+// GlobOptions returns the shopt options of pathname expansion
+func (s *State) GlobOptions() shellparser.GlobOptions {
+	opts := s.Options.globOptions()
+	opts.Dir = s.dir
+	return opts
+}
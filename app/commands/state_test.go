@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codecrafters-io/shell-starter-go/app/shellparser"
+)
+
+func TestSubstituteDirectory(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	table := []struct {
+		name  string
+		dir   string
+		input string
+		want  string
+	}{
+		{"shell", "", "cd " + dir + "; pwd", dir + "\n"},
+		{"subshell", dir, "pwd; cd /; pwd", dir + "\n/\n"},
+		{"relative", dir, "cd ..; pwd", filepath.Dir(dir) + "\n"},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			list, err := shellparser.NewParser().Parse([]byte(entry.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := NewState()
+			state.dir = entry.dir
+
+			got, err := state.Substitute(list)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != entry.want {
+				t.Errorf("Wanted %q, Got %q", entry.want, got)
+			}
+
+			// neither the process nor the shell moved
+			if now, _ := os.Getwd(); now != cwd {
+				t.Errorf("Wanted the process in %s, Got %s", cwd, now)
+			}
+			if state.dir != entry.dir {
+				t.Errorf("Wanted the shell in %q, Got %q", entry.dir, state.dir)
+			}
+		})
+	}
+}
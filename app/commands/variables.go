@@ -0,0 +1,333 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/codecrafters-io/shell-starter-go/app/shellparser"
+)
+
+type variable struct {
+	value    string
+	exported bool
+	readonly bool
+}
+
+// Variables is the shell variable table, exported variables
+// are passed in the environment of every program the shell runs
+type Variables struct {
+	mu   sync.RWMutex
+	vars map[string]*variable
+}
+
+// NewVariables creates the table with the environment
+// the shell was started with, all of it exported
+func NewVariables() *Variables {
+	v := &Variables{vars: map[string]*variable{}}
+	for _, entry := range os.Environ() {
+		name, value, found := strings.Cut(entry, "=")
+		if found && shellparser.IsValidName(name) {
+			v.vars[name] = &variable{value: value, exported: true}
+		}
+	}
+	return v
+}
+
+// clone copies the table for a subshell
+func (v *Variables) clone() *Variables {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	c := &Variables{vars: make(map[string]*variable, len(v.vars))}
+	for name, vr := range v.vars {
+		copied := *vr
+		c.vars[name] = &copied
+	}
+	return c
+}
+
+func readonlyError(name string) error {
+	return fmt.Errorf("bash: %s: readonly variable", name)
+}
+
+func (v *Variables) Get(name string) (string, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if vr, found := v.vars[name]; found {
+		return vr.value, true
+	}
+	return "", false
+}
+
+func (v *Variables) Set(name, value string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	vr, found := v.vars[name]
+	if !found {
+		v.vars[name] = &variable{value: value}
+		return nil
+	}
+	if vr.readonly {
+		return readonlyError(name)
+	}
+	vr.value = value
+	return nil
+}
+
+func (v *Variables) Unset(name string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if vr, found := v.vars[name]; found && vr.readonly {
+		return fmt.Errorf("bash: unset: %s: cannot unset: readonly variable", name)
+	}
+	delete(v.vars, name)
+	return nil
+}
+
+// Export marks name to be passed to programs, creating it empty
+// when it doesn't exist like bash does for "export NAME"
+func (v *Variables) Export(name string, exported bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if vr, found := v.vars[name]; found {
+		vr.exported = exported
+	} else if exported {
+		v.vars[name] = &variable{exported: true}
+	}
+}
+
+func (v *Variables) SetReadonly(name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if vr, found := v.vars[name]; found {
+		vr.readonly = true
+	} else {
+		v.vars[name] = &variable{readonly: true}
+	}
+}
+
+// Environ returns the exported variables as NAME=value pairs
+// with extra added on top, ready to be used by exec.Cmd
+func (v *Variables) Environ(extra ...string) []string {
+	v.mu.RLock()
+	base := []string{}
+	for name, vr := range v.vars {
+		if vr.exported {
+			base = append(base, name+"="+vr.value)
+		}
+	}
+	v.mu.RUnlock()
+
+	return mergeEnv(base, extra...)
+}
+
+// mergeEnv adds NAME=value pairs to base, replacing
+// the ones with the same name, the result is sorted
+func mergeEnv(base []string, extra ...string) []string {
+	env := map[string]string{}
+	for _, entry := range append(slices.Clone(base), extra...) {
+		name, value, _ := strings.Cut(entry, "=")
+		env[name] = value
+	}
+
+	res := make([]string, 0, len(env))
+	for name, value := range env {
+		res = append(res, name+"="+value)
+	}
+	slices.Sort(res)
+	return res
+}
+
+// names returns the sorted names of variables that pass filter
+func (v *Variables) names(filter func(vr *variable) bool) []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	res := []string{}
+	for name, vr := range v.vars {
+		if filter(vr) {
+			res = append(res, name)
+		}
+	}
+	slices.Sort(res)
+	return res
+}
+
+// quoteValue quotes a value so it can be read back by the shell
+func quoteValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n'\"\\$`|&;<>()*?[]#~") {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// assign applies NAME=value arguments of export and readonly,
+// a plain NAME is returned as is for the caller to handle
+func (c *Command) assign(arg string) (string, bool) {
+	name, value, hasValue := strings.Cut(arg, "=")
+	if !shellparser.IsValidName(name) {
+		fmt.Fprintf(c.Stderr, "bash: %s: `%s': not a valid identifier\n", c.Name, arg)
+		return name, false
+	}
+
+	if hasValue {
+		if err := c.state.Vars.Set(name, value); err != nil {
+			fmt.Fprintln(c.Stderr, err)
+			return name, false
+		}
+	}
+	return name, true
+}
+
+// export [-n] [-p] [NAME[=value] ...]
+func (c *Command) export() int {
+	args := c.Args
+	unexport := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-n":
+			unexport = true
+		case "-p":
+		default:
+			fmt.Fprintf(c.Stderr, "bash: export: %s: invalid option\n", args[0])
+			return 2
+		}
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		for _, name := range c.state.Vars.names(func(vr *variable) bool { return vr.exported }) {
+			c.printDeclare("-x", name)
+		}
+		return 0
+	}
+
+	exitCode := 0
+	for _, arg := range args {
+		name, ok := c.assign(arg)
+		if !ok {
+			exitCode = 1
+			continue
+		}
+		c.state.Vars.Export(name, !unexport)
+	}
+	return exitCode
+}
+
+// readonly [-p] [NAME[=value] ...]
+func (c *Command) readonly() int {
+	args := c.Args
+	if len(args) > 0 && args[0] == "-p" {
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		for _, name := range c.state.Vars.names(func(vr *variable) bool { return vr.readonly }) {
+			c.printDeclare("-r", name)
+		}
+		return 0
+	}
+
+	exitCode := 0
+	for _, arg := range args {
+		name, ok := c.assign(arg)
+		if !ok {
+			exitCode = 1
+			continue
+		}
+		c.state.Vars.SetReadonly(name)
+	}
+	return exitCode
+}
+
+func (c *Command) printDeclare(flag, name string) {
+	if value, found := c.state.Vars.Get(name); found {
+		fmt.Fprintf(c.Stdout, "declare %s %s=%s\n", flag, name, quoteValue(value))
+	} else {
+		fmt.Fprintf(c.Stdout, "declare %s %s\n", flag, name)
+	}
+}
+
+// unset [-v] NAME ...
+func (c *Command) unset() int {
+	exitCode := 0
+	for _, name := range c.Args {
+		if name == "-v" {
+			continue
+		}
+		if err := c.state.Vars.Unset(name); err != nil {
+			fmt.Fprintln(c.Stderr, err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// envLookup finds the program env runs with the PATH of the environment
+// it gives it, the default one of execvp when there's none
+func (c *Command) envLookup(environ []string, name string) string {
+	pathVar, found := "/bin:/usr/bin", false
+	for _, entry := range environ {
+		if value, ok := strings.CutPrefix(entry, "PATH="); ok {
+			pathVar, found = value, true
+		}
+	}
+
+	// the shell's own PATH goes through the hash table
+	if shellPath, _ := c.state.Vars.Get("PATH"); found && pathVar == shellPath {
+		return c.state.Hash.Lookup(pathVar, name)
+	}
+	return searchDirs(pathVar, name)
+}
+
+// env [-i] [NAME=value ...] [command [args ...]]
+func (c *Command) env() int {
+	args := c.Args
+	environ := c.Env
+	if len(args) > 0 && args[0] == "-i" {
+		// an empty but not nil environment, nil means inherit the shell's
+		environ = []string{}
+		args = args[1:]
+	}
+
+	for len(args) > 0 && strings.Contains(args[0], "=") {
+		environ = mergeEnv(environ, args[0])
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		for _, entry := range environ {
+			if _, err := fmt.Fprintln(c.Stdout, entry); err != nil {
+				_, exitCode := c.writeFailed(err)
+				return exitCode
+			}
+		}
+		return 0
+	}
+
+	cmd := NewCommand(args[0], args[1:])
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = c.Stdin, c.Stdout, c.Stderr
+	cmd.fds = c.fds
+	cmd.state = c.state
+	cmd.job, cmd.launched = c.job, c.launched
+	cmd.Env = environ
+
+	// env only runs programs, never builtins
+	if strings.Contains(cmd.Name, "/") {
+		return cmd.runPath()
+	}
+	location := c.envLookup(environ, cmd.Name)
+	if location == "" {
+		fmt.Fprintf(c.Stderr, "env: '%s': No such file or directory\n", cmd.Name)
+		return 127
+	}
+	return cmd.run(location)
+}
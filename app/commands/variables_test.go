@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExportReadonlyUnset(t *testing.T) {
+	type want struct {
+		value              string
+		found              bool
+		exported, readonly bool
+	}
+
+	table := []struct {
+		name string
+		// the builtins run one after the other, the
+		// status and errors are the ones of the last one
+		cmds     [][]string
+		wantCode int
+		wantErr  string
+		// the variable V afterwards
+		want want
+	}{
+		{"export a value", [][]string{{"export", "V=1"}}, 0, "", want{"1", true, true, false}},
+		{"export again", [][]string{{"export", "V=2"}, {"export", "-n", "V"}, {"export", "V"}}, 0, "", want{"2", true, true, false}},
+		{"export creates an empty variable", [][]string{{"export", "V"}}, 0, "", want{"", true, true, false}},
+		{"export -n keeps the value", [][]string{{"export", "V=1"}, {"export", "-n", "V"}}, 0, "", want{"1", true, false, false}},
+		{"export -n of nothing creates nothing", [][]string{{"export", "-n", "V"}}, 0, "", want{}},
+		{"export an invalid name", [][]string{{"export", "1V=1", "V=2"}}, 1, "bash: export: `1V=1': not a valid identifier\n", want{"2", true, true, false}},
+		{"export an invalid option", [][]string{{"export", "-z", "V=1"}}, 2, "bash: export: -z: invalid option\n", want{}},
+		{"readonly a value", [][]string{{"readonly", "V=1"}}, 0, "", want{"1", true, false, true}},
+		{"readonly stays exported", [][]string{{"export", "V=1"}, {"readonly", "V"}}, 0, "", want{"1", true, true, true}},
+		{"readonly can't be assigned", [][]string{{"readonly", "V=1"}, {"readonly", "V=2"}}, 1, "bash: V: readonly variable\n", want{"1", true, false, true}},
+		{"readonly can't be exported with a value", [][]string{{"readonly", "V=1"}, {"export", "V=2"}}, 1, "bash: V: readonly variable\n", want{"1", true, false, true}},
+		{"readonly can be exported", [][]string{{"readonly", "V=1"}, {"export", "V"}}, 0, "", want{"1", true, true, true}},
+		{"readonly an invalid name", [][]string{{"readonly", "V-1"}}, 1, "bash: readonly: `V-1': not a valid identifier\n", want{}},
+		{"unset", [][]string{{"export", "V=1"}, {"unset", "V"}}, 0, "", want{}},
+		{"unset -v", [][]string{{"export", "V=1"}, {"unset", "-v", "V"}}, 0, "", want{}},
+		{"unset a missing variable", [][]string{{"unset", "V"}}, 0, "", want{}},
+		{"unset a readonly variable", [][]string{{"readonly", "V=1"}, {"unset", "V", "W"}}, 1, "bash: unset: V: cannot unset: readonly variable\n", want{"1", true, false, true}},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			state := NewState()
+			state.Vars.Unset("V")
+			var code int
+			var errs string
+			for _, args := range entry.cmds {
+				cmd, _, stderr := testCommand(state, args[0], args[1:]...)
+				_, code = cmd.Execute()
+				errs = stderr.String()
+			}
+			if code != entry.wantCode {
+				t.Errorf("Wanted status %d, Got %d", entry.wantCode, code)
+			}
+			if errs != entry.wantErr {
+				t.Errorf("Wanted %q, Got %q", entry.wantErr, errs)
+			}
+
+			var got want
+			if vr, found := state.Vars.vars["V"]; found {
+				got = want{vr.value, true, vr.exported, vr.readonly}
+			}
+			if got != entry.want {
+				t.Errorf("Wanted %+v, Got %+v", entry.want, got)
+			}
+		})
+	}
+}
+
+func TestDeclareListing(t *testing.T) {
+	state := NewState()
+	state.Vars.Set("R", "it's")
+	state.Vars.SetReadonly("R")
+	state.Vars.SetReadonly("EMPTY")
+
+	cmd, stdout, _ := testCommand(state, "readonly", "-p")
+	cmd.Execute()
+	want := "declare -r EMPTY=''\ndeclare -r R='it'\\''s'\n"
+	if stdout.String() != want {
+		t.Errorf("Wanted %q, Got %q", want, stdout.String())
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	state := NewState()
+	state.Vars = &Variables{vars: map[string]*variable{}}
+	state.Vars.Set("A", "1")
+	state.Vars.Export("A", true)
+	state.Vars.Set("B", "2")
+	state.Vars.Export("C", true)
+
+	got := state.Vars.Environ("A=3", "D=4")
+	slices.Sort(got)
+	want := []string{"A=3", "C=", "D=4"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Wanted %q, Got %q", want, got)
+	}
+}
+
+func TestEnvLookup(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	for _, dir := range dirs {
+		if err := os.WriteFile(filepath.Join(dir, "prog"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	state := NewState()
+	state.Vars.Set("PATH", dirs[0])
+	// the shell's PATH goes through the hash table
+	state.Hash.set(dirs[0], "prog", filepath.Join(dirs[1], "prog"))
+	cmd, _, _ := testCommand(state, "env")
+
+	table := []struct {
+		name    string
+		environ []string
+		want    string
+	}{
+		{"the shell's PATH", []string{"PATH=" + dirs[0]}, filepath.Join(dirs[1], "prog")},
+		{"another PATH", []string{"PATH=" + dirs[0] + ":"}, filepath.Join(dirs[0], "prog")},
+		{"the last PATH", []string{"PATH=/nowhere", "PATH=" + dirs[1]}, filepath.Join(dirs[1], "prog")},
+		{"no PATH", []string{}, ""},
+	}
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			if got := cmd.envLookup(entry.environ, "prog"); got != entry.want {
+				t.Errorf("Wanted %q, Got %q", entry.want, got)
+			}
+		})
+	}
+}
@@ -1,9 +1,13 @@
 package editor
 
 import (
-	"fmt"
 	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
 	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/app/shellparser"
 )
 
 const (
@@ -15,53 +19,383 @@ const (
 type autoComplete struct {
 	// all commands trie
 	cmdTrie *Trie
+	// commands the trie is built from and the
+	// version of them it has, rebuilt when it changes
+	commands        func() ([]string, int)
+	commandsVersion int
+	// completions of arguments registered with the complete builtin
+	completer Completer
+	// lookup returns the shell variables, HOME for ~/
+	lookup func(name string) (string, bool)
+}
+
+// CompResult are the completions of an argument and
+// the options saying how they are inserted
+type CompResult struct {
+	Words []string
+	// no space is added after a single completion
+	NoSpace bool
+	// words are paths, directories get a slash
+	Filenames bool
+	// paths or directories are completed instead
+	// when there are no words
+	Default  bool
+	DirNames bool
+}
+
+// Completer returns the completions of the last of words, the command
+// being words[0], found is false when the command has none registered
+type Completer func(words []string, line string) (result CompResult, found bool)
+
+// SetCompleter sets where the arguments of commands are completed from
+func (e *Editor) SetCompleter(completer Completer) {
+	e.autoComplete.completer = completer
 }
 
 func newAutoComplete() *autoComplete {
-	cmdTrie := createCmdTrie()
+	cmdTrie := createCmdTrie(nil)
 
 	return &autoComplete{
 		cmdTrie: cmdTrie,
+		lookup:  os.LookupEnv,
 	}
 }
 
-func (ac *autoComplete) completeWord(partialWord string) (string, int) {
-	// first search inside path
+// SetCommands sets where the names of commands, the builtins and the
+// programs, are taken from, the version it returns tells if they changed
+// since the last time
+func (e *Editor) SetCommands(commands func() (names []string, version int)) {
+	e.autoComplete.commands = commands
+	e.autoComplete.commandsVersion = -1
+}
+
+// refreshTrie rebuilds the trie when the programs changed
+func (ac *autoComplete) refreshTrie() {
+	if ac.commands == nil {
+		return
+	}
+	names, version := ac.commands()
+	if version != ac.commandsVersion {
+		ac.cmdTrie = createCmdTrie(names)
+		ac.commandsVersion = version
+	}
+}
 
-	// search commands
-	return ac.cmdTrie.complete(partialWord)
+// completion is what Tab found for the word under the cursor
+type completion struct {
+	// text to insert at the cursor, escaped for the word it goes in
+	rest string
+	flag int
+	// the completed words and the names shown for them
+	// when Tab is pressed twice, file names without their directory
+	candidates []string
+	words      []string
+	// the word once rest is inserted, without quotes and escapes,
+	// and the quote open in it
+	prefix string
+	quote  byte
 }
 
-func (ac *autoComplete) printWordsWithSharedPrefixes(prefix string) {
-	fmt.Print("\n")
+// completeWord completes the last word of line, which is the input up
+// to the cursor, with a command name in command position, with what
+// the completer returns for arguments of commands it knows and with
+// a path anywhere else or when the word has a slash in it
+func (ac *autoComplete) completeWord(line string) completion {
+	word := currentWord(line)
+
+	var candidates, words []string
+	noSpace := false
+	switch {
+	case word.command && !strings.Contains(word.prefix, "/"):
+		ac.refreshTrie()
+		if word.prefix != "" {
+			candidates = ac.cmdTrie.getWordsGivenPrefix(word.prefix)
+		}
+		words = candidates
+	case word.command:
+		candidates, words = ac.completePath(word.prefix, func(info os.FileInfo) bool {
+			return info.IsDir() || info.Mode()&0o111 != 0
+		})
+	default:
+		result, found := ac.complete(word, line)
+		if !found {
+			candidates, words = ac.completePath(word.prefix, nil)
+			break
+		}
+		candidates, words, noSpace = result.Words, result.Words, result.NoSpace
+	}
 
-	words := ac.cmdTrie.getWordsGivenPrefix(prefix)
-	for i, w := range words {
-		fmt.Print(w)
-		if i < len(words)-1 {
-			fmt.Print("  ")
+	switch len(candidates) {
+	case 0:
+		return completion{flag: FOUND_NOTHING}
+	case 1:
+		rest := quoteCompletion(candidates[0][len(word.prefix):], word.quote)
+		// a directory is left open to go on with what's inside
+		if !strings.HasSuffix(rest, "/") && !noSpace {
+			if word.quote != 0 {
+				rest += string(word.quote)
+			}
+			rest += " "
 		}
+		return completion{rest: rest, flag: FOUND_ONE, candidates: candidates, words: words}
+	}
+
+	shared := sharedPrefix(candidates)
+	return completion{
+		rest:       quoteCompletion(shared[len(word.prefix):], word.quote),
+		flag:       FOUND_MULTIPLE,
+		candidates: candidates,
+		words:      words,
+		prefix:     shared,
+		quote:      word.quote,
 	}
-	fmt.Printf("\n")
 }
 
-func createCmdTrie() *Trie {
-	trie := newTrie()
+// sharedPrefix is the longest prefix of all the candidates,
+// shortened a character at a time and never inside one
+func sharedPrefix(candidates []string) string {
+	shared := []rune(slices.Min(candidates))
+	for _, candidate := range candidates {
+		for !strings.HasPrefix(candidate, string(shared)) {
+			shared = shared[:len(shared)-1]
+		}
+	}
+	return string(shared)
+}
 
-	builtinCommands := []string{"exit", "echo", "type", "pwd", "cd"}
-	for _, name := range builtinCommands {
-		trie.insert(name)
+// complete asks the completer for the completions of an argument,
+// only the ones starting with the word are kept
+func (ac *autoComplete) complete(word wordAtCursor, line string) (CompResult, bool) {
+	if ac.completer == nil || word.redirect || len(word.words) == 0 {
+		return CompResult{}, false
+	}
+	result, found := ac.completer(append(word.words, word.prefix), line)
+	if !found {
+		return result, false
 	}
 
-	for dir := range strings.SplitSeq(os.Getenv("PATH"), ":") {
-		files, err := os.ReadDir(dir)
+	words := []string{}
+	for _, w := range result.Words {
+		if !strings.HasPrefix(w, word.prefix) {
+			continue
+		}
+		if result.Filenames && !strings.HasSuffix(w, "/") {
+			if info, err := os.Stat(w); err == nil && info.IsDir() {
+				w += "/"
+			}
+		}
+		words = append(words, w)
+	}
+	result.Words = words
+
+	if len(words) == 0 {
+		switch {
+		case result.Default:
+			result.Words, _ = ac.completePath(word.prefix, nil)
+		case result.DirNames:
+			result.Words, _ = ac.completePath(word.prefix, os.FileInfo.IsDir)
+		}
+	}
+	return result, true
+}
+
+// wordAtCursor is the word being completed
+type wordAtCursor struct {
+	// the word without its quotes and escapes
+	prefix string
+	// quote still open at the cursor, 0 when none
+	quote byte
+	// the word is a command name, the first of a
+	// command after any assignments
+	command bool
+	// the word is the file of a redirection
+	redirect bool
+	// the words of the command before this one
+	words []string
+}
+
+// currentWord finds the last word of line following the quoting
+// rules of the parser closely enough to know where it starts
+func currentWord(line string) wordAtCursor {
+	var sb strings.Builder
+	var quote byte
+	var words []string
+	command, redirect := true, false
+
+	endWord := func() {
+		if sb.Len() > 0 {
+			// the word after a redirection is a file,
+			// assignments are followed by the command
+			switch {
+			case redirect:
+				redirect = false
+			case !command || !isAssignment(sb.String()):
+				command = false
+				words = append(words, sb.String())
+			}
+		}
+		sb.Reset()
+	}
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+			} else {
+				sb.WriteByte(ch)
+			}
+		case quote == '"':
+			if ch == '"' {
+				quote = 0
+			} else if ch == '\\' && i+1 < len(line) && strings.IndexByte("\"\\$`", line[i+1]) >= 0 {
+				i++
+				sb.WriteByte(line[i])
+			} else {
+				sb.WriteByte(ch)
+			}
+		case ch == '\\':
+			if i+1 < len(line) {
+				i++
+				sb.WriteByte(line[i])
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == ' ' || ch == '\t':
+			endWord()
+		case ch == '<' || ch == '>':
+			endWord()
+			redirect = true
+		case strings.IndexByte(";|&()`", ch) >= 0:
+			endWord()
+			command, redirect, words = true, false, nil
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+
+	return wordAtCursor{
+		prefix:   sb.String(),
+		quote:    quote,
+		command:  command && !redirect,
+		redirect: redirect,
+		words:    words,
+	}
+}
+
+func isAssignment(word string) bool {
+	name, _, found := strings.Cut(word, "=")
+	return found && shellparser.IsValidName(name)
+}
+
+// completePath returns the paths starting with prefix that pass keep,
+// a nil keep keeps all of them, directories end with a slash and
+// words are the names shown when listing them
+func (ac *autoComplete) completePath(prefix string, keep func(info os.FileInfo) bool) (candidates, words []string) {
+	if strings.HasPrefix(prefix, "~") && !strings.Contains(prefix, "/") {
+		return completeHome(prefix)
+	}
+
+	dir, base := "", prefix
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir, base = prefix[:i+1], prefix[i+1:]
+	}
+
+	readDir := dir
+	switch {
+	case readDir == "":
+		readDir = "."
+	case strings.HasPrefix(readDir, "~/"):
+		// the HOME of the shell, like tilde expansion
+		home, _ := ac.lookup("HOME")
+		readDir = home + readDir[1:]
+	case strings.HasPrefix(readDir, "~"):
+		name, rest, _ := strings.Cut(readDir[1:], "/")
+		u, err := user.Lookup(name)
+		if err != nil {
+			return nil, nil
+		}
+		readDir = u.HomeDir + "/" + rest
+	}
+
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil, nil
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		// hidden files only when asked for with a dot
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+
+		// symbolic links are completed as what they point to
+		info, err := os.Stat(filepath.Join(readDir, name))
 		if err != nil {
 			continue
 		}
+		if keep != nil && !keep(info) {
+			continue
+		}
+		if info.IsDir() {
+			name += "/"
+		}
+
+		candidates = append(candidates, dir+name)
+		words = append(words, name)
+	}
+	return candidates, words
+}
+
+// completeHome completes a word starting with ~ and no slash yet, a lone
+// ~ is the home directory of the shell and ~name the ones of the users
+func completeHome(prefix string) (candidates, words []string) {
+	if prefix == "~" {
+		return []string{"~/"}, []string{"~/"}
+	}
+	passwd, err := os.ReadFile("/etc/passwd")
+	if err != nil {
+		return nil, nil
+	}
+	for line := range strings.Lines(string(passwd)) {
+		name, _, _ := strings.Cut(line, ":")
+		if name == "" || strings.HasPrefix(name, "#") || !strings.HasPrefix(name, prefix[1:]) {
+			continue
+		}
+		candidates = append(candidates, "~"+name+"/")
+	}
+	slices.Sort(candidates)
+	candidates = slices.Compact(candidates)
+	return candidates, candidates
+}
 
-		for _, file := range files {
-			trie.insert(file.Name())
+// quoteCompletion escapes completed text so it stays part of the
+// same word, quote is the quote open in the word if any
+func quoteCompletion(s string, quote byte) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote == '\'' && ch == '\'':
+			sb.WriteString(`'\''`)
+			continue
+		case quote == '"' && strings.IndexByte("\"\\$`", ch) >= 0:
+			sb.WriteByte('\\')
+		case quote == 0 && strings.IndexByte(" \t\n'\"\\$`|&;<>()*?[]#~!{}", ch) >= 0:
+			sb.WriteByte('\\')
 		}
+		sb.WriteByte(ch)
+	}
+	return sb.String()
+}
+
+func createCmdTrie(names []string) *Trie {
+	trie := newTrie()
+
+	for _, name := range names {
+		trie.insert(name)
 	}
 
 	return trie
@@ -99,37 +433,6 @@ func (t *Trie) insert(word string) {
 	cur.isWord = true
 }
 
-func (t *Trie) complete(partialWord string) (string, int) {
-	if len(partialWord) == 0 {
-		return "", FOUND_NOTHING
-	}
-
-	cur := t.root
-
-	for i := range partialWord {
-		ch := partialWord[i]
-		cur = cur.children[ch]
-		if cur == nil {
-			return "", FOUND_NOTHING
-		}
-	}
-
-	var restOfWord strings.Builder
-	for len(cur.children) != 0 {
-		if cur.isWord || len(cur.children) > 1 {
-			return restOfWord.String(), FOUND_MULTIPLE
-		}
-		// iterate once cause map has only one item
-		for char, child := range cur.children {
-			restOfWord.WriteByte(char)
-			cur = child
-			break
-		}
-	}
-
-	return restOfWord.String(), FOUND_ONE
-}
-
 func (t *Trie) getWordsGivenPrefix(prefix string) []string {
 	cur := t.root
 
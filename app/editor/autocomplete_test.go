@@ -0,0 +1,75 @@
+package editor
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSharedPrefix(t *testing.T) {
+	table := []struct {
+		candidates []string
+		want       string
+	}{
+		{[]string{"echo"}, "echo"},
+		{[]string{"echo", "exit"}, "e"},
+		{[]string{"export", "exit", "exec"}, "ex"},
+		{[]string{"cat", "cd"}, "c"},
+		{[]string{"abc", "xyz"}, ""},
+		{[]string{"dir/", "dir/a"}, "dir/"},
+		{[]string{"héllo", "hêllo"}, "h"},
+		{[]string{"héllo", "héros"}, "hé"},
+		{[]string{"日本語", "日本人"}, "日本"},
+		{[]string{"😀a", "😁b"}, ""},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.want, func(t *testing.T) {
+			assertEqual(t, entry.want, sharedPrefix(entry.candidates))
+		})
+	}
+}
+
+func TestCompletePathHome(t *testing.T) {
+	home := t.TempDir()
+	assertNoError(t, os.Mkdir(filepath.Join(home, "projects"), 0o755))
+	assertNoError(t, os.WriteFile(filepath.Join(home, "profile"), nil, 0o644))
+
+	ac := newAutoComplete()
+	ac.lookup = func(name string) (string, bool) {
+		return home, name == "HOME"
+	}
+	candidates, words := ac.completePath("~/pro", nil)
+	assertEqual(t, []string{"~/profile", "~/projects/"}, candidates)
+	assertEqual(t, []string{"profile", "projects/"}, words)
+
+	candidates, words = ac.completePath("~", nil)
+	assertEqual(t, []string{"~/"}, candidates)
+	assertEqual(t, []string{"~/"}, words)
+}
+
+func TestCompletePathUsers(t *testing.T) {
+	root, err := user.Lookup("root")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	ac := newAutoComplete()
+	candidates, _ := ac.completePath("~roo", nil)
+	if !slices.Contains(candidates, "~root/") {
+		t.Errorf("Wanted ~root/ in %v", candidates)
+	}
+
+	entries, err := os.ReadDir(root.HomeDir)
+	if err != nil || len(entries) == 0 {
+		t.Skip("nothing to complete in", root.HomeDir)
+	}
+	name := entries[0].Name()
+	candidates, _ = ac.completePath("~root/"+name, nil)
+	if len(candidates) == 0 || !strings.HasPrefix(candidates[0], "~root/"+name) {
+		t.Errorf("Wanted ~root/%s, Got %v", name, candidates)
+	}
+}
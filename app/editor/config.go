@@ -55,7 +55,20 @@ func (c *config) enableRawMode() {
 }
 
 func (c *config) disableRawMode() {
+	if c.oldState == nil {
+		return
+	}
 	if err := unix.IoctlSetTermios(int(os.Stdin.Fd()), unix.TCSETS, c.oldState); err != nil {
 		log.Panicf("disableRawMode: %s\n", err.Error())
 	}
 }
+
+// termSize returns the columns and rows of the terminal, 80x24 when
+// stdout is not a terminal
+func termSize() (cols, rows int) {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 {
+		return 80, 24
+	}
+	return int(ws.Col), int(ws.Row)
+}
@@ -2,20 +2,32 @@ package editor
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/exec"
 	"slices"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 func _CTRL_KEY(char int) int {
 	return (char) & 0x1f
 }
 
+// Alt is sent as ESC before the key, such keys
+// are numbered above all the others
+func _ALT_KEY(char int) int {
+	return 0x200000 + char
+}
+
+// the keys that aren't characters are numbered past the last rune
 const (
 	BACKSPACE  = 127
-	ARROW_LEFT = iota + 1000
+	ARROW_LEFT = iota + int(unicode.MaxRune)
 	ARROW_RIGHT
 	ARROW_UP
 	ARROW_DOWN
@@ -24,49 +36,152 @@ const (
 	END_KEY
 	PAGE_UP
 	PAGE_DOWN
+	END_OF_INPUT
+	SHIFT_TAB
 )
 
-const PS1 = "$ "
-const cursorStart = len(PS1) + 1
+// ErrInterrupted is returned by TakeInput when the line is discarded with Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
 
 type Editor struct {
 	*autoComplete
 	*config
+	// offset of the cursor in Input
 	cursor     int
-	Input      []byte
+	Input      []rune
 	rbuf       *bufio.Reader
 	tabPresses uint8
+	// the key being read while a resize is waited for too
+	keys    chan keyRead
+	reading bool
+	winch   chan os.Signal
+	// columns of the terminal and what's drawn on it
+	cols   int
+	screen screenLine
+	// prompt of the line being read
+	ps string
+	// why the line ended early, io.EOF or ErrInterrupted
+	err error
+
+	history *History
+	// entry shown while moving in the history, equal to
+	// its length on the line being typed which draft keeps
+	historyIndex int
+	draft        []rune
+	// last string searched with Ctrl-R or Ctrl-S
+	lastSearch []rune
+	// candidates shown after Tab was pressed twice
+	menu *completionMenu
+
+	// killed texts, Ctrl-Y yanks the last one
+	killRing [][]rune
+	yanked   yankState
+	// lines before each edit, Ctrl-_ goes back to them
+	undo []editState
+	// what the last key did and the one before it, kills
+	// after kills add to the same text of the kill ring
+	lastCmd, prevCmd editCmd
+
+	// keys to handle before reading the terminal again
+	pending []int
+	// the state of vi mode, nil in emacs mode
+	vi *viState
+	// text shown before the prompt for the editing mode
+	modeIndicator func(Mode) string
+	// the shell variables, for EDITOR and the others
+	lookup func(string) (string, bool)
+	// what the keys do in each editing mode
+	bindings *Bindings
 }
 
 func NewEditor() *Editor {
 	c := &config{}
-	c.enableRawMode()
 	reader := bufio.NewReader(os.Stdin)
 	ac := newAutoComplete()
 
+	// the lines of earlier sessions, from the environment's HISTFILE
+	history := NewHistory()
+	if err := history.Load(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	// the key bindings of the environment's INPUTRC
+	bindings := NewBindings()
+	if err := bindings.LoadInputrc(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
 	return &Editor{
-		autoComplete: ac,
-		config:       c,
-		cursor:       cursorStart,
-		Input:        nil,
-		rbuf:         reader,
-		tabPresses:   0,
+		autoComplete:  ac,
+		config:        c,
+		cursor:        0,
+		Input:         nil,
+		rbuf:          reader,
+		tabPresses:    0,
+		keys:          make(chan keyRead, 1),
+		winch:         notifyResize(),
+		cols:          80,
+		history:       history,
+		modeIndicator: defaultModeIndicator,
+		lookup:        os.LookupEnv,
+		bindings:      bindings,
 	}
 }
 
+// SetLookup makes the editor, its completion, history and bindings read variables
+// like EDITOR, HISTSIZE and INPUTRC with lookup instead of the environment
+func (e *Editor) SetLookup(lookup func(string) (string, bool)) {
+	e.lookup = lookup
+	e.autoComplete.lookup = lookup
+	e.history.SetLookup(lookup)
+	e.bindings.SetLookup(lookup)
+}
+
+// Bindings returns the key bindings of the editing modes
+func (e *Editor) Bindings() *Bindings {
+	return e.bindings
+}
+
+// History returns the lines entered so far
+func (e *Editor) History() *History {
+	return e.history
+}
+
 func (e *Editor) cleanEditor() {
 	e.Input = nil
-	e.cursor = cursorStart
+	e.cursor = 0
+	e.err = nil
+	e.draft = nil
+	e.undo = nil
+	e.lastCmd = cmdOther
 }
 
-func (e *Editor) TakeInput() []byte {
+// TakeInput reads a line after prompt with the terminal in raw mode,
+// it's restored before returning so programs get the usual terminal,
+// Ctrl-D on an empty line returns io.EOF and Ctrl-C ErrInterrupted,
+// the text of prompt between \x01 and \x02 takes no room on the screen
+func (e *Editor) TakeInput(prompt string) ([]byte, error) {
+	e.ps = prompt
+	e.enableRawMode()
+	defer e.disableRawMode()
 	defer e.cleanEditor()
-	fmt.Print(PS1)
+	e.historyIndex = e.history.len()
+	e.startLine()
+	e.startScreen()
+	e.refreshLine()
 	for e.processKeyPress() {
 		e.refreshLine()
 	}
-	fmt.Println()
-	return e.Input
+	if e.err == io.EOF {
+		// the caller says goodbye on the same line
+		e.moveToEnd()
+		return nil, e.err
+	}
+	e.newLine()
+	if e.err != nil {
+		return nil, e.err
+	}
+	return []byte(string(e.Input)), nil
 }
 
 func (e *Editor) Destroy() {
@@ -76,65 +191,109 @@ func (e *Editor) Destroy() {
 func (e *Editor) processKeyPress() bool {
 	c := e.readKey()
 
+	// keys the terminal would turn into signals, they can't be bound
 	switch c {
-	case '\r', '\n':
-		e.Input = append(e.Input, '\n') // for parser
+	case _CTRL_KEY('c'):
+		if e.menu != nil {
+			e.closeMenu()
+		}
+		// the terminal doesn't echo it in raw mode
+		e.moveToEnd()
+		fmt.Print("^C")
+		e.err = ErrInterrupted
 		return false
 
-	case '\t':
-		e.handleAutoComplete()
+	case _CTRL_KEY('z'):
+		// nothing to suspend at the prompt, running jobs
+		// are stopped by the terminal itself
 		return true
 
-	case _CTRL_KEY('l'):
-		fmt.Print("\x1b[2J\x1b[H")
+	case END_OF_INPUT:
+		e.err = io.EOF
+		return false
+	}
 
-	case BACKSPACE, DEL_KEY, _CTRL_KEY('h'):
-		if c == DEL_KEY {
-			if e.cursor < cursorStart+len(e.Input) {
-				e.moveCursor(ARROW_RIGHT)
-				e.removeChar()
-			}
-		} else {
-			e.removeChar()
-		}
+	if e.vi != nil {
+		return e.viKeyPress(c)
+	}
 
-	case _CTRL_KEY('c'), _CTRL_KEY('d'), _CTRL_KEY('z'):
-		// TODO should send signal to the exit function
-		// for now do it yourself
-		fmt.Println("^Interrupt")
-		e.Destroy()
-		os.Exit(0)
+	before := editState{input: slices.Clone(e.Input), cursor: e.cursor}
+	e.prevCmd, e.lastCmd = e.lastCmd, cmdOther
+	more := e.handleKey(c)
+	e.recordUndo(before)
+	return more
+}
 
-	case ARROW_LEFT, ARROW_RIGHT, ARROW_UP, ARROW_DOWN:
-		e.moveCursor(c)
+// handleKey runs what the sequence of keys starting with c is
+// bound to in the keymap of the mode, unbound keys ring the bell
+func (e *Editor) handleKey(c int) bool {
+	if e.menu != nil && e.menuKey(c) {
+		return true
+	}
 
-	default:
-		if char := rune(c); unicode.IsPrint(char) {
-			e.insertChar(byte(char))
+	keys, bound, found := e.lookupKey(e.keymap(), c)
+	if !found {
+		// characters past ASCII are typed as they are
+		if c >= 0x80 && c <= unicode.MaxRune {
+			return actions["self-insert"](e, c)
 		}
+		fmt.Print("\a")
+		e.tabPresses = 0
+		return true
+	}
+	if e.vi != nil && e.vi.recording && bound.macro == nil {
+		e.vi.keys = append(e.vi.keys, keys...)
 	}
+	return e.runBinding(keys, bound)
+}
 
-	e.tabPresses = 0
-	return true
+// prompt is the one of TakeInput after the indicator of the editing mode
+func (e *Editor) prompt() string {
+	return e.modeIndicator(e.mode()) + e.ps
 }
 
 func (e *Editor) refreshLine() {
+	e.drawLine(e.prompt(), e.Input, e.cursor)
+	if e.menu != nil && !e.menu.printed {
+		e.drawMenu()
+	}
+}
+
+// drawLine replaces the terminal line with prompt and line,
+// cursor is the offset in line the cursor is left at
+func (e *Editor) drawLine(prompt string, line []rune, cursor int) {
 	buf := []byte{}
 
 	// "\x1b[?25l" hide cursor
 	buf = append(buf, []byte("\x1b[?25l")...)
+	// up to the first row of the prompt
+	if e.screen.row > 0 {
+		buf = fmt.Appendf(buf, "\x1b[%dA", e.screen.row)
+	}
 	// position to start of line
 	buf = append(buf, []byte("\x1b[G")...)
-	// "\x1b[K" everything right to the cursor
-	buf = append(buf, []byte("\x1b[K")...)
+	// "\x1b[J" everything from the cursor to the end of the screen
+	buf = append(buf, []byte("\x1b[J")...)
 
 	// "$ input" add data
-	data := fmt.Sprintf("%s%s", PS1, e.Input)
+	data := fmt.Sprintf("%s%s", promptMarkers.Replace(prompt), string(line))
 	buf = append(buf, []byte(data)...) // might change
 
+	// the terminal waits for another character before going to
+	// the next row once the last one is full, it's done here
+	endRow, endCol := layout(e.cols, prompt, line)
+	if endCol == e.cols {
+		buf = append(buf, []byte("\r\n")...)
+		endRow++
+	}
+
 	// position cursor to the end of text
-	position := fmt.Sprintf("\x1b[%dG", e.cursor)
-	buf = append(buf, []byte(position)...)
+	row, col := cursorPosition(e.cols, prompt, line, cursor)
+	if endRow > row {
+		buf = fmt.Appendf(buf, "\x1b[%dA", endRow-row)
+	}
+	buf = fmt.Appendf(buf, "\x1b[%dG", col+1)
+	e.screen = screenLine{prompt: prompt, line: slices.Clone(line), cursor: cursor, row: row}
 
 	// "\x1b[?25h" show cursor
 	buf = append(buf, []byte("\x1b[?25h")...)
@@ -149,107 +308,155 @@ func (e *Editor) refreshLine() {
 }
 
 func (e *Editor) readKey() int {
-	var err error
-	var char byte
+	if len(e.pending) > 0 {
+		c := e.pending[0]
+		e.pending = e.pending[1:]
+		return c
+	}
 
-	char, err = e.rbuf.ReadByte()
-	e.panicOnErr("readKey", err)
+	// read in a goroutine to redraw the line on resizes meanwhile,
+	// only one key at a time so programs get the rest of the input
+	if !e.reading {
+		e.reading = true
+		go func() {
+			c, err := decodeKey(e.rbuf)
+			e.keys <- keyRead{c, err}
+		}()
+	}
+	for {
+		select {
+		case read := <-e.keys:
+			e.reading = false
+			if read.err == io.EOF {
+				return END_OF_INPUT
+			}
+			e.panicOnErr("readKey", read.err)
+			return read.key
+		case <-e.winch:
+			e.resize()
+		}
+	}
+}
+
+// decodeKey reads a key from r, the escape sequences
+// of the terminal are decoded to the keys above
+func decodeKey(r *bufio.Reader) (int, error) {
+	char, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
 
-	// if ESC
-	if char == '\x1b' {
+	// if ESC, alone when nothing else came with it since
+	// the terminal sends a sequence in a single write
+	if char == '\x1b' && r.Buffered() > 0 {
 		seq := [3]byte{}
-		seq[0], err = e.rbuf.ReadByte()
+		seq[0], err = r.ReadByte()
 
 		if err != nil {
-			return int(char)
+			return int(char), nil
+		}
+		if seq[0] >= utf8.RuneSelf {
+			r.UnreadByte()
+			char, _, _ := r.ReadRune()
+			return _ALT_KEY(int(char)), nil
 		}
-		seq[1], err = e.rbuf.ReadByte()
+		if seq[0] != '[' && seq[0] != 'O' {
+			return _ALT_KEY(int(seq[0])), nil
+		}
+		seq[1], err = r.ReadByte()
 		if err != nil {
-			return int(char)
+			return int(char), nil
 		}
 
 		if seq[0] == '[' {
 			if seq[1] >= '0' && seq[1] <= '9' {
-				seq[2], err = e.rbuf.ReadByte()
+				seq[2], err = r.ReadByte()
 				if err != nil {
-					return int(char)
+					return int(char), nil
 				}
 				if seq[2] == '~' {
 					switch seq[1] {
 					case '1':
-						return HOME_KEY
+						return HOME_KEY, nil
 					case '3':
-						return DEL_KEY
+						return DEL_KEY, nil
 					case '4':
-						return END_KEY
+						return END_KEY, nil
 					case '5':
-						return PAGE_UP
+						return PAGE_UP, nil
 					case '6':
-						return PAGE_DOWN
+						return PAGE_DOWN, nil
 					case '7':
-						return HOME_KEY
+						return HOME_KEY, nil
 					case '8':
-						return END_KEY
+						return END_KEY, nil
 					}
 				}
 			} else {
 				switch seq[1] {
 				case 'A':
-					return ARROW_UP
+					return ARROW_UP, nil
 				case 'B':
-					return ARROW_DOWN
+					return ARROW_DOWN, nil
 				case 'C':
-					return ARROW_RIGHT
+					return ARROW_RIGHT, nil
 				case 'D':
-					return ARROW_LEFT
+					return ARROW_LEFT, nil
 				case 'H':
-					return HOME_KEY
+					return HOME_KEY, nil
 				case 'F':
-					return END_KEY
+					return END_KEY, nil
+				case 'Z':
+					return SHIFT_TAB, nil
 				}
 			}
 		} else if seq[0] == 'O' {
 			switch seq[1] {
 			case 'H':
-				return HOME_KEY
+				return HOME_KEY, nil
 			case 'F':
-				return END_KEY
+				return END_KEY, nil
 			}
 		}
 
-		return int(char)
+		return int(char), nil
 	}
-	return int(char)
-}
 
-func (e *Editor) insertChar(char byte) {
-	at := e.cursor - cursorStart
-
-	e.Input = append(e.Input, 0)
-	copy(e.Input[at+1:], e.Input[at:])
-	e.Input[at] = char
+	// the other bytes of a character typed in UTF-8 come with it
+	if char >= utf8.RuneSelf {
+		r.UnreadByte()
+		char, _, _ := r.ReadRune()
+		return int(char), nil
+	}
+	return int(char), nil
+}
 
+func (e *Editor) insertChar(char rune) {
+	e.Input = slices.Insert(e.Input, e.cursor, char)
 	e.cursor++
 }
 
+func (e *Editor) insertString(s string) {
+	for _, char := range s {
+		e.insertChar(char)
+	}
+}
+
 func (e *Editor) moveCursor(arrow int) {
 	switch arrow {
 	case ARROW_LEFT:
-		if e.cursor > cursorStart {
+		if e.cursor > 0 {
 			e.cursor--
 		}
 	case ARROW_RIGHT:
-		if e.cursor < len(e.Input)+cursorStart {
+		if e.cursor < len(e.Input) {
 			e.cursor++
 		}
-	case ARROW_UP, ARROW_DOWN:
-		fmt.Print("\a")
-		// later can implement history
 	}
 }
 
 func (e *Editor) removeChar() {
-	at := e.cursor - cursorStart - 1
+	at := e.cursor - 1
 	if at < 0 || at >= len(e.Input) {
 		return
 	}
@@ -258,18 +465,15 @@ func (e *Editor) removeChar() {
 }
 
 func (e *Editor) handleAutoComplete() {
-	restOfWord, flag := e.autoComplete.completeWord(string(e.Input))
-	if flag == FOUND_NOTHING {
+	at := e.cursor
+	found := e.autoComplete.completeWord(string(e.Input[:at]))
+	if found.flag == FOUND_NOTHING {
 		fmt.Printf("\a")
 	} else {
 		// there is a match or partial
-		e.Input = append(e.Input, []byte(restOfWord)...)
-		e.cursor += len(restOfWord)
+		e.insertString(found.rest)
 
-		if flag == FOUND_ONE {
-			e.Input = append(e.Input, ' ')
-			e.cursor++
-		} else {
+		if found.flag == FOUND_MULTIPLE {
 			e.tabPresses++
 			if e.tabPresses == 1 {
 				fmt.Printf("\a")
@@ -277,8 +481,9 @@ func (e *Editor) handleAutoComplete() {
 				return
 
 			} else {
-				// print all commands with shared prefixes
-				e.autoComplete.printWordsWithSharedPrefixes(string(e.Input))
+				// show all the candidates, Tab again goes through them
+				e.showCompletions(found)
+				return
 			}
 		}
 	}
@@ -293,3 +498,52 @@ func (e *Editor) panicOnErr(msg string, err error) {
 		log.Panicf("Editor: %s: %s\n", msg, err.Error())
 	}
 }
+
+// editAndExecute opens the line in $VISUAL or $EDITOR, vi without
+// them, and runs what was saved like bash does, nothing runs when
+// the editor fails
+func (e *Editor) editAndExecute() bool {
+	f, err := os.CreateTemp("", "goshell-edit-*.sh")
+	if err != nil {
+		fmt.Print("\a")
+		return true
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	_, err = f.WriteString(string(e.Input) + "\n")
+	f.Close()
+	if err != nil {
+		fmt.Print("\a")
+		return true
+	}
+
+	editor := "vi"
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if value, found := e.lookup(name); found && strings.TrimSpace(value) != "" {
+			editor = value
+			break
+		}
+	}
+	args := append(strings.Fields(editor), path)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	e.newLine()
+	e.disableRawMode()
+	err = cmd.Run()
+	e.enableRawMode()
+
+	edited, readErr := os.ReadFile(path)
+	if err != nil || readErr != nil {
+		if _, isExit := err.(*exec.ExitError); err != nil && !isExit {
+			fmt.Fprintf(os.Stderr, "bash: %s: %v\r\n", args[0], err)
+		}
+		e.refreshLine()
+		return true
+	}
+
+	e.setInput([]rune(strings.TrimRight(string(edited), "\n")))
+	e.refreshLine()
+	e.Input = append(e.Input, '\n') // for parser
+	return false
+}
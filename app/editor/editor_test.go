@@ -0,0 +1,78 @@
+package editor
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newTestEditor is an editor drawing nowhere with the lines of
+// history, keys are given to it with typeKeys
+func newTestEditor(t testing.TB, history ...string) *Editor {
+	t.Helper()
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	assertNoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = null
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		null.Close()
+	})
+
+	noVars := func(name string) (string, bool) {
+		// no history file either
+		return "", name == "HISTFILE"
+	}
+	e := &Editor{
+		autoComplete:  newAutoComplete(),
+		config:        &config{},
+		rbuf:          bufio.NewReader(strings.NewReader("")),
+		keys:          make(chan keyRead, 1),
+		cols:          80,
+		history:       NewHistory(),
+		modeIndicator: func(Mode) string { return "" },
+		lookup:        noVars,
+		bindings:      NewBindings(),
+	}
+	e.SetLookup(noVars)
+	for _, line := range history {
+		assertNoError(t, e.history.Add(line))
+	}
+	e.ps = "$ "
+	e.historyIndex = e.history.len()
+	return e
+}
+
+// typeKeys handles keys the way TakeInput does, each string is what
+// the terminal sends at once so "\x1b" alone is Esc while "\x1bb" is
+// Alt-B, it returns false once a key ended the line
+func typeKeys(e *Editor, writes ...string) bool {
+	for _, w := range writes {
+		r := bufio.NewReader(strings.NewReader(w))
+		for {
+			c, err := decodeKey(r)
+			if err != nil {
+				break
+			}
+			e.pending = append(e.pending, c)
+		}
+	}
+	for len(e.pending) > 0 {
+		if !e.processKeyPress() {
+			return false
+		}
+		e.refreshLine()
+	}
+	return true
+}
+
+// assertLine checks the line being edited and the cursor, the | in
+// want is where the cursor is
+func assertLine(t testing.TB, want string, e *Editor) {
+	t.Helper()
+	got := string(e.Input[:e.cursor]) + "|" + string(e.Input[e.cursor:])
+	if got != want {
+		t.Errorf("Wanted %q, Got %q", want, got)
+	}
+}
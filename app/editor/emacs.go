@@ -0,0 +1,181 @@
+package editor
+
+import (
+	"fmt"
+	"slices"
+	"unicode"
+)
+
+// number of killed texts kept in the kill ring
+const killRingSize = 10
+
+// editCmd is the kind of the last key, the kill ring and undo
+// do something different after some of them
+type editCmd int
+
+const (
+	cmdOther editCmd = iota
+	cmdInsert
+	cmdKill
+	cmdYank
+	cmdUndo
+)
+
+// editState is the line and the cursor at some point
+type editState struct {
+	input  []rune
+	cursor int
+}
+
+// yankState is where the last yanked text is in the line
+// and which text of the kill ring it is
+type yankState struct {
+	start, end int
+	index      int
+}
+
+func isWordChar(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char)
+}
+
+// wordStart is where the word before the cursor starts,
+// words are made of letters and digits
+func (e *Editor) wordStart() int {
+	at := e.cursor
+	for at > 0 && !isWordChar(e.Input[at-1]) {
+		at--
+	}
+	for at > 0 && isWordChar(e.Input[at-1]) {
+		at--
+	}
+	return at
+}
+
+// wordEnd is where the word after the cursor ends
+func (e *Editor) wordEnd() int {
+	at := e.cursor
+	for at < len(e.Input) && !isWordChar(e.Input[at]) {
+		at++
+	}
+	for at < len(e.Input) && isWordChar(e.Input[at]) {
+		at++
+	}
+	return at
+}
+
+// unixWordStart is where the word before the cursor starts,
+// words being separated by whitespace like Ctrl-W in a terminal
+func (e *Editor) unixWordStart() int {
+	at := e.cursor
+	for at > 0 && unicode.IsSpace(e.Input[at-1]) {
+		at--
+	}
+	for at > 0 && !unicode.IsSpace(e.Input[at-1]) {
+		at--
+	}
+	return at
+}
+
+// moveWord moves the cursor to the end of the next word
+// or the start of the previous one
+func (e *Editor) moveWord(forward bool) {
+	if forward {
+		e.cursor = e.wordEnd()
+	} else {
+		e.cursor = e.wordStart()
+	}
+}
+
+// killTo removes the text between the cursor and at and puts it in
+// the kill ring, kills right after another add to the same text
+func (e *Editor) killTo(at int) {
+	from, to := min(e.cursor, at), max(e.cursor, at)
+	if from == to {
+		e.lastCmd = cmdKill
+		return
+	}
+	killed := slices.Clone(e.Input[from:to])
+
+	if e.prevCmd == cmdKill && len(e.killRing) > 0 {
+		last := &e.killRing[len(e.killRing)-1]
+		if at < e.cursor {
+			*last = append(killed, *last...)
+		} else {
+			*last = append(*last, killed...)
+		}
+	} else {
+		e.killRing = append(e.killRing, killed)
+		if len(e.killRing) > killRingSize {
+			e.killRing = e.killRing[1:]
+		}
+	}
+
+	e.Input = slices.Delete(e.Input, from, to)
+	e.cursor = from
+	e.lastCmd = cmdKill
+}
+
+// yank inserts the last killed text
+func (e *Editor) yank() {
+	if len(e.killRing) == 0 {
+		fmt.Print("\a")
+		return
+	}
+	e.yankText(len(e.killRing) - 1)
+}
+
+// yankPop replaces the text just yanked with the one killed before it
+func (e *Editor) yankPop() {
+	if e.prevCmd != cmdYank || len(e.killRing) == 0 {
+		fmt.Print("\a")
+		return
+	}
+	e.Input = slices.Delete(e.Input, e.yanked.start, e.yanked.end)
+	e.cursor = e.yanked.start
+	e.yankText((e.yanked.index - 1 + len(e.killRing)) % len(e.killRing))
+}
+
+func (e *Editor) yankText(index int) {
+	start := e.cursor
+	e.insertString(string(e.killRing[index]))
+	e.yanked = yankState{start: start, end: e.cursor, index: index}
+	e.lastCmd = cmdYank
+}
+
+// transpose swaps the characters before and under the cursor and
+// moves past them, at the end of the line the last two are swapped
+func (e *Editor) transpose() {
+	at := e.cursor
+	if at == 0 || len(e.Input) < 2 {
+		fmt.Print("\a")
+		return
+	}
+	if at == len(e.Input) {
+		at--
+	}
+	e.Input[at-1], e.Input[at] = e.Input[at], e.Input[at-1]
+	e.cursor = at + 1
+}
+
+// recordUndo remembers the line as it was before a key that changed it,
+// the characters typed one after the other are undone together
+func (e *Editor) recordUndo(before editState) {
+	if e.lastCmd == cmdUndo || slices.Equal(before.input, e.Input) {
+		return
+	}
+	if e.lastCmd == cmdInsert && e.prevCmd == cmdInsert {
+		return
+	}
+	e.undo = append(e.undo, before)
+}
+
+// undoEdit puts the line back as it was before the last change
+func (e *Editor) undoEdit() {
+	if len(e.undo) == 0 {
+		fmt.Print("\a")
+		return
+	}
+	last := e.undo[len(e.undo)-1]
+	e.undo = e.undo[:len(e.undo)-1]
+	e.Input, e.cursor = last.input, last.cursor
+}
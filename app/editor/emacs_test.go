@@ -0,0 +1,68 @@
+package editor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmacsKeys(t *testing.T) {
+	table := []struct {
+		name   string
+		writes []string
+		// the line with | for the cursor
+		want string
+	}{
+		{"ctrl-k kills to the end", []string{"one two\x02\x02\x02\x0b"}, "one |"},
+		{"ctrl-u kills to the start", []string{"one two\x02\x02\x02\x15"}, "|two"},
+		{"ctrl-w kills a unix word", []string{"a b/c d\x17\x17"}, "a |"},
+		{"alt-d kills a word forward", []string{"one two three\x01", "\x1bd", "\x1bd"}, "| three"},
+		{"alt-backspace kills a word backward", []string{"one two-three", "\x1b\x7f"}, "one two-|"},
+		{"ctrl-y yanks the last kill", []string{"one two\x17\x01\x19"}, "two|one "},
+		{"ctrl-y without kills rings", []string{"ab\x19"}, "ab|"},
+		{"backward kills in a row prepend", []string{"one two three\x17\x17\x19\x19"}, "one two threetwo three|"},
+		{"forward kills in a row append", []string{"one two three\x01", "\x1bd", "\x1bd", "\x05\x19"}, " threeone two|"},
+		{"mixed directions join", []string{"one two three\x02\x02\x02\x0b\x17\x19"}, "one two three|"},
+		{"a move starts a new kill", []string{"one two\x17\x02\x17\x05\x19"}, " one|"},
+		{"alt-y yanks the kill before", []string{"one two\x17\x02\x17\x19", "\x1by"}, "two| "},
+		{"alt-y wraps around to the last kill", []string{"a b c\x17\x02\x17\x02\x17\x19", "\x1by", "\x1by", "\x1by"}, "a|  "},
+		{"alt-y after another key rings", []string{"one\x17\x19x", "\x1by"}, "onex|"},
+		{"ctrl-t swaps and moves on", []string{"abcd\x01\x06\x14"}, "ba|cd"},
+		{"ctrl-t at the end swaps the last two", []string{"abcd\x14"}, "abdc|"},
+		{"ctrl-t at the end repeats the swap", []string{"abcd\x14\x14"}, "abcd|"},
+		{"ctrl-t at the start rings", []string{"ab\x01\x14"}, "|ab"},
+		{"ctrl-t on one character rings", []string{"a\x14"}, "a|"},
+		{"undo takes back typed characters at once", []string{"one two\x1f"}, "|"},
+		{"undo goes back one change at a time", []string{"one two\x17three\x1f"}, "one |"},
+		{"undo twice", []string{"one two\x17three\x1f\x1f"}, "one two|"},
+		{"moves don't split typing", []string{"ab\x02c\x1f"}, "a|b"},
+		{"undo a yank", []string{"one\x17\x19\x19\x1f"}, "one|"},
+		{"undo a transpose", []string{"abc\x14\x1f"}, "abc|"},
+		{"ctrl-x ctrl-u undoes too", []string{"ab\x15\x18\x15"}, "ab|"},
+		{"nothing to undo rings", []string{"\x1f"}, "|"},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			e := newTestEditor(t)
+			typeKeys(e, entry.writes...)
+			assertLine(t, entry.want, e)
+		})
+	}
+}
+
+func TestKillRingSize(t *testing.T) {
+	e := newTestEditor(t)
+	for i := range killRingSize + 2 {
+		// typing between kills keeps them apart
+		typeKeys(e, strings.Repeat("x", i+1)+"\x17")
+	}
+	assertEqual(t, killRingSize, len(e.killRing))
+	assertEqual(t, "xxx", string(e.killRing[0]))
+
+	// the oldest kills are gone, alt-y comes back to the newest
+	typeKeys(e, "\x19")
+	for range killRingSize {
+		typeKeys(e, "\x1by")
+	}
+	assertLine(t, strings.Repeat("x", killRingSize+2)+"|", e)
+}
@@ -0,0 +1,208 @@
+package editor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// history file used when HISTFILE is not set, relative to $HOME
+const defaultHistFile = ".goshell_history"
+
+// histFile is the path of the history file, empty
+// when HISTFILE is set to nothing to not keep one
+func (h *History) histFile() string {
+	if path, found := h.lookup("HISTFILE"); found {
+		return path
+	}
+	home, found := h.lookup("HOME")
+	if !found {
+		home, _ = os.UserHomeDir()
+	}
+	return filepath.Join(home, defaultHistFile)
+}
+
+// Load reads the history file, the lines of other sessions
+// become the oldest entries of this one
+func (h *History) Load() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	path := h.histFile()
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return historyError(err)
+	}
+	defer f.Close()
+
+	// shared lock so a shell writing the file doesn't interleave
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_SH); err != nil {
+		return historyError(err)
+	}
+	defer unix.Flock(int(f.Fd()), unix.LOCK_UN)
+
+	entries, err := readHistory(f)
+	if err != nil {
+		return historyError(err)
+	}
+	h.entries = append(entries, h.entries...)
+	h.trim(h.sizeVar("HISTSIZE", defaultHistorySize))
+	return nil
+}
+
+// appendFile adds entry to the end of the history file under an exclusive
+// lock, so concurrent shells add their lines without clobbering each other,
+// the file is then truncated to HISTFILESIZE entries
+func (h *History) appendFile(entry HistoryEntry) error {
+	path := h.histFile()
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return historyError(err)
+	}
+	defer f.Close()
+
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		return historyError(err)
+	}
+	defer unix.Flock(int(f.Fd()), unix.LOCK_UN)
+
+	if _, err := io.WriteString(f, formatEntry(entry)); err != nil {
+		return historyError(err)
+	}
+
+	limit := h.sizeVar("HISTFILESIZE", h.sizeVar("HISTSIZE", defaultHistorySize))
+	if limit < 0 {
+		return nil
+	}
+	if err := truncateHistory(f, limit); err != nil {
+		return historyError(err)
+	}
+	return nil
+}
+
+// truncateHistory keeps the last limit entries of the locked file f
+func truncateHistory(f *os.File, limit int) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	entries, err := readHistory(f)
+	if err != nil || len(entries) <= limit {
+		return err
+	}
+
+	var sb strings.Builder
+	for _, entry := range entries[len(entries)-limit:] {
+		sb.WriteString(formatEntry(entry))
+	}
+	// rewritten in place, the lock is on this very file
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, sb.String())
+	return err
+}
+
+// formatEntry writes an entry the way bash does with HISTTIMEFORMAT
+// set, a comment with the time followed by the line itself, the comment
+// also has the number of lines of the entry when it's on several lines
+// or could be taken for a timestamp, so they all read back as this entry
+func formatEntry(entry HistoryEntry) string {
+	if entry.Time.IsZero() {
+		return entry.Line + "\n"
+	}
+	lines := strings.Count(entry.Line, "\n") + 1
+	if _, _, isStamp := parseStamp(entry.Line); lines == 1 && !isStamp {
+		return fmt.Sprintf("#%d\n%s\n", entry.Time.Unix(), entry.Line)
+	}
+	return fmt.Sprintf("#%d %d\n%s\n", entry.Time.Unix(), lines, entry.Line)
+}
+
+// readHistory parses a history file, lines without a timestamp comment
+// before them get the zero time, a timestamp with a number of lines is
+// followed by exactly that many lines, whatever they look like, the lines
+// after one without are one entry until the next timestamp, as bash writes
+// the commands on several lines
+func readHistory(r io.Reader) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
+	var stamp time.Time
+	stamped := false
+	// blank lines are kept only between lines of the same entry
+	blanks := []string{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if seconds, count, isStamp := parseStamp(line); isStamp {
+			stamp = time.Unix(seconds, 0)
+			stamped = false
+			blanks = blanks[:0]
+			if count == 0 {
+				continue
+			}
+			body := []string{}
+			for len(body) < count && scanner.Scan() {
+				body = append(body, scanner.Text())
+			}
+			entries = append(entries, HistoryEntry{Line: strings.Join(body, "\n"), Time: stamp})
+			stamp = time.Time{}
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			blanks = append(blanks, line)
+			continue
+		}
+		if stamped {
+			entries[len(entries)-1].Line += "\n" + strings.Join(append(blanks, line), "\n")
+			blanks = blanks[:0]
+			continue
+		}
+		blanks = blanks[:0]
+		entries = append(entries, HistoryEntry{Line: line, Time: stamp})
+		stamped = !stamp.IsZero()
+		stamp = time.Time{}
+	}
+	return entries, scanner.Err()
+}
+
+// parseStamp reads a timestamp comment like #1700000000, or like
+// #1700000000 3 for an entry of 3 lines, lines is 0 without the number
+func parseStamp(line string) (seconds int64, lines int, isStamp bool) {
+	if len(line) < 2 || line[0] != '#' || line[1] < '0' || line[1] > '9' {
+		return 0, 0, false
+	}
+	stamp, count, counted := strings.Cut(line[1:], " ")
+	seconds, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if counted {
+		lines, err = strconv.Atoi(count)
+		if err != nil || lines < 1 {
+			return 0, 0, false
+		}
+	}
+	return seconds, lines, true
+}
+
+func historyError(err error) error {
+	return fmt.Errorf("bash: history: %w", err)
+}
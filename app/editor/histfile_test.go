@@ -0,0 +1,149 @@
+package editor
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryFile(t *testing.T) {
+	t.Run("formatEntry should write the timestamp before the line", func(t *testing.T) {
+		table := []struct {
+			line string
+			time time.Time
+			want string
+		}{
+			{"echo hi", time.Unix(1700000000, 0), "#1700000000\necho hi\n"},
+			{"echo 'a\nb'", time.Unix(100, 0), "#100 2\necho 'a\nb'\n"},
+			{"#123", time.Unix(100, 0), "#100 1\n#123\n"},
+			{"# a comment", time.Unix(100, 0), "#100\n# a comment\n"},
+			{"ls", time.Time{}, "ls\n"},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.line, func(t *testing.T) {
+				assertEqual(t, entry.want, formatEntry(HistoryEntry{Line: entry.line, Time: entry.time}))
+			})
+		}
+	})
+
+	t.Run("readHistory should read back what formatEntry writes", func(t *testing.T) {
+		entries := []HistoryEntry{
+			{Line: "ls"},
+			{Line: "cat <<EOF\na\n\nb\nEOF", Time: time.Unix(100, 0)},
+			{Line: "#123", Time: time.Unix(200, 0)},
+			{Line: "echo 'a\n#456\n'", Time: time.Unix(300, 0)},
+			{Line: "  \npwd", Time: time.Unix(400, 0)},
+			{Line: "echo hi", Time: time.Unix(500, 0)},
+		}
+
+		var sb strings.Builder
+		for _, entry := range entries {
+			sb.WriteString(formatEntry(entry))
+		}
+		got, err := readHistory(strings.NewReader(sb.String()))
+		assertNoError(t, err)
+		assertEqual(t, entries, got)
+	})
+
+	t.Run("readHistory should parse timestamps and plain lines", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  []HistoryEntry
+		}{
+			{"", []HistoryEntry{}},
+			{"ls\npwd\n", []HistoryEntry{{Line: "ls"}, {Line: "pwd"}}},
+			{"#100\nls\n#200\npwd\n", []HistoryEntry{
+				{Line: "ls", Time: time.Unix(100, 0)},
+				{Line: "pwd", Time: time.Unix(200, 0)},
+			}},
+			{"ls\n#100\npwd\n", []HistoryEntry{{Line: "ls"}, {Line: "pwd", Time: time.Unix(100, 0)}}},
+			{"#100\necho 'a\nb'\n#200\nls\n", []HistoryEntry{
+				{Line: "echo 'a\nb'", Time: time.Unix(100, 0)},
+				{Line: "ls", Time: time.Unix(200, 0)},
+			}},
+			{"# a comment\nls\n", []HistoryEntry{{Line: "# a comment"}, {Line: "ls"}}},
+			{"#100\necho 'a\n\nb'\n\n#200\nls\n", []HistoryEntry{
+				{Line: "echo 'a\n\nb'", Time: time.Unix(100, 0)},
+				{Line: "ls", Time: time.Unix(200, 0)},
+			}},
+			{"#100 2\n#1\n\n#200 1\n#2\nls\n", []HistoryEntry{
+				{Line: "#1\n", Time: time.Unix(100, 0)},
+				{Line: "#2", Time: time.Unix(200, 0)},
+				{Line: "ls"},
+			}},
+			{"#100 x\nls\n", []HistoryEntry{{Line: "#100 x"}, {Line: "ls"}}},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				got, err := readHistory(strings.NewReader(entry.input))
+				assertNoError(t, err)
+				assertEqual(t, entry.want, got)
+			})
+		}
+	})
+
+	t.Run("truncateHistory should keep the last entries", func(t *testing.T) {
+		table := []struct {
+			limit int
+			want  []string
+		}{
+			{5, []string{"a", "b", "c"}},
+			{3, []string{"a", "b", "c"}},
+			{2, []string{"b", "c"}},
+			{0, []string{}},
+		}
+
+		for _, entry := range table {
+			t.Run(strings.Join(entry.want, ","), func(t *testing.T) {
+				f, err := os.Create(filepath.Join(t.TempDir(), "history"))
+				assertNoError(t, err)
+				defer f.Close()
+				for i, line := range []string{"a", "b", "c"} {
+					_, err := io.WriteString(f, formatEntry(HistoryEntry{Line: line, Time: time.Unix(int64(i+1), 0)}))
+					assertNoError(t, err)
+				}
+
+				assertNoError(t, truncateHistory(f, entry.limit))
+				_, err = f.Seek(0, io.SeekStart)
+				assertNoError(t, err)
+				entries, err := readHistory(f)
+				assertNoError(t, err)
+				lines := []string{}
+				for _, e := range entries {
+					lines = append(lines, e.Line)
+				}
+				assertEqual(t, entry.want, lines)
+			})
+		}
+	})
+}
+
+func TestHistorySize(t *testing.T) {
+	table := []struct {
+		value string
+		set   bool
+		want  int
+	}{
+		{"", false, defaultHistorySize},
+		{"10", true, 10},
+		{"0", true, 0},
+		{"-1", true, -1},
+		{"many", true, defaultHistorySize},
+		{"", true, defaultHistorySize},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.value, func(t *testing.T) {
+			h := NewHistory()
+			h.SetLookup(func(name string) (string, bool) {
+				return entry.value, entry.set && name == "HISTSIZE"
+			})
+			assertEqual(t, entry.want, h.sizeVar("HISTSIZE", defaultHistorySize))
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default number of remembered lines, the one of bash
+const defaultHistorySize = 500
+
+// HistoryEntry is a line of the history and when it was entered,
+// the zero time when it was read from a file without timestamps
+type HistoryEntry struct {
+	Line string
+	Time time.Time
+}
+
+// History is a ring of the last lines entered, once it's full adding
+// a line drops the oldest one, every line is also appended to HISTFILE
+type History struct {
+	mu      sync.Mutex
+	entries []HistoryEntry
+	// number of the first entry, lines keep their number
+	// as older ones are dropped
+	first int
+
+	// lookup returns the variables configuring the history,
+	// the environment until the shell provides its variables
+	lookup func(name string) (string, bool)
+}
+
+func NewHistory() *History {
+	return &History{first: 1, lookup: os.LookupEnv}
+}
+
+// SetLookup changes where HISTFILE, HISTSIZE, HISTFILESIZE
+// and HISTCONTROL are read from
+func (h *History) SetLookup(lookup func(name string) (string, bool)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lookup = lookup
+}
+
+// Add remembers a line and appends it to the history file, blank lines
+// and the ones HISTCONTROL says to ignore are not remembered
+func (h *History) Add(line string) error {
+	line = strings.TrimRight(line, "\n")
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	size := h.sizeVar("HISTSIZE", defaultHistorySize)
+	if size == 0 {
+		return nil
+	}
+
+	control, _ := h.lookup("HISTCONTROL")
+	for option := range strings.SplitSeq(control, ":") {
+		switch option {
+		case "ignorespace", "ignoreboth":
+			if line[0] == ' ' {
+				return nil
+			}
+		}
+		switch option {
+		case "ignoredups", "ignoreboth":
+			if n := len(h.entries); n > 0 && h.entries[n-1].Line == line {
+				return nil
+			}
+		case "erasedups":
+			h.entries = slices.DeleteFunc(h.entries, func(entry HistoryEntry) bool {
+				return entry.Line == line
+			})
+		}
+	}
+
+	entry := HistoryEntry{Line: line, Time: time.Now()}
+	h.entries = append(h.entries, entry)
+	h.trim(size)
+
+	return h.appendFile(entry)
+}
+
+// trim drops the oldest entries above size, a negative size has no limit
+func (h *History) trim(size int) {
+	if drop := len(h.entries) - size; size >= 0 && drop > 0 {
+		h.entries = h.entries[drop:]
+		h.first += drop
+	}
+}
+
+// sizeVar reads a size variable like HISTSIZE, a negative
+// value means no limit and one that isn't a number is unset
+func (h *History) sizeVar(name string, fallback int) int {
+	value, found := h.lookup(name)
+	if !found {
+		return fallback
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return size
+}
+
+// Entries returns the remembered lines from the oldest,
+// first is the number of the oldest one
+func (h *History) Entries() (first int, entries []HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.first, slices.Clone(h.entries)
+}
+
+// Clear forgets every line, numbering starts again from 1,
+// the history file is left as it is
+func (h *History) Clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = nil
+	h.first = 1
+}
+
+func (h *History) len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.entries)
+}
+
+func (h *History) at(i int) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.entries[i].Line
+}
+
+// historyMove replaces the line with the previous (ARROW_UP) or next
+// (ARROW_DOWN) line of the history, the line being typed is kept aside
+// and comes back when moving down past the newest entry
+func (e *Editor) historyMove(arrow int) {
+	last := e.history.len()
+	if e.historyIndex > last {
+		e.historyIndex = last
+	}
+
+	switch {
+	case arrow == ARROW_UP && e.historyIndex > 0:
+		if e.historyIndex == last {
+			e.draft = e.Input
+		}
+		e.historyIndex--
+		e.setInput([]rune(e.history.at(e.historyIndex)))
+
+	case arrow == ARROW_DOWN && e.historyIndex < last:
+		e.historyIndex++
+		if e.historyIndex == last {
+			e.setInput(e.draft)
+		} else {
+			e.setInput([]rune(e.history.at(e.historyIndex)))
+		}
+
+	default:
+		fmt.Print("\a")
+	}
+}
+
+// historyJump replaces the line with the i-th entry of the
+// history, the line being typed for its length
+func (e *Editor) historyJump(i int) {
+	last := e.history.len()
+	if e.historyIndex >= last {
+		e.historyIndex = last
+		e.draft = e.Input
+	}
+	e.historyIndex = i
+	if i >= last {
+		e.setInput(e.draft)
+	} else {
+		e.setInput([]rune(e.history.at(i)))
+	}
+}
+
+// historySearch moves to the previous or next entry starting with
+// the text before the cursor, which stays where it is
+func (e *Editor) historySearch(forward bool) {
+	prefix := string(e.Input[:e.cursor])
+	last := e.history.len()
+	step := -1
+	if forward {
+		step = 1
+	}
+	for i := min(e.historyIndex, last) + step; i >= 0 && i <= last; i += step {
+		if line := string(e.searchLine(i)); strings.HasPrefix(line, prefix) && line != string(e.Input) {
+			at := e.cursor
+			e.historyJump(i)
+			e.cursor = min(at, len(e.Input))
+			return
+		}
+	}
+	fmt.Print("\a")
+}
+
+// setInput replaces the whole line and moves the cursor to its end
+func (e *Editor) setInput(line []rune) {
+	e.Input = slices.Clone(line)
+	e.cursor = len(e.Input)
+}
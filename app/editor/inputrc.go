@@ -0,0 +1,457 @@
+package editor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// inputrc file used when INPUTRC is not set, relative to $HOME
+const defaultInputrc = ".inputrc"
+
+// keySequences are the escape sequences of the keys readKey decodes,
+// each of them is written with the first sequence it's decoded from
+var keySequences = map[int]string{
+	ARROW_UP: `\e[A`, ARROW_DOWN: `\e[B`, ARROW_RIGHT: `\e[C`, ARROW_LEFT: `\e[D`,
+	HOME_KEY: `\e[H`, END_KEY: `\e[F`, DEL_KEY: `\e[3~`,
+	PAGE_UP: `\e[5~`, PAGE_DOWN: `\e[6~`, SHIFT_TAB: `\e[Z`,
+}
+
+// keyNames are the names of keys in the inputrc file like in RET: accept-line
+var keyNames = map[string]byte{
+	"del": 127, "rubout": 127, "esc": '\x1b', "escape": '\x1b',
+	"lfd": '\n', "newline": '\n', "ret": '\r', "return": '\r',
+	"spc": ' ', "space": ' ', "tab": '\t',
+}
+
+// LoadInputrc reads the key bindings of $INPUTRC, ~/.inputrc by default
+func (b *Bindings) LoadInputrc() error {
+	path, found := b.lookup("INPUTRC")
+	if !found {
+		home, found := b.lookup("HOME")
+		if !found {
+			home, _ = os.UserHomeDir()
+		}
+		path = filepath.Join(home, defaultInputrc)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	return b.ReadFile("", path)
+}
+
+// ReadFile reads the bindings of an inputrc file into keymap, the
+// current one when it's empty, the lines with errors are skipped
+func (b *Bindings) ReadFile(keymap, path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := &inputrcParser{b: b, keymap: keymap}
+	return p.readFile(path)
+}
+
+// inputrcParser reads the lines of an inputrc file, set keymap
+// changes the keymap of the lines after it
+type inputrcParser struct {
+	b      *Bindings
+	keymap string
+	// for each $if the lines are in, whether they are skipped
+	skip []bool
+}
+
+func (p *inputrcParser) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: cannot read: %w", path, errors.Unwrap(err))
+	}
+
+	errs := []error{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		if err := p.parseLine(scanner.Text()); err != nil {
+			errs = append(errs, fmt.Errorf("readline: %s: line %d: %w", path, n, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *inputrcParser) skipping() bool {
+	return len(p.skip) > 0 && p.skip[len(p.skip)-1]
+}
+
+// parseLine reads a line of the file, a comment, a $ directive,
+// a set command or a key binding
+func (p *inputrcParser) parseLine(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return nil
+	}
+	if line[0] == '$' {
+		return p.directive(line[1:])
+	}
+	if p.skipping() {
+		return nil
+	}
+
+	if fields := strings.Fields(line); fields[0] == "set" {
+		if len(fields) < 3 {
+			return nil
+		}
+		return p.set(fields[1], fields[2])
+	}
+
+	keys, rest, err := p.parseKeys(line)
+	if err != nil {
+		return err
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	if rest == "" || rest[0] != ':' {
+		return fmt.Errorf("`%s': missing colon", line)
+	}
+	rest = strings.TrimSpace(rest[1:])
+
+	km, err := p.b.keymap(p.keymap)
+	if err != nil {
+		return err
+	}
+	if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+		text, _, err := quotedString(rest)
+		if err != nil {
+			return err
+		}
+		macro, err := translateKeyseq(text)
+		if err != nil {
+			return err
+		}
+		km.bind(keys, binding{macro: macro})
+		return nil
+	}
+
+	function := ""
+	if fields := strings.Fields(rest); len(fields) > 0 {
+		function = fields[0]
+	}
+	if _, found := actions[function]; !found {
+		return fmt.Errorf("`%s': unknown function name", function)
+	}
+	km.bind(keys, binding{function: function})
+	return nil
+}
+
+// parseKeys reads the keys at the start of a binding, a quoted
+// sequence like "\C-a" or a key name like Control-a, and the
+// rest of the line after them
+func (p *inputrcParser) parseKeys(line string) ([]int, string, error) {
+	if line[0] == '"' || line[0] == '\'' {
+		text, rest, err := quotedString(line)
+		if err != nil {
+			return nil, "", err
+		}
+		seq, err := translateKeyseq(text)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(seq) == 0 {
+			return nil, "", fmt.Errorf("`%s': empty key sequence", line)
+		}
+		return decodeKeys(seq), rest, nil
+	}
+
+	// the name may be a colon itself, like in Control-:
+	colon := strings.IndexByte(line[1:], ':') + 1
+	if colon == 0 {
+		return nil, "", fmt.Errorf("`%s': missing colon", line)
+	}
+	name := strings.TrimSpace(line[:colon])
+	seq, err := translateKeyname(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return decodeKeys(seq), line[colon:], nil
+}
+
+// set handles the variables of the file, editing-mode and keymap,
+// the other ones of readline are accepted and ignored
+func (p *inputrcParser) set(name, value string) error {
+	switch strings.ToLower(name) {
+	case "editing-mode":
+		switch value {
+		case "emacs":
+			p.keymap = "emacs"
+		case "vi":
+			p.keymap = "vi-insert"
+		default:
+			return fmt.Errorf("%s: invalid value for editing-mode", value)
+		}
+		p.b.editingMode = value
+	case "keymap":
+		if _, found := keymapNames[value]; !found {
+			return fmt.Errorf("`%s': invalid keymap name", value)
+		}
+		p.keymap = value
+	}
+	return nil
+}
+
+// directive handles $if, $else, $endif and $include, $if knows
+// mode=emacs or mode=vi, term=name and the application name Bash
+func (p *inputrcParser) directive(line string) error {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "if":
+		if p.skipping() {
+			p.skip = append(p.skip, true)
+			return nil
+		}
+		p.skip = append(p.skip, !p.condition(arg))
+	case "else":
+		if len(p.skip) == 0 {
+			return errors.New("$else found without matching $if")
+		}
+		// the lines are still skipped when the whole $if is
+		outer := len(p.skip) > 1 && p.skip[len(p.skip)-2]
+		p.skip[len(p.skip)-1] = outer || !p.skip[len(p.skip)-1]
+	case "endif":
+		if len(p.skip) == 0 {
+			return errors.New("$endif without matching $if")
+		}
+		p.skip = p.skip[:len(p.skip)-1]
+	case "include":
+		if p.skipping() {
+			return nil
+		}
+		if strings.HasPrefix(arg, "~/") {
+			home, _ := p.b.lookup("HOME")
+			arg = filepath.Join(home, arg[2:])
+		}
+		included := &inputrcParser{b: p.b, keymap: p.keymap}
+		return included.readFile(arg)
+	default:
+		return fmt.Errorf("unknown parser directive: $%s", name)
+	}
+	return nil
+}
+
+func (p *inputrcParser) condition(test string) bool {
+	switch {
+	case strings.HasPrefix(test, "mode="):
+		mode := "emacs"
+		if keymap, _ := p.b.keymap(p.keymap); keymap != p.b.keymaps["emacs"] {
+			mode = "vi"
+		}
+		return test[len("mode="):] == mode
+	case strings.HasPrefix(test, "term="):
+		term, _ := p.b.lookup("TERM")
+		want := test[len("term="):]
+		short, _, _ := strings.Cut(term, "-")
+		return want == term || want == short
+	}
+	return strings.EqualFold(test, "bash")
+}
+
+// quotedString returns the text of the string quoted at the start
+// of s, backslashes are kept for translateKeyseq, and what follows it
+func quotedString(s string) (string, string, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return s[1:i], s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("%s: no closing `%c' in key binding", s, quote)
+}
+
+// translateKeyseq turns the escapes of a quoted key sequence
+// or macro like \C-x, \M-x, \e or \t into the bytes they are
+func translateKeyseq(s string) ([]byte, error) {
+	seq := []byte{}
+	for i := 0; i < len(s); {
+		key, next, err := translateKey(s, i)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, key...)
+		i = next
+	}
+	return seq, nil
+}
+
+// translateKey translates the key at s[i], \C- and \M- apply to the
+// key after them, which can be escaped too like in \M-\C-h
+func translateKey(s string, i int) ([]byte, int, error) {
+	if s[i] != '\\' || i+1 >= len(s) {
+		return []byte{s[i]}, i + 1, nil
+	}
+	i++
+	char := s[i]
+
+	if (char == 'C' || char == 'M') && i+2 < len(s) && s[i+1] == '-' {
+		key, next, err := translateKey(s, i+2)
+		if err != nil {
+			return nil, 0, err
+		}
+		if char == 'M' {
+			return append([]byte{'\x1b'}, key...), next, nil
+		}
+		last := len(key) - 1
+		key[last] = controlKey(key[last])
+		return key, next, nil
+	}
+
+	escapes := map[byte]byte{
+		'a': '\a', 'b': '\b', 'd': 127, 'e': '\x1b', 'f': '\f',
+		'n': '\n', 'r': '\r', 't': '\t', 'v': '\v',
+	}
+	switch {
+	case escapes[char] != 0:
+		return []byte{escapes[char]}, i + 1, nil
+	case char >= '0' && char <= '7':
+		end := i
+		for end < len(s) && end < i+3 && s[end] >= '0' && s[end] <= '7' {
+			end++
+		}
+		n, _ := strconv.ParseUint(s[i:end], 8, 8)
+		return []byte{byte(n)}, end, nil
+	case char == 'x':
+		end := i + 1
+		for end < len(s) && end < i+3 && strings.IndexByte("0123456789abcdefABCDEF", s[end]) >= 0 {
+			end++
+		}
+		n, err := strconv.ParseUint(s[i+1:end], 16, 8)
+		if err != nil {
+			return nil, 0, fmt.Errorf("`%s': invalid hex escape", s)
+		}
+		return []byte{byte(n)}, end, nil
+	}
+	// \\, \" and \' and any other escaped character are themselves
+	return []byte{char}, i + 1, nil
+}
+
+func controlKey(char byte) byte {
+	if char == '?' {
+		return 127
+	}
+	return char & 0x1f
+}
+
+// translateKeyname turns a key name like Control-u, Meta-Rubout or TAB
+// into its bytes
+func translateKeyname(name string) ([]byte, error) {
+	prefix := []byte{}
+	control := false
+	for {
+		lower := strings.ToLower(name)
+		switch {
+		case strings.HasPrefix(lower, "control-"):
+			control, name = true, name[len("control-"):]
+		case strings.HasPrefix(lower, "c-") && len(name) > 2:
+			control, name = true, name[len("c-"):]
+		case strings.HasPrefix(lower, "meta-"):
+			prefix, name = append(prefix, '\x1b'), name[len("meta-"):]
+		case strings.HasPrefix(lower, "m-") && len(name) > 2:
+			prefix, name = append(prefix, '\x1b'), name[len("m-"):]
+		default:
+			var char byte
+			if named, found := keyNames[lower]; found {
+				char = named
+			} else if len(name) == 1 {
+				char = name[0]
+			} else if utf8.RuneCountInString(name) == 1 && !control {
+				return append(prefix, name...), nil
+			} else {
+				return nil, fmt.Errorf("`%s': unknown key name", name)
+			}
+			if control {
+				char = controlKey(char)
+			}
+			return append(prefix, char), nil
+		}
+	}
+}
+
+// decodeKeys turns a sequence of bytes into the keys readKey
+// reads for them, escape sequences become a single key
+func decodeKeys(seq []byte) []int {
+	r := bufio.NewReader(bytes.NewReader(seq))
+	keys := []int{}
+	for {
+		c, err := decodeKey(r)
+		if err != nil {
+			return keys
+		}
+		keys = append(keys, c)
+	}
+}
+
+// formatKeys writes keys in the notation of the inputrc file
+func formatKeys(keys []int) string {
+	var sb strings.Builder
+	for _, c := range keys {
+		switch {
+		case keySequences[c] != "":
+			sb.WriteString(keySequences[c])
+		case c >= _ALT_KEY(0):
+			sb.WriteString(`\e` + formatRune(rune(c-_ALT_KEY(0))))
+		default:
+			sb.WriteString(formatRune(rune(c)))
+		}
+	}
+	return sb.String()
+}
+
+// formatBytes writes the text of a macro in the notation of the inputrc file,
+// the bytes that aren't UTF-8 in octal
+func formatBytes(text []byte) string {
+	var sb strings.Builder
+	for len(text) > 0 {
+		char, size := utf8.DecodeRune(text)
+		if char == utf8.RuneError && size == 1 {
+			sb.WriteString(formatByte(text[0]))
+		} else {
+			sb.WriteString(formatRune(char))
+		}
+		text = text[size:]
+	}
+	return sb.String()
+}
+
+// formatRune writes the characters past ASCII as they are
+func formatRune(char rune) string {
+	if char >= utf8.RuneSelf {
+		return string(char)
+	}
+	return formatByte(byte(char))
+}
+
+func formatByte(char byte) string {
+	switch {
+	case char == '\x1b':
+		return `\e`
+	case char == 127:
+		return `\C-?`
+	case char < ' ':
+		named := char + '@'
+		if named >= 'A' && named <= 'Z' {
+			named += 'a' - 'A'
+		}
+		if named == '\\' {
+			return `\C-\\`
+		}
+		return `\C-` + string(named)
+	case char == '"' || char == '\\':
+		return `\` + string(char)
+	case char >= 0x80:
+		return fmt.Sprintf(`\%03o`, char)
+	}
+	return string(char)
+}
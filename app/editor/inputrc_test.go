@@ -0,0 +1,210 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTranslateKeyseq(t *testing.T) {
+	t.Run("translateKeyseq should translate the escapes of key sequences", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  string
+		}{
+			{`abc`, "abc"},
+			{`\C-x\C-u`, "\x18\x15"},
+			{`\C-?`, "\x7f"},
+			{`\M-f`, "\x1bf"},
+			{`\M-\C-h`, "\x1b\x08"},
+			{`\C-\M-h`, "\x1b\x08"},
+			{`\e[A`, "\x1b[A"},
+			{`\a\b\d\f\n\r\t\v`, "\a\b\x7f\f\n\r\t\v"},
+			{`\101`, "A"},
+			{`\1010`, "A0"},
+			{`\0`, "\x00"},
+			{`\x41`, "A"},
+			{`\x4g`, "\x04g"},
+			{`\\\"\'`, `\"'`},
+			{`\q`, "q"},
+			{`a\`, `a\`},
+			{`\C-`, "C-"},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				got, err := translateKeyseq(entry.input)
+				assertNoError(t, err)
+				assertEqual(t, entry.want, string(got))
+			})
+		}
+	})
+
+	t.Run("translateKeyseq should reject a hex escape without digits", func(t *testing.T) {
+		if _, err := translateKeyseq(`\xg`); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+
+	t.Run("translateKeyname should translate key names", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  string
+		}{
+			{"Control-u", "\x15"},
+			{"C-a", "\x01"},
+			{"control-:", "\x1a"},
+			{"Meta-Rubout", "\x1b\x7f"},
+			{"M-x", "\x1bx"},
+			{"Meta-Control-h", "\x1b\x08"},
+			{"TAB", "\t"},
+			{"RET", "\r"},
+			{"Space", " "},
+			{"C", "C"},
+			{"é", "é"},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				got, err := translateKeyname(entry.input)
+				assertNoError(t, err)
+				assertEqual(t, entry.want, string(got))
+			})
+		}
+	})
+
+	t.Run("translateKeyname should reject unknown names", func(t *testing.T) {
+		for _, name := range []string{"Foo", "Control-é", "Meta-"} {
+			if _, err := translateKeyname(name); err == nil {
+				t.Errorf("Expected an error for %q", name)
+			}
+		}
+	})
+
+	t.Run("quotedString should keep escapes and return what follows", func(t *testing.T) {
+		table := []struct {
+			input, text, rest string
+		}{
+			{`"\C-a": beginning-of-line`, `\C-a`, `: beginning-of-line`},
+			{`"\"": x`, `\"`, `: x`},
+			{`'a"b' rest`, `a"b`, ` rest`},
+			{`'it\'s'`, `it\'s`, ``},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				text, rest, err := quotedString(entry.input)
+				assertNoError(t, err)
+				assertEqual(t, entry.text, text)
+				assertEqual(t, entry.rest, rest)
+			})
+		}
+
+		if _, _, err := quotedString(`"\C-a: x`); err == nil {
+			t.Error("Expected an error for an unclosed quote")
+		}
+	})
+}
+
+func TestInputrc(t *testing.T) {
+	t.Run("Bind should bind functions and macros", func(t *testing.T) {
+		table := []struct {
+			line     string
+			keys     string
+			function string
+			macro    string
+		}{
+			{`"\C-xu": kill-word`, "\x18u", "kill-word", ""},
+			{`Control-o: kill-line`, "\x0f", "kill-line", ""},
+			{`Meta-Rubout: backward-kill-word`, "\x1b\x7f", "backward-kill-word", ""},
+			{`"\e[A": history-search-backward`, "\x1b[A", "history-search-backward", ""},
+			{`"\C-xg": "git status\n"`, "\x18g", "", "git status\n"},
+			{`"\C-xq": 'say "hi"'`, "\x18q", "", `say "hi"`},
+			{`"\C-xm" : "\C-a# "`, "\x18m", "", "\x01# "},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.line, func(t *testing.T) {
+				b := NewBindings()
+				assertNoError(t, b.Bind("", entry.line))
+				bound, found, _ := b.get("emacs", decodeKeys([]byte(entry.keys)))
+				if !found {
+					t.Fatalf("%q is not bound", entry.keys)
+				}
+				assertEqual(t, entry.function, bound.function)
+				assertEqual(t, entry.macro, string(bound.macro))
+			})
+		}
+	})
+
+	t.Run("Bind should report bad lines", func(t *testing.T) {
+		for _, line := range []string{
+			`"\C-a" beginning-of-line`,
+			`"\C-a": no-such-function`,
+			`"": beginning-of-line`,
+			`"\C-a: beginning-of-line`,
+			`Hyper-a: beginning-of-line`,
+		} {
+			if err := NewBindings().Bind("", line); err == nil {
+				t.Errorf("Expected an error for %q", line)
+			}
+		}
+	})
+
+	t.Run("ReadFile should follow set and $if", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "inputrc")
+		content := `# a comment
+set editing-mode vi
+$if mode=vi
+  "\C-xa": end-of-line
+$else
+  "\C-xb": end-of-line
+$endif
+$if Bash
+  set keymap emacs
+  "\C-xc": "macro"
+$endif
+$if term=nonexistent
+  "\C-xd": end-of-line
+$endif
+`
+		assertNoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+		b := NewBindings()
+		assertNoError(t, b.ReadFile("", path))
+		assertEqual(t, "vi", b.EditingMode())
+
+		table := []struct {
+			keymap string
+			keys   string
+			found  bool
+		}{
+			{"vi-insert", "\x18a", true},
+			{"vi-insert", "\x18b", false},
+			{"emacs", "\x18c", true},
+			{"vi-insert", "\x18c", false},
+			{"vi-insert", "\x18d", false},
+		}
+		for _, entry := range table {
+			_, found, _ := b.get(entry.keymap, decodeKeys([]byte(entry.keys)))
+			if found != entry.found {
+				t.Errorf("%s %q: wanted bound %v", entry.keymap, entry.keys, entry.found)
+			}
+		}
+	})
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Didn't expect an error but got %v", err)
+	}
+}
+
+func assertEqual[T any](t testing.TB, want, got T) {
+	t.Helper()
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted %#v, Got %#v", want, got)
+	}
+}
@@ -0,0 +1,479 @@
+package editor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// action is an editing function keys can be bound to, named like the
+// functions of readline, c is the last key of the sequence that ran it
+// and false is returned to end the line
+type action func(e *Editor, c int) bool
+
+var actions = map[string]action{
+	"accept-line": func(e *Editor, c int) bool {
+		e.Input = append(e.Input, '\n') // for parser
+		return false
+	},
+	"complete": func(e *Editor, c int) bool {
+		e.handleAutoComplete()
+		return true
+	},
+	"clear-screen": func(e *Editor, c int) bool {
+		fmt.Print("\x1b[2J\x1b[H")
+		e.screen.row = 0
+		return true
+	},
+	"backward-delete-char": func(e *Editor, c int) bool {
+		e.removeChar()
+		return true
+	},
+	"delete-char": func(e *Editor, c int) bool {
+		// the end of file key ends the shell on an empty line
+		if c == _CTRL_KEY('d') && len(e.Input) == 0 {
+			e.err = io.EOF
+			return false
+		}
+		if e.cursor < len(e.Input) {
+			e.moveCursor(ARROW_RIGHT)
+			e.removeChar()
+		}
+		return true
+	},
+	"backward-char": func(e *Editor, c int) bool {
+		e.moveCursor(ARROW_LEFT)
+		return true
+	},
+	"forward-char": func(e *Editor, c int) bool {
+		e.moveCursor(ARROW_RIGHT)
+		return true
+	},
+	"beginning-of-line": func(e *Editor, c int) bool {
+		e.cursor = 0
+		return true
+	},
+	"end-of-line": func(e *Editor, c int) bool {
+		e.cursor = len(e.Input)
+		return true
+	},
+	"backward-word": func(e *Editor, c int) bool {
+		e.moveWord(false)
+		return true
+	},
+	"forward-word": func(e *Editor, c int) bool {
+		e.moveWord(true)
+		return true
+	},
+	"unix-word-rubout": func(e *Editor, c int) bool {
+		e.killTo(e.unixWordStart())
+		return true
+	},
+	"backward-kill-word": func(e *Editor, c int) bool {
+		e.killTo(e.wordStart())
+		return true
+	},
+	"kill-word": func(e *Editor, c int) bool {
+		e.killTo(e.wordEnd())
+		return true
+	},
+	"kill-line": func(e *Editor, c int) bool {
+		e.killTo(len(e.Input))
+		return true
+	},
+	"unix-line-discard": func(e *Editor, c int) bool {
+		e.killTo(0)
+		return true
+	},
+	"yank": func(e *Editor, c int) bool {
+		e.yank()
+		return true
+	},
+	"yank-pop": func(e *Editor, c int) bool {
+		e.yankPop()
+		return true
+	},
+	"transpose-chars": func(e *Editor, c int) bool {
+		e.transpose()
+		return true
+	},
+	"undo": func(e *Editor, c int) bool {
+		e.undoEdit()
+		e.lastCmd = cmdUndo
+		return true
+	},
+	"previous-history": func(e *Editor, c int) bool {
+		e.historyMove(ARROW_UP)
+		return true
+	},
+	"next-history": func(e *Editor, c int) bool {
+		e.historyMove(ARROW_DOWN)
+		return true
+	},
+	"beginning-of-history": func(e *Editor, c int) bool {
+		e.historyJump(0)
+		return true
+	},
+	"end-of-history": func(e *Editor, c int) bool {
+		e.historyJump(e.history.len())
+		return true
+	},
+	"history-search-backward": func(e *Editor, c int) bool {
+		e.historySearch(false)
+		return true
+	},
+	"history-search-forward": func(e *Editor, c int) bool {
+		e.historySearch(true)
+		return true
+	},
+	"reverse-search-history": func(e *Editor, c int) bool {
+		return e.incrementalSearch(false)
+	},
+	"forward-search-history": func(e *Editor, c int) bool {
+		return e.incrementalSearch(true)
+	},
+	"edit-and-execute-command": func(e *Editor, c int) bool {
+		return e.editAndExecute()
+	},
+	"self-insert": func(e *Editor, c int) bool {
+		if c <= unicode.MaxRune && unicode.IsPrint(rune(c)) {
+			e.insertChar(rune(c))
+			e.lastCmd = cmdInsert
+		}
+		return true
+	},
+	"vi-movement-mode": func(e *Editor, c int) bool {
+		if e.vi != nil {
+			e.viLeaveInsert()
+		}
+		return true
+	},
+}
+
+// defaultBindings are the keys of each keymap before the inputrc
+// file is read, in its notation, the printable characters of
+// emacs and vi-insert are bound to self-insert too
+var defaultBindings = map[string]map[string]string{
+	"emacs": {
+		`\C-a`: "beginning-of-line", `\e[H`: "beginning-of-line",
+		`\C-e`: "end-of-line", `\e[F`: "end-of-line",
+		`\C-b`: "backward-char", `\e[D`: "backward-char",
+		`\C-f`: "forward-char", `\e[C`: "forward-char",
+		`\eb`: "backward-word", `\ef`: "forward-word",
+		`\C-h`: "backward-delete-char", `\C-?`: "backward-delete-char",
+		`\C-d`: "delete-char", `\e[3~`: "delete-char",
+		`\C-i`: "complete",
+		`\C-j`: "accept-line", `\C-m`: "accept-line",
+		`\C-k`: "kill-line", `\C-u`: "unix-line-discard",
+		`\C-w`: "unix-word-rubout", `\ed`: "kill-word",
+		`\e\C-h`: "backward-kill-word", `\e\C-?`: "backward-kill-word",
+		`\C-y`: "yank", `\ey`: "yank-pop",
+		`\C-t`: "transpose-chars",
+		`\C-_`: "undo", `\C-x\C-u`: "undo",
+		`\C-l`: "clear-screen",
+		`\C-p`: "previous-history", `\e[A`: "previous-history",
+		`\C-n`: "next-history", `\e[B`: "next-history",
+		`\e<`: "beginning-of-history", `\e>`: "end-of-history",
+		`\C-r`: "reverse-search-history", `\C-s`: "forward-search-history",
+		`\C-x\C-e`: "edit-and-execute-command",
+	},
+	"vi-insert": {
+		`\e`:   "vi-movement-mode",
+		`\e[H`: "beginning-of-line", `\e[F`: "end-of-line",
+		`\e[D`: "backward-char", `\e[C`: "forward-char",
+		`\C-h`: "backward-delete-char", `\C-?`: "backward-delete-char",
+		`\C-d`: "delete-char", `\e[3~`: "delete-char",
+		`\C-i`: "complete",
+		`\C-j`: "accept-line", `\C-m`: "accept-line",
+		`\C-u`: "unix-line-discard", `\C-w`: "unix-word-rubout",
+		`\C-y`: "yank", `\C-t`: "transpose-chars",
+		`\C-_`: "undo",
+		`\e[A`: "previous-history", `\e[B`: "next-history",
+		`\C-r`: "reverse-search-history", `\C-s`: "forward-search-history",
+	},
+	// the other commands of normal mode take counts and
+	// motions, they are in viRun and can be bound over
+	"vi-command": {
+		`\C-j`: "accept-line", `\C-m`: "accept-line",
+		`\C-d`: "delete-char",
+		`\C-l`: "clear-screen",
+		`\e[A`: "previous-history", `\e[B`: "next-history",
+		`\C-r`: "reverse-search-history", `\C-s`: "forward-search-history",
+		`u`: "undo",
+		`v`: "edit-and-execute-command",
+	},
+}
+
+// keymapNames are the keymaps bind -m takes and the one they are
+var keymapNames = map[string]string{
+	"emacs": "emacs", "emacs-standard": "emacs", "emacs-meta": "emacs", "emacs-ctlx": "emacs",
+	"vi": "vi-command", "vi-command": "vi-command", "vi-move": "vi-command",
+	"vi-insert": "vi-insert",
+}
+
+// binding is what a key sequence does, an action or a macro
+// whose text is typed in place of the sequence
+type binding struct {
+	function string
+	macro    []byte
+}
+
+// keymap binds sequences of the keys of readKey, kept in a string
+// of four bytes per key as they go past the last rune, to what they do
+type keymap struct {
+	bindings map[string]binding
+	// every sequence that starts a longer bound one
+	prefixes map[string]bool
+}
+
+func newKeymap() *keymap {
+	return &keymap{bindings: map[string]binding{}, prefixes: map[string]bool{}}
+}
+
+func keyString(keys []int) string {
+	buf := make([]byte, 0, 4*len(keys))
+	for _, c := range keys {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(c))
+	}
+	return string(buf)
+}
+
+func stringKeys(s string) []int {
+	keys := []int{}
+	for i := 0; i+4 <= len(s); i += 4 {
+		keys = append(keys, int(binary.BigEndian.Uint32([]byte(s[i:i+4]))))
+	}
+	return keys
+}
+
+func (km *keymap) bind(keys []int, b binding) {
+	km.bindings[keyString(keys)] = b
+	km.updatePrefixes()
+}
+
+func (km *keymap) unbind(keys []int) bool {
+	key := keyString(keys)
+	_, found := km.bindings[key]
+	delete(km.bindings, key)
+	km.updatePrefixes()
+	return found
+}
+
+func (km *keymap) updatePrefixes() {
+	clear(km.prefixes)
+	for seq := range km.bindings {
+		keys := stringKeys(seq)
+		for n := 1; n < len(keys); n++ {
+			km.prefixes[keyString(keys[:n])] = true
+		}
+	}
+}
+
+// Bindings are the keymaps of the editing modes, the inputrc file
+// and the bind builtin change them
+type Bindings struct {
+	mu      sync.Mutex
+	keymaps map[string]*keymap
+	// keymap of the editing mode, the one bind changes by default
+	current string
+	// editing-mode set by the inputrc file, empty when it's not set
+	editingMode string
+	lookup      func(string) (string, bool)
+}
+
+func NewBindings() *Bindings {
+	b := &Bindings{keymaps: map[string]*keymap{}, current: "emacs", lookup: os.LookupEnv}
+	for name, defaults := range defaultBindings {
+		km := newKeymap()
+		for seq, function := range defaults {
+			keys, _ := translateKeyseq(seq)
+			km.bindings[keyString(decodeKeys(keys))] = binding{function: function}
+		}
+		if name != "vi-command" {
+			for char := ' '; char < unicode.MaxASCII; char++ {
+				km.bindings[keyString([]int{int(char)})] = binding{function: "self-insert"}
+			}
+		}
+		km.updatePrefixes()
+		b.keymaps[name] = km
+	}
+	return b
+}
+
+func (b *Bindings) SetLookup(lookup func(string) (string, bool)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lookup = lookup
+}
+
+// EditingMode is the editing-mode set by the inputrc
+// file, emacs or vi, empty when it doesn't set it
+func (b *Bindings) EditingMode() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.editingMode
+}
+
+func (b *Bindings) setCurrent(keymap string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current = keymap
+}
+
+// keymap returns the keymap called name, the current one for
+// an empty name, the caller must hold b.mu
+func (b *Bindings) keymap(name string) (*keymap, error) {
+	if name == "" {
+		name = b.current
+	}
+	canonical, found := keymapNames[name]
+	if !found {
+		return nil, fmt.Errorf("`%s': invalid keymap name", name)
+	}
+	return b.keymaps[canonical], nil
+}
+
+// get returns the binding of keys in the keymap called name
+// and whether keys start a longer bound sequence
+func (b *Bindings) get(name string, keys []int) (binding, bool, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	km := b.keymaps[name]
+	bound, found := km.bindings[keyString(keys)]
+	return bound, found, km.prefixes[keyString(keys)]
+}
+
+// Functions returns the names of the editing functions
+func (b *Bindings) Functions() []string {
+	return slices.Sorted(maps.Keys(actions))
+}
+
+// KeyBinding is a key sequence in the notation of the inputrc
+// file, like \C-a, and the function or the macro it runs
+type KeyBinding struct {
+	Keys     string
+	Function string
+	Macro    string
+}
+
+// Bindings returns the key sequences bound in a keymap, the current one
+// when keymap is empty, sorted by function and then by key sequence
+func (b *Bindings) Bindings(keymap string) ([]KeyBinding, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	km, err := b.keymap(keymap)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []KeyBinding{}
+	for seq, bound := range km.bindings {
+		kb := KeyBinding{Keys: formatKeys(stringKeys(seq)), Function: bound.function}
+		if bound.macro != nil {
+			kb.Macro = formatBytes(bound.macro)
+		}
+		list = append(list, kb)
+	}
+	slices.SortFunc(list, func(x, y KeyBinding) int {
+		return strings.Compare(x.Function+"\x00"+x.Keys, y.Function+"\x00"+y.Keys)
+	})
+	return list, nil
+}
+
+// Bind reads a line of the inputrc file, a binding or a set command
+func (b *Bindings) Bind(keymap, line string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := &inputrcParser{b: b, keymap: keymap}
+	return p.parseLine(line)
+}
+
+// Unbind removes the binding of the key sequence keyseq,
+// written like in the inputrc file
+func (b *Bindings) Unbind(keymap, keyseq string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	km, err := b.keymap(keymap)
+	if err != nil {
+		return err
+	}
+	seq, err := translateKeyseq(keyseq)
+	if err != nil {
+		return err
+	}
+	km.unbind(decodeKeys(seq))
+	return nil
+}
+
+// UnbindFunction removes every key sequence bound to function
+func (b *Bindings) UnbindFunction(keymap, function string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	km, err := b.keymap(keymap)
+	if err != nil {
+		return err
+	}
+	if _, found := actions[function]; !found {
+		return fmt.Errorf("`%s': unknown function name", function)
+	}
+	maps.DeleteFunc(km.bindings, func(_ string, bound binding) bool {
+		return bound.function == function
+	})
+	km.updatePrefixes()
+	return nil
+}
+
+// keymap is the name of the keymap of the editing mode
+func (e *Editor) keymap() string {
+	switch e.mode() {
+	case ViInsertMode:
+		return "vi-insert"
+	case ViCommandMode:
+		return "vi-command"
+	}
+	return "emacs"
+}
+
+// lookupKey reads the keys of the longest bound sequence starting with
+// c, keys read past it are handled next, without a binding only c is used
+func (e *Editor) lookupKey(keymap string, c int) ([]int, binding, bool) {
+	keys := []int{c}
+	var found binding
+	foundLen := 0
+	for {
+		bound, isBound, isPrefix := e.bindings.get(keymap, keys)
+		if isBound {
+			found, foundLen = bound, len(keys)
+		}
+		if !isPrefix {
+			break
+		}
+		keys = append(keys, e.readKey())
+	}
+
+	if foundLen == 0 {
+		e.pending = append(slices.Clone(keys[1:]), e.pending...)
+		return keys[:1], binding{}, false
+	}
+	e.pending = append(slices.Clone(keys[foundLen:]), e.pending...)
+	return keys[:foundLen], found, true
+}
+
+// runBinding runs the action bound to keys or types its macro
+func (e *Editor) runBinding(keys []int, bound binding) bool {
+	if bound.macro != nil {
+		e.pending = append(decodeKeys(bound.macro), e.pending...)
+		return true
+	}
+	more := actions[bound.function](e, keys[len(keys)-1])
+	if bound.function != "complete" {
+		e.tabPresses = 0
+	}
+	return more
+}
@@ -0,0 +1,202 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// number of candidates from which the user is asked
+// before they are all shown, the default of readline
+const completionQueryItems = 100
+
+// completionMenu is the grid of candidates shown by the second Tab,
+// the Tabs after it put each candidate in the line in turn
+type completionMenu struct {
+	completion
+	// candidate in the line, -1 until Tab goes through them
+	selected int
+	// number of runes inserted for the selected candidate
+	inserted int
+
+	// the grid, its columns are filled from top to bottom
+	rows, cols, width int
+	// the grid was printed once above the line instead of
+	// being drawn below it, for grids taller than the screen
+	printed bool
+}
+
+func newCompletionMenu(found completion, termCols int) *completionMenu {
+	width := 0
+	for _, w := range found.words {
+		width = max(width, stringWidth(w))
+	}
+	width += 2
+	cols := max(1, termCols/width)
+
+	return &completionMenu{
+		completion: found,
+		selected:   -1,
+		rows:       (len(found.words) + cols - 1) / cols,
+		cols:       cols,
+		width:      width,
+	}
+}
+
+// grid returns the lines of the grid with the selected candidate highlighted
+func (m *completionMenu) grid() []string {
+	lines := make([]string, m.rows)
+	for row := range m.rows {
+		var sb strings.Builder
+		for col := range m.cols {
+			i := col*m.rows + row
+			if i >= len(m.words) {
+				break
+			}
+			word := m.words[i]
+			if i == m.selected {
+				// "\x1b[7m" reverse video
+				sb.WriteString("\x1b[7m" + word + "\x1b[m")
+			} else {
+				sb.WriteString(word)
+			}
+			if i+m.rows < len(m.words) {
+				sb.WriteString(strings.Repeat(" ", m.width-stringWidth(word)))
+			}
+		}
+		lines[row] = sb.String()
+	}
+	return lines
+}
+
+// showCompletions shows the candidates below the line,
+// asking first when there are a lot of them
+func (e *Editor) showCompletions(found completion) {
+	asked := len(found.words) >= completionQueryItems
+	if asked && !e.askDisplayAll(len(found.words)) {
+		e.tabPresses = 0
+		return
+	}
+
+	termCols, termRows := termSize()
+	e.menu = newCompletionMenu(found, termCols)
+
+	// the line can't stay on screen with the grid below it
+	// so it's printed once and the line comes after it
+	lineRows, _ := cursorPosition(e.cols, e.prompt(), e.Input, len(e.Input))
+	if asked || e.menu.rows+lineRows >= termRows {
+		e.menu.printed = true
+		if !asked {
+			e.newLine()
+		}
+		for _, line := range e.menu.grid() {
+			fmt.Print(line, "\n")
+		}
+	}
+}
+
+// askDisplayAll asks if all the n candidates should be shown
+func (e *Editor) askDisplayAll(n int) bool {
+	e.newLine()
+	fmt.Printf("Display all %d possibilities? (y or n)", n)
+	for {
+		switch e.readKey() {
+		case 'y', 'Y', ' ':
+			fmt.Print("\n")
+			return true
+		case 'n', 'N', BACKSPACE, _CTRL_KEY('g'), _CTRL_KEY('c'), '\x1b', END_OF_INPUT:
+			fmt.Print("\n")
+			return false
+		default:
+			fmt.Print("\a")
+		}
+	}
+}
+
+// drawMenu draws the grid below the line and brings
+// the cursor back where it was on the line
+func (e *Editor) drawMenu() {
+	s := e.screen
+	endRow, _ := cursorPosition(e.cols, s.prompt, s.line, len(s.line))
+	_, col := cursorPosition(e.cols, s.prompt, s.line, s.cursor)
+
+	var sb strings.Builder
+	sb.WriteString("\x1b[?25l")
+	if endRow > s.row {
+		fmt.Fprintf(&sb, "\x1b[%dB", endRow-s.row)
+	}
+	for _, line := range e.menu.grid() {
+		sb.WriteString("\n" + line)
+	}
+	fmt.Fprintf(&sb, "\x1b[%dA\x1b[%dG", e.menu.rows+endRow-s.row, col+1)
+	sb.WriteString("\x1b[?25h")
+
+	_, err := os.Stdout.WriteString(sb.String())
+	e.panicOnErr("drawMenu", err)
+}
+
+// menuKey handles a key while the candidates are shown, false is returned
+// for keys that close the menu and are then handled as usual
+func (e *Editor) menuKey(c int) bool {
+	m := e.menu
+	n := len(m.candidates)
+
+	switch {
+	case c == '\t':
+		e.menuSelect((m.selected + 1) % n)
+
+	case c == SHIFT_TAB:
+		if m.selected < 0 {
+			m.selected = 0
+		}
+		e.menuSelect((m.selected - 1 + n) % n)
+
+	// moving in the grid only once going through it
+	case m.selected >= 0 && (c == ARROW_DOWN || c == ARROW_UP):
+		step := map[int]int{ARROW_DOWN: 1, ARROW_UP: -1}[c]
+		e.menuSelect((m.selected + step + n) % n)
+
+	case m.selected >= 0 && (c == ARROW_RIGHT || c == ARROW_LEFT):
+		step := map[int]int{ARROW_RIGHT: m.rows, ARROW_LEFT: -m.rows}[c]
+		e.menuSelect(((m.selected+step)%n + n) % n)
+
+	case c == '\x1b' || c == _CTRL_KEY('g'):
+		// back to the word as it was typed
+		e.menuSelect(-1)
+		e.closeMenu()
+
+	case (c == '\r' || c == '\n') && m.selected >= 0:
+		// keep the candidate to go on editing
+		e.closeMenu()
+
+	default:
+		e.closeMenu()
+		return false
+	}
+	return true
+}
+
+// menuSelect replaces the candidate in the line with the i-th one,
+// -1 only removes it
+func (e *Editor) menuSelect(i int) {
+	m := e.menu
+	for range m.inserted {
+		e.removeChar()
+	}
+	m.selected, m.inserted = i, 0
+	if i < 0 {
+		return
+	}
+
+	text := quoteCompletion(strings.TrimPrefix(m.candidates[i], m.prefix), m.quote)
+	e.insertString(text)
+	m.inserted = utf8.RuneCountInString(text)
+}
+
+// closeMenu stops showing the candidates and clears the grid
+func (e *Editor) closeMenu() {
+	e.menu = nil
+	e.tabPresses = 0
+	e.refreshLine()
+}
@@ -0,0 +1,115 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompletionMenuGrid(t *testing.T) {
+	found := completion{words: []string{"a", "bb", "ccc", "dddd", "e"}}
+
+	m := newCompletionMenu(found, 14)
+	assertEqual(t, 6, m.width)
+	assertEqual(t, 2, m.cols)
+	assertEqual(t, 3, m.rows)
+	// filled from top to bottom, no padding after the last column
+	assertEqual(t, []string{"a     dddd", "bb    e", "ccc"}, m.grid())
+
+	m.selected = 3
+	assertEqual(t, "a     \x1b[7mdddd\x1b[m", m.grid()[0])
+
+	// one column when the words are wider than the terminal
+	m = newCompletionMenu(found, 3)
+	assertEqual(t, 1, m.cols)
+	assertEqual(t, 5, m.rows)
+
+	m = newCompletionMenu(found, 80)
+	assertEqual(t, 13, m.cols)
+	assertEqual(t, []string{"a     bb    ccc   dddd  e"}, m.grid())
+}
+
+func TestCompletionMenuKeys(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"fa", "fb", "fc", "fd"} {
+		assertNoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+	line := "cat " + dir + "/f"
+
+	table := []struct {
+		name   string
+		writes []string
+		// the end of the line with | for the cursor
+		want string
+		open bool
+	}{
+		{"first tab only rings", []string{"\t"}, "/f|", false},
+		{"second tab shows the menu", []string{"\t\t"}, "/f|", true},
+		{"tab puts the candidates in turn", []string{"\t\t\t\t"}, "/fb|", true},
+		{"tab wraps around", []string{"\t\t\t\t\t\t\t"}, "/fa|", true},
+		{"shift-tab goes back", []string{"\t\t\t\t", "\x1b[Z"}, "/fa|", true},
+		{"shift-tab starts from the last", []string{"\t\t", "\x1b[Z"}, "/fd|", true},
+		{"arrows move only once going through", []string{"\t\t\x1b[B"}, "/f|", false},
+		{"down goes to the next", []string{"\t\t\t", "\x1b[B"}, "/fb|", true},
+		{"up wraps to the last", []string{"\t\t\t", "\x1b[A"}, "/fd|", true},
+		{"esc gets the word back", []string{"\t\t\t\t", "\x1b"}, "/f|", false},
+		{"ctrl-g gets the word back", []string{"\t\t\t\x07"}, "/f|", false},
+		{"enter keeps the candidate", []string{"\t\t\t\r"}, "/fa|", false},
+		{"other keys close and are typed", []string{"\t\t\tx"}, "/fax|", false},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			e := newTestEditor(t)
+			typeKeys(e, line)
+			assertEqual(t, true, typeKeys(e, entry.writes...))
+			assertLine(t, "cat "+dir+entry.want, e)
+			assertEqual(t, entry.open, e.menu != nil)
+		})
+	}
+}
+
+func TestCompletionMenuColumns(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 30 {
+		name := fmt.Sprintf("file%02d", i)
+		assertNoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	e := newTestEditor(t)
+	typeKeys(e, "cat "+dir+"/file", "\t\t\t")
+	m := e.menu
+	// 80 columns of 8 wide words
+	assertEqual(t, 10, m.cols)
+	assertEqual(t, 3, m.rows)
+
+	// right goes to the next column, wrapping to the next row
+	typeKeys(e, "\x1b[C")
+	assertLine(t, "cat "+dir+"/file03|", e)
+	typeKeys(e, "\x1b[D\x1b[D")
+	assertLine(t, "cat "+dir+"/file27|", e)
+}
+
+func TestDisplayAllPossibilities(t *testing.T) {
+	dir := t.TempDir()
+	for i := range completionQueryItems {
+		name := fmt.Sprintf("file%03d", i)
+		assertNoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	for _, answer := range []string{"y", "Y", " ", "n", "N", "\x7f", "\x07", "\x1b"} {
+		t.Run(fmt.Sprintf("%q", answer), func(t *testing.T) {
+			e := newTestEditor(t)
+			// other keys ring until an answer
+			typeKeys(e, "cat "+dir+"/f", "\t\tx"+answer)
+
+			yes := answer == "y" || answer == "Y" || answer == " "
+			assertEqual(t, yes, e.menu != nil)
+			assertLine(t, "cat "+dir+"/file0|", e)
+			if yes {
+				assertEqual(t, true, e.menu.printed)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// screenLine is what drawLine last drew, the prompt and the line can
+// take several rows of the terminal when they are wider than it
+type screenLine struct {
+	prompt string
+	line   []rune
+	cursor int
+	// row of the cursor below the first row of the prompt
+	row int
+}
+
+// keyRead is a key read from the terminal by the goroutine of readKey
+type keyRead struct {
+	key int
+	err error
+}
+
+func notifyResize() chan os.Signal {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, unix.SIGWINCH)
+	return winch
+}
+
+// startScreen gets the width of the terminal for a new line, the
+// resizes while programs were running are in it already
+func (e *Editor) startScreen() {
+	select {
+	case <-e.winch:
+	default:
+	}
+	e.cols, _ = termSize()
+	e.screen = screenLine{}
+}
+
+// resize draws the line again for the new width of the terminal,
+// the rows it took are reflowed by the terminal like its other rows
+func (e *Editor) resize() {
+	e.cols, _ = termSize()
+	s := e.screen
+	row, col := layout(e.cols, s.prompt, s.line[:s.cursor])
+	if col == e.cols && s.cursor < len(s.line) {
+		// on the next character, the cursor stays
+		// on a full row only at the end of the line
+		row++
+	}
+	e.screen.row = row
+	if e.menu != nil {
+		// the grid doesn't fit the new width
+		e.closeMenu()
+		return
+	}
+	e.drawLine(s.prompt, s.line, s.cursor)
+}
+
+// moveToEnd moves the cursor after the last character of the line
+func (e *Editor) moveToEnd() {
+	s := e.screen
+	row, col := cursorPosition(e.cols, s.prompt, s.line, len(s.line))
+	if row > s.row {
+		fmt.Printf("\x1b[%dB", row-s.row)
+	}
+	fmt.Printf("\x1b[%dG", col+1)
+	e.screen.row = row
+}
+
+// newLine goes to the row below the line, where
+// the next line is drawn
+func (e *Editor) newLine() {
+	e.moveToEnd()
+	fmt.Print("\n")
+	e.screen = screenLine{}
+}
@@ -0,0 +1,211 @@
+package editor
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"unicode"
+)
+
+// search is the state of an incremental history search
+type search struct {
+	query   []rune
+	forward bool
+	failed  bool
+	// entry of the match, the history length for the line being
+	// typed, and the offset of the match in that line
+	index int
+	at    int
+}
+
+// incrementalSearch reads keys in the (reverse-i-search) mode of Ctrl-R
+// and Ctrl-S until one ends it, the return value is the one of
+// processKeyPress so Enter runs the found line right away
+func (e *Editor) incrementalSearch(forward bool) bool {
+	if e.historyIndex >= e.history.len() {
+		e.historyIndex = e.history.len()
+		e.draft = e.Input
+	}
+	original, originalIndex := e.Input, e.historyIndex
+
+	s := &search{forward: forward, index: e.historyIndex, at: e.cursor}
+	start, startAt := s.index, s.at
+
+	for {
+		e.refreshSearch(s)
+
+		c := e.readKey()
+		switch c {
+		case _CTRL_KEY('r'), _CTRL_KEY('s'):
+			s.forward = c == _CTRL_KEY('s')
+			if len(s.query) == 0 {
+				// an empty search repeats the last one
+				s.query = slices.Clone(e.lastSearch)
+			}
+			e.searchNext(s, true)
+
+		case BACKSPACE, _CTRL_KEY('h'):
+			if len(s.query) > 0 {
+				s.query = s.query[:len(s.query)-1]
+			}
+			s.index, s.at = start, startAt
+			e.searchNext(s, false)
+
+		case _CTRL_KEY('g'):
+			// give up and get the line back as it was
+			e.Input, e.historyIndex = original, originalIndex
+			e.cursor = startAt
+			return true
+
+		case _CTRL_KEY('c'):
+			e.acceptSearch(s)
+			e.refreshLine()
+			e.moveToEnd()
+			fmt.Print("^C")
+			e.err = ErrInterrupted
+			return false
+
+		case END_OF_INPUT:
+			e.err = io.EOF
+			return false
+
+		case '\r', '\n':
+			e.acceptSearch(s)
+			e.refreshLine()
+			e.Input = append(e.Input, '\n') // for parser
+			return false
+
+		case '\x1b':
+			e.acceptSearch(s)
+			return true
+
+		case ARROW_LEFT, ARROW_RIGHT:
+			e.acceptSearch(s)
+			e.moveCursor(c)
+			return true
+
+		case ARROW_UP, ARROW_DOWN:
+			e.acceptSearch(s)
+			e.historyMove(c)
+			return true
+
+		case HOME_KEY, END_KEY, DEL_KEY, PAGE_UP, PAGE_DOWN:
+			e.acceptSearch(s)
+			return true
+
+		default:
+			if c >= _ALT_KEY(0) {
+				// the search ends and the key does what it usually does
+				e.acceptSearch(s)
+				e.pending = append([]int{c}, e.pending...)
+				return true
+			}
+			if char := rune(c); c <= unicode.MaxRune && unicode.IsPrint(char) {
+				s.query = append(s.query, char)
+				e.searchNext(s, false)
+			}
+		}
+	}
+}
+
+// searchLine is the i-th entry of the history or the line being typed
+func (e *Editor) searchLine(i int) []rune {
+	if i >= e.history.len() {
+		return e.draft
+	}
+	return []rune(e.history.at(i))
+}
+
+// runesIndex is the offset of the first query in line, -1 without one
+func runesIndex(line, query []rune) int {
+	for at := 0; at+len(query) <= len(line); at++ {
+		if slices.Equal(line[at:at+len(query)], query) {
+			return at
+		}
+	}
+	return -1
+}
+
+// runesLastIndex is the offset of the last query in line, -1 without one
+func runesLastIndex(line, query []rune) int {
+	for at := len(line) - len(query); at >= 0; at-- {
+		if slices.Equal(line[at:at+len(query)], query) {
+			return at
+		}
+	}
+	return -1
+}
+
+// searchNext moves s to the closest match of its query in its direction,
+// with skip the current match is passed to find the one after it
+func (e *Editor) searchNext(s *search, skip bool) {
+	s.failed = false
+	if len(s.query) == 0 {
+		return
+	}
+	e.lastSearch = slices.Clone(s.query)
+
+	// first the rest of the current line, then the following ones
+	line := e.searchLine(s.index)
+	if s.forward {
+		from := min(s.at, len(line))
+		if skip && from < len(line) {
+			from++
+		}
+		if at := runesIndex(line[from:], s.query); at >= 0 {
+			s.at = from + at
+			return
+		}
+	} else {
+		to := min(s.at+len(s.query), len(line))
+		if skip {
+			to = min(s.at+len(s.query)-1, len(line))
+		}
+		if at := runesLastIndex(line[:max(to, 0)], s.query); at >= 0 {
+			s.at = at
+			return
+		}
+	}
+
+	step := -1
+	if s.forward {
+		step = 1
+	}
+	for i := s.index + step; i >= 0 && i <= e.history.len(); i += step {
+		line := e.searchLine(i)
+		at := runesLastIndex(line, s.query)
+		if s.forward {
+			at = runesIndex(line, s.query)
+		}
+		if at >= 0 {
+			s.index, s.at = i, at
+			return
+		}
+	}
+
+	s.failed = true
+	fmt.Print("\a")
+}
+
+// acceptSearch puts the found line in the editor
+// with the cursor on the match for editing
+func (e *Editor) acceptSearch(s *search) {
+	line := e.searchLine(s.index)
+	e.historyIndex = s.index
+	e.Input = slices.Clone(line)
+	e.cursor = min(s.at, len(line))
+}
+
+func (e *Editor) refreshSearch(s *search) {
+	prompt := "reverse-i-search"
+	if s.forward {
+		prompt = "i-search"
+	}
+	if s.failed {
+		prompt = "failed " + prompt
+	}
+	prompt = fmt.Sprintf("(%s)`%s': ", prompt, string(s.query))
+
+	line := e.searchLine(s.index)
+	e.drawLine(prompt, line, min(s.at, len(line)))
+}
@@ -0,0 +1,54 @@
+package editor
+
+import "testing"
+
+func TestIncrementalSearch(t *testing.T) {
+	history := []string{"ls -l", "echo one", "echo two", "cat file"}
+
+	table := []struct {
+		name   string
+		writes []string
+		// the line, with | for the cursor when it goes on
+		want string
+		more bool
+	}{
+		{"enter runs the match", []string{"\x12echo\r"}, "echo two\n", false},
+		{"ctrl-r goes to older matches", []string{"\x12echo\x12\r"}, "echo one\n", false},
+		{"no older match stays on the last one", []string{"\x12echo\x12\x12\x12\r"}, "echo one\n", false},
+		{"ctrl-s goes back to newer matches", []string{"\x12echo\x12\x13\r"}, "echo two\n", false},
+		{"ctrl-s searches forward", []string{"\x1b[A\x1b[A\x1b[A\x1b[A", "\x13echo\r"}, "echo one\n", false},
+		{"matches inside a line", []string{"\x12o\x12", "\x1b"}, "ech|o two", true},
+		{"backspace goes back to the first match", []string{"\x12echox\x7f\x7f\x7fo\r"}, "echo two\n", false},
+		{"failed search keeps the match", []string{"\x12ca\x12\x12zz\r"}, "cat file\n", false},
+		{"esc keeps the match for editing", []string{"\x12file", "\x1b"}, "cat |file", true},
+		{"arrows keep the match and move", []string{"\x12two\x1b[C"}, "echo t|wo", true},
+		{"ctrl-g gets the line back", []string{"draft\x02\x12echo\x07"}, "draf|t", true},
+		{"keys after esc edit the match", []string{"\x12one", "\x1b", "\x01#"}, "#|echo one", true},
+		{"empty search repeats the last one", []string{"\x12one\x07\x12\x12\r"}, "echo one\n", false},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			e := newTestEditor(t, history...)
+			more := typeKeys(e, entry.writes...)
+			assertEqual(t, entry.more, more)
+			if more {
+				assertLine(t, entry.want, e)
+			} else {
+				assertEqual(t, entry.want, string(e.Input))
+			}
+		})
+	}
+}
+
+func TestSearchPrompt(t *testing.T) {
+	e := newTestEditor(t, "echo one")
+	s := &search{query: []rune("one"), index: 0, at: 5}
+	e.refreshSearch(s)
+	assertEqual(t, "(reverse-i-search)`one': ", e.screen.prompt)
+	assertEqual(t, 5, e.screen.cursor)
+
+	s.forward, s.failed = true, true
+	e.refreshSearch(s)
+	assertEqual(t, "(failed i-search)`one': ", e.screen.prompt)
+}
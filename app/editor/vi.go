@@ -0,0 +1,528 @@
+package editor
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Mode is the editing mode of the line, shown by the mode indicator
+type Mode int
+
+const (
+	EmacsMode Mode = iota
+	ViInsertMode
+	ViCommandMode
+)
+
+// defaultModeIndicator shows the vi modes like bash does with
+// show-mode-in-prompt on, and nothing in emacs mode
+func defaultModeIndicator(mode Mode) string {
+	switch mode {
+	case ViInsertMode:
+		return "(ins) "
+	case ViCommandMode:
+		return "(cmd) "
+	}
+	return ""
+}
+
+// SetModeIndicator sets the text shown before the prompt for each mode
+func (e *Editor) SetModeIndicator(indicator func(Mode) string) {
+	e.modeIndicator = indicator
+}
+
+// SetViMode switches between the vi and emacs editing modes of set -o
+func (e *Editor) SetViMode(on bool) {
+	switch {
+	case on && e.vi == nil:
+		e.vi = &viState{}
+	case !on:
+		e.vi = nil
+	}
+	// lines start in insert mode
+	if on {
+		e.bindings.setCurrent("vi-insert")
+	} else {
+		e.bindings.setCurrent("emacs")
+	}
+}
+
+func (e *Editor) mode() Mode {
+	switch {
+	case e.vi == nil:
+		return EmacsMode
+	case e.vi.command:
+		return ViCommandMode
+	}
+	return ViInsertMode
+}
+
+// viState is what vi mode remembers between keys and lines
+type viState struct {
+	// in normal mode, otherwise the keys insert text
+	command bool
+	// text deleted or yanked last, p puts it back
+	register []rune
+
+	// keys of the command being run, then of the last change with
+	// its count for . to run it again, recording goes on with the
+	// keys typed in insert mode until ESC ends the change
+	keys       []int
+	lastChange []int
+	lastCount  int
+	recording  bool
+
+	// the line when insert mode started, what's typed is undone at once
+	insertStart editState
+	// the last f F t or T and its character for ; and ,
+	lastFind, lastFindChar int
+}
+
+// startLine puts vi mode in insert mode for a new line
+func (e *Editor) startLine() {
+	if e.vi == nil {
+		return
+	}
+	e.vi.command = false
+	e.vi.recording = false
+	e.vi.insertStart = editState{}
+}
+
+// viKeyPress is processKeyPress in vi mode
+func (e *Editor) viKeyPress(c int) bool {
+	v := e.vi
+	if v.command {
+		return e.viCommand(c)
+	}
+
+	// a key typed right after ESC comes with it as an Alt key
+	if c >= _ALT_KEY(0) {
+		if _, found, _ := e.bindings.get("vi-insert", []int{c}); !found {
+			e.pending = append([]int{c - _ALT_KEY(0)}, e.pending...)
+			c = '\x1b'
+		}
+	}
+
+	e.prevCmd, e.lastCmd = e.lastCmd, cmdOther
+	return e.handleKey(c)
+}
+
+func (e *Editor) viEnterInsert() {
+	e.vi.command = false
+}
+
+// viLeaveInsert goes back to normal mode with the cursor
+// on the last character typed, like vi
+func (e *Editor) viLeaveInsert() {
+	v := e.vi
+	v.command = true
+	if v.recording {
+		// the keys that ended insert mode included
+		v.lastChange = v.keys
+		v.recording = false
+	}
+	if !slices.Equal(v.insertStart.input, e.Input) {
+		e.undo = append(e.undo, v.insertStart)
+	}
+	e.moveCursor(ARROW_LEFT)
+}
+
+// viReadKey reads a key that's part of the command being run
+func (e *Editor) viReadKey() int {
+	c := e.readKey()
+	e.vi.keys = append(e.vi.keys, c)
+	return c
+}
+
+// viCount reads the digits of a count starting with c,
+// it returns the count, 0 without one, and the key after it
+func (e *Editor) viCount(c int, read func() int) (int, int) {
+	count := 0
+	for c >= '0' && c <= '9' && (c != '0' || count > 0) {
+		count = count*10 + c - '0'
+		c = read()
+	}
+	return count, c
+}
+
+// viCommand runs a command of normal mode starting with c
+func (e *Editor) viCommand(c int) bool {
+	v := e.vi
+	count, c := e.viCount(c, e.readKey)
+	v.keys = []int{c}
+	before := editState{input: slices.Clone(e.Input), cursor: e.cursor}
+
+	var more, change bool
+	if keys, bound, found := e.lookupKey("vi-command", c); found {
+		more = e.runBinding(keys, bound)
+	} else {
+		more, change = e.viRun(c, count)
+	}
+	if change {
+		v.lastCount = count
+		if v.command {
+			v.lastChange = v.keys
+			if !slices.Equal(before.input, e.Input) {
+				e.undo = append(e.undo, before)
+			}
+		} else {
+			// the text typed next is part of the change
+			v.recording = true
+			v.insertStart = before
+		}
+	}
+
+	// the cursor is on a character in normal mode
+	if v.command && e.cursor > 0 && e.cursor >= len(e.Input) {
+		e.cursor = max(len(e.Input)-1, 0)
+	}
+	e.tabPresses = 0
+	return more
+}
+
+// viRun runs the command c, change says whether it's one . repeats
+func (e *Editor) viRun(c, count int) (more, change bool) {
+	v := e.vi
+	n := max(count, 1)
+
+	switch c {
+	case 'i', 'a', 'I', 'A':
+		switch {
+		case c == 'a' && len(e.Input) > 0:
+			e.cursor++
+		case c == 'I':
+			e.cursor = 0
+		case c == 'A':
+			e.cursor = len(e.Input)
+		}
+		e.viEnterInsert()
+		return true, true
+
+	case 'x', 'X', 's':
+		if len(e.Input) == 0 || (c == 'X' && e.cursor == 0) {
+			fmt.Print("\a")
+			return true, false
+		}
+		from, to := e.cursor, min(e.cursor+n, len(e.Input))
+		if c == 'X' {
+			from, to = max(e.cursor-n, 0), e.cursor
+		}
+		op := 'd'
+		if c == 's' {
+			op = 'c'
+		}
+		e.viOperate(op, from, to)
+		return true, true
+
+	case 'D', 'C':
+		e.viOperate(unicode.ToLower(rune(c)), e.cursor, len(e.Input))
+		return true, true
+
+	case 'S':
+		e.viOperate('c', 0, len(e.Input))
+		return true, true
+
+	case 'd', 'c', 'y':
+		done := e.viOperator(rune(c), n)
+		return true, done && c != 'y'
+
+	case 'p', 'P':
+		return true, e.viPut(c == 'p', n)
+
+	case 'r':
+		char := e.viReadKey()
+		if char > unicode.MaxRune || !unicode.IsPrint(rune(char)) || e.cursor+n > len(e.Input) {
+			fmt.Print("\a")
+			return true, false
+		}
+		for i := range n {
+			e.Input[e.cursor+i] = rune(char)
+		}
+		e.cursor += n - 1
+		return true, true
+
+	case '~':
+		if len(e.Input) == 0 {
+			fmt.Print("\a")
+			return true, false
+		}
+		for ; n > 0 && e.cursor < len(e.Input); n-- {
+			char := e.Input[e.cursor]
+			if unicode.IsUpper(char) {
+				char = unicode.ToLower(char)
+			} else {
+				char = unicode.ToUpper(char)
+			}
+			e.Input[e.cursor] = char
+			e.cursor++
+		}
+		return true, true
+
+	case '.':
+		if v.lastChange == nil {
+			fmt.Print("\a")
+			return true, false
+		}
+		keys := []int{}
+		if count == 0 {
+			count = v.lastCount
+		}
+		if count > 0 {
+			for _, digit := range strconv.Itoa(count) {
+				keys = append(keys, int(digit))
+			}
+		}
+		keys = append(keys, v.lastChange...)
+		e.pending = append(keys, e.pending...)
+		return true, false
+
+	case 'j', '+', 'k', '-':
+		arrow := ARROW_UP
+		if c == 'j' || c == '+' {
+			arrow = ARROW_DOWN
+		}
+		for range n {
+			e.historyMove(arrow)
+		}
+		e.cursor = 0
+		return true, false
+	}
+
+	to, _, found := e.viMotion(c, n)
+	if !found {
+		fmt.Print("\a")
+		return true, false
+	}
+	e.cursor = to
+	return true, false
+}
+
+// viOperator reads the motion of the operator d, c or y and applies
+// it to the text between the cursor and where the motion goes
+func (e *Editor) viOperator(op rune, n int) bool {
+	count, c := e.viCount(e.viReadKey(), e.viReadKey)
+	n *= max(count, 1)
+
+	// dd, cc and yy are for the whole line
+	if c == int(op) {
+		e.viOperate(op, 0, len(e.Input))
+		return true
+	}
+
+	var to int
+	var inclusive, found bool
+	if op == 'c' && (c == 'w' || c == 'W') && e.cursor < len(e.Input) &&
+		viClass(e.Input[e.cursor], c == 'W') != 0 {
+		// cw changes up to the end of the word like ce
+		to, found = e.cursor, true
+		for i := range n {
+			if i > 0 {
+				for to < len(e.Input) && viClass(e.Input[to], c == 'W') == 0 {
+					to++
+				}
+			}
+			to = viRunEnd(e.Input, to, c == 'W')
+		}
+	} else {
+		to, inclusive, found = e.viMotion(c, n)
+	}
+	if !found {
+		fmt.Print("\a")
+		return false
+	}
+
+	from := e.cursor
+	if to < from {
+		from, to = to, from
+	} else if inclusive {
+		to = min(to+1, len(e.Input))
+	}
+	e.viOperate(op, from, to)
+	return true
+}
+
+// viOperate deletes (d), changes (c) or yanks (y) the text from from
+// to to, it's kept in the register for p to put it back
+func (e *Editor) viOperate(op rune, from, to int) {
+	e.vi.register = slices.Clone(e.Input[from:to])
+	if op != 'y' {
+		e.Input = slices.Delete(e.Input, from, to)
+	}
+	e.cursor = from
+	if op == 'c' {
+		e.viEnterInsert()
+	}
+}
+
+// viPut puts the register n times after the cursor,
+// or before it, with the cursor on its last character
+func (e *Editor) viPut(after bool, n int) bool {
+	if len(e.vi.register) == 0 {
+		fmt.Print("\a")
+		return false
+	}
+	if after && len(e.Input) > 0 {
+		e.cursor++
+	}
+	e.insertString(strings.Repeat(string(e.vi.register), n))
+	e.cursor--
+	return true
+}
+
+// viMotion returns where the motion c goes n times from the cursor
+// and whether the character there is part of the motion for operators
+func (e *Editor) viMotion(c, n int) (to int, inclusive, found bool) {
+	v := e.vi
+	line, at := e.Input, e.cursor
+
+	switch c {
+	case 'h', ARROW_LEFT, BACKSPACE, _CTRL_KEY('h'):
+		return max(at-n, 0), false, at > 0
+
+	case 'l', ARROW_RIGHT, ' ':
+		return min(at+n, len(line)), false, at < len(line)
+
+	case '0', HOME_KEY:
+		return 0, false, true
+
+	case '^':
+		for at = 0; at < len(line) && viClass(line[at], false) == 0; at++ {
+		}
+		return at, false, true
+
+	case '$', END_KEY:
+		return max(len(line)-1, 0), true, true
+
+	case '|':
+		return min(n-1, max(len(line)-1, 0)), false, true
+
+	case 'w', 'W':
+		for range n {
+			at = viNextWord(line, at, c == 'W')
+		}
+		return at, false, true
+
+	case 'b', 'B':
+		for range n {
+			at = viPrevWord(line, at, c == 'B')
+		}
+		return at, false, e.cursor > 0
+
+	case 'e', 'E':
+		for range n {
+			at = viWordEnd(line, at, c == 'E')
+		}
+		return at, true, len(line) > 0
+
+	case 'f', 'F', 't', 'T':
+		char := e.viReadKey()
+		v.lastFind, v.lastFindChar = c, char
+		return e.viFind(c, char, n)
+
+	case ';', ',':
+		if v.lastFind == 0 {
+			return 0, false, false
+		}
+		kind := v.lastFind
+		if c == ',' {
+			kind = map[int]int{'f': 'F', 'F': 'f', 't': 'T', 'T': 't'}[kind]
+		}
+		return e.viFind(kind, v.lastFindChar, n)
+	}
+	return 0, false, false
+}
+
+// viFind finds the n-th char after the cursor with f and t or
+// before it with F and T, t and T stop next to it
+func (e *Editor) viFind(kind, char, n int) (int, bool, bool) {
+	if char > unicode.MaxRune {
+		return 0, false, false
+	}
+	line, at := e.Input, e.cursor
+	forward := kind == 'f' || kind == 't'
+
+	for range n {
+		i := -1
+		if forward && at+1 <= len(line) {
+			if i = slices.Index(line[at+1:], rune(char)); i >= 0 {
+				i += at + 1
+			}
+		} else if !forward {
+			i = runesLastIndex(line[:at], []rune{rune(char)})
+		}
+		if i < 0 {
+			return 0, false, false
+		}
+		at = i
+	}
+
+	switch kind {
+	case 't':
+		at--
+	case 'T':
+		at++
+	}
+	return at, forward, true
+}
+
+// viClass is 0 for blanks and tells apart the characters of
+// words from the other ones, a big WORD is only made of non blanks
+func viClass(char rune, big bool) int {
+	switch {
+	case char == ' ' || char == '\t':
+		return 0
+	case big || isWordChar(char) || char == '_':
+		return 1
+	}
+	return 2
+}
+
+// viRunEnd is the end of the run of characters of the same class at at
+func viRunEnd(line []rune, at int, big bool) int {
+	class := viClass(line[at], big)
+	for at < len(line) && viClass(line[at], big) == class {
+		at++
+	}
+	return at
+}
+
+// viNextWord is the start of the word after at
+func viNextWord(line []rune, at int, big bool) int {
+	if at < len(line) && viClass(line[at], big) != 0 {
+		at = viRunEnd(line, at, big)
+	}
+	for at < len(line) && viClass(line[at], big) == 0 {
+		at++
+	}
+	return at
+}
+
+// viPrevWord is the start of the word before at
+func viPrevWord(line []rune, at int, big bool) int {
+	for at > 0 && viClass(line[at-1], big) == 0 {
+		at--
+	}
+	if at == 0 {
+		return 0
+	}
+	class := viClass(line[at-1], big)
+	for at > 0 && viClass(line[at-1], big) == class {
+		at--
+	}
+	return at
+}
+
+// viWordEnd is the last character of the word after at
+func viWordEnd(line []rune, at int, big bool) int {
+	at++
+	for at < len(line) && viClass(line[at], big) == 0 {
+		at++
+	}
+	if at >= len(line) {
+		return max(len(line)-1, 0)
+	}
+	return viRunEnd(line, at, big) - 1
+}
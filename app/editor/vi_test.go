@@ -0,0 +1,115 @@
+package editor
+
+import "testing"
+
+func TestViCommands(t *testing.T) {
+	table := []struct {
+		name string
+		// typed in insert mode, ESC then goes to normal mode
+		line string
+		keys string
+		// the line with | for the cursor
+		want string
+	}{
+		{"esc goes on the last character", "abc", "", "ab|c"},
+		{"0 goes to the start", "one two three", "0", "|one two three"},
+		{"w goes to the next word", "one two three", "0w", "one |two three"},
+		{"w with a count", "one two three", "02w", "one two |three"},
+		{"w stops at punctuation", "a.b c", "0w", "a|.b c"},
+		{"W goes over punctuation", "a.b c", "0W", "a.b |c"},
+		{"b goes back a word", "one two three", "b", "one two |three"},
+		{"e goes to the end of the word", "one two three", "0e", "on|e two three"},
+		{"$ goes to the last character", "one two three", "0$", "one two thre|e"},
+		{"h with a count", "abcdef", "3h", "ab|cdef"},
+		{"f finds a character", "one two three", "0fo", "one tw|o three"},
+		{"t stops before it", "one two three", "0to", "one t|wo three"},
+		{"F finds backward", "one two three", "Fo", "one tw|o three"},
+		{"T stops after it", "one two three", "To", "one two| three"},
+		{"f with a count", "a-b-c-d", "02f-", "a-b|-c-d"},
+		{"; repeats the find", "a-b-c-d", "0f-;", "a-b|-c-d"},
+		{", repeats it the other way", "a-b-c-d", "0f-;;,", "a-b|-c-d"},
+		{"f without a match stays", "abc", "0fz", "|abc"},
+
+		{"dw deletes a word", "one two three", "0dw", "|two three"},
+		{"d2w deletes two words", "one two three", "0d2w", "|three"},
+		{"2dw deletes two words", "one two three", "02dw", "|three"},
+		{"counts multiply", "a b c d e f", "02d2w", "|e f"},
+		{"de keeps the blank", "one two three", "0de", "| two three"},
+		{"db deletes backward", "one two three", "db", "one two |e"},
+		{"dh deletes the character before", "one two three", "dh", "one two thr|e"},
+		{"d$ deletes to the end", "one two three", "0wd$", "one| "},
+		{"dfo deletes to the character", "one two three", "0dfo", "| three"},
+		{"dto stops before it", "one two three", "0dto", "|o three"},
+		{"dd deletes the line", "one two three", "wdd", "|"},
+		{"d with a failed motion rings", "abc", "0dfz", "|abc"},
+		{"x deletes under the cursor", "abc", "0x", "|bc"},
+		{"X deletes before the cursor", "abc", "X", "a|c"},
+		{"~ toggles the case", "abc", "03~", "AB|C"},
+		{"r replaces", "abc", "02rx", "x|xc"},
+
+		{"cw changes to the end of the word", "one two three", "0cwONE\x1b", "ON|E two three"},
+		{"c2w changes two words", "one two three", "0c2wX\x1b", "|X three"},
+		{"cw on a blank changes the blank", "one two", "0lllcwX\x1b", "one|Xtwo"},
+		{"cc changes the line", "one two", "ccnew\x1b", "ne|w"},
+		{"C changes to the end", "one two", "0wCthree\x1b", "one thre|e"},
+
+		{"yy goes to the start and p puts after it", "abc", "yyp", "aab|cbc"},
+		{"yw then P puts the word before", "one two", "0ywP", "one| one two"},
+		{"p with a count", "ab", "0yl3p", "aaa|ab"},
+		{"x then p swaps", "abc", "0xp", "b|ac"},
+		{"y keeps the cursor at the start", "one two", "yb", "one |two"},
+		{"p without a register rings", "abc", "0p", "|abc"},
+
+		{". repeats dw", "a b c d e f", "0dw.", "|c d e f"},
+		{". takes a new count", "a b c d e f", "0dw3.", "|e f"},
+		{". keeps the count", "a b c d e f", "02dw.", "|e f"},
+		{". replaces the count", "a b c d e f", "02dw3.", "|f"},
+		{". repeats x with its count", "abcdef", "03x.", "|"},
+		{". repeats an insert", "abc", "0iX\x1bl.", "X|Xabc"},
+		{". repeats cw", "one two three", "0cwX\x1bw.", "X |X three"},
+		{". without a change rings", "abc", "0.", "|abc"},
+		{"moves aren't repeated", "abcdef", "0x$.", "bcd|e"},
+
+		{"u undoes the typed text at once", "one two", "u", "|"},
+		{"u undoes a delete", "one two three", "0dwu", "|one two three"},
+		{"u goes back one change at a time", "one two three", "0dwdwu", "|two three"},
+		{"u undoes cw with the text typed", "one two three", "0cwX\x1bu", "|one two three"},
+		{"u undoes a repeat", "abc", "0x.u", "|bc"},
+		{"u undoes a put", "abc", "yypu", "|abc"},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			e := newTestEditor(t)
+			e.SetViMode(true)
+			typeKeys(e, entry.line, "\x1b")
+			// each key on its own so ESC isn't read as Alt, but typed
+			// at once for the operators to read their motion
+			keys := []string{}
+			for _, key := range entry.keys {
+				keys = append(keys, string(key))
+			}
+			typeKeys(e, keys...)
+			assertLine(t, entry.want, e)
+		})
+	}
+}
+
+func TestViModes(t *testing.T) {
+	e := newTestEditor(t)
+	e.SetViMode(true)
+	assertEqual(t, ViInsertMode, e.mode())
+	typeKeys(e, "abc", "\x1b")
+	assertEqual(t, ViCommandMode, e.mode())
+	typeKeys(e, "A")
+	assertEqual(t, ViInsertMode, e.mode())
+	assertLine(t, "abc|", e)
+
+	// ESC and a key at once are still ESC then the key
+	typeKeys(e, "\x1b0")
+	assertEqual(t, ViCommandMode, e.mode())
+	assertLine(t, "|abc", e)
+
+	e.SetViMode(false)
+	assertEqual(t, EmacsMode, e.mode())
+}
@@ -0,0 +1,93 @@
+package editor
+
+import "testing"
+
+func TestRuneWidth(t *testing.T) {
+	t.Run("runeWidth should count the columns of a character", func(t *testing.T) {
+		table := []struct {
+			name  string
+			input rune
+			want  int
+		}{
+			{"ascii", 'a', 1},
+			{"latin", 'é', 1},
+			{"cjk", '世', 2},
+			{"hangul", '한', 2},
+			{"fullwidth", 'Ａ', 2},
+			{"emoji", '😀', 2},
+			{"combining mark", '\u0301', 0},
+			{"zero width space", '\u200b', 0},
+			{"tab", '\t', 0},
+			{"escape", '\x1b', 0},
+			{"delete", '\x7f', 0},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.name, func(t *testing.T) {
+				assertEqual(t, entry.want, runeWidth(entry.input))
+			})
+		}
+	})
+
+	t.Run("stringWidth should add up the columns", func(t *testing.T) {
+		assertEqual(t, 0, stringWidth(""))
+		assertEqual(t, 6, stringWidth("e\u0301世界!"))
+	})
+}
+
+func TestLayout(t *testing.T) {
+	t.Run("layout should wrap the prompt and the line over rows", func(t *testing.T) {
+		table := []struct {
+			name   string
+			cols   int
+			prompt string
+			line   string
+			row    int
+			col    int
+		}{
+			{"empty", 10, "", "", 0, 0},
+			{"short", 10, "$ ", "ls", 0, 4},
+			{"full row", 10, "$ ", "abcdefgh", 0, 10},
+			{"wrapped", 10, "$ ", "abcdefghi", 1, 1},
+			{"wide fits", 10, "$ ", "abcdef世", 0, 10},
+			{"wide at the row end", 10, "$ ", "abcdefg世", 1, 2},
+			{"hidden prompt", 10, "\x01\x1b[32m\x02$ \x01\x1b[0m\x02", "abcdefgh", 0, 10},
+			{"hidden wrapped", 10, "\x01\x1b[32m\x02$ \x01\x1b[0m\x02", "abcdefghi", 1, 1},
+			{"newline in prompt", 10, "dir\n$ ", "ls", 1, 4},
+			{"newline in line", 10, "$ ", "echo 'a\nbc", 1, 2},
+			{"newline after full row", 10, "$ ", "abcdefgh\nx", 1, 1},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.name, func(t *testing.T) {
+				row, col := layout(entry.cols, entry.prompt, []rune(entry.line))
+				assertEqual(t, [2]int{entry.row, entry.col}, [2]int{row, col})
+			})
+		}
+	})
+
+	t.Run("cursorPosition should move past a full row", func(t *testing.T) {
+		table := []struct {
+			name   string
+			line   string
+			cursor int
+			row    int
+			col    int
+		}{
+			{"start", "abcdefghij", 0, 0, 2},
+			{"middle", "abcdefghij", 3, 0, 5},
+			{"end of a full row", "abcdefgh", 8, 1, 0},
+			{"on the next row", "abcdefghij", 9, 1, 1},
+			{"before a wide character", "abcdefg世", 7, 0, 9},
+			{"after a wrapped wide character", "abcdefg世", 8, 1, 2},
+			{"after a newline", "ab\ncd", 3, 1, 0},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.name, func(t *testing.T) {
+				row, col := cursorPosition(10, "$ ", []rune(entry.line), entry.cursor)
+				assertEqual(t, [2]int{entry.row, entry.col}, [2]int{row, col})
+			})
+		}
+	})
+}
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/codecrafters-io/shell-starter-go/app/commands"
 	"github.com/codecrafters-io/shell-starter-go/app/editor"
@@ -11,38 +16,141 @@ import (
 type Shell struct {
 	editor *editor.Editor
 	parser *shellparser.Parser
+	state  *commands.State
 }
 
 func NewShell(e *editor.Editor, p *shellparser.Parser) *Shell {
+	// Ctrl-C and Ctrl-\ only reach the foreground job, the shell gets
+	// them too when it is the foreground itself and must survive them,
+	// signal.Ignore would be inherited by every program it runs,
+	// builtins waiting for jobs give up on Ctrl-C through them
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGQUIT)
+
+	state := commands.NewState()
+	state.Jobs.SetInterrupts(interrupts)
+	state.History = editorHistory{e.History()}
+	state.Bindings = editorBindings{e.Bindings()}
+	// set editing-mode vi in the inputrc file is set -o vi
+	if e.Bindings().EditingMode() == "vi" {
+		state.Options.SetFlag("vi", true)
+	}
+	// HISTSIZE, EDITOR and the others can change as shell variables
+	e.SetLookup(state.Vars.Get)
+	e.SetCompleter(func(words []string, line string) (editor.CompResult, bool) {
+		result, found := state.Complete(words, line)
+		return editor.CompResult(result), found
+	})
+	e.SetCommands(func() ([]string, int) {
+		names, version := state.CommandNames()
+		return append(commands.Builtins(), names...), version
+	})
+
 	return &Shell{
 		editor: e,
 		parser: p,
+		state:  state,
 	}
 }
 
+// editorHistory is the history of the line editor for the history builtin
+type editorHistory struct {
+	*editor.History
+}
+
+func (h editorHistory) Entries() (int, []commands.HistoryEntry) {
+	first, entries := h.History.Entries()
+	list := make([]commands.HistoryEntry, len(entries))
+	for i, entry := range entries {
+		list[i] = commands.HistoryEntry(entry)
+	}
+	return first, list
+}
+
+// editorKeymaps is embedded under this name in editorBindings,
+// whose Bindings method can't share its name with a field
+type editorKeymaps = editor.Bindings
+
+// editorBindings are the key bindings of the line editor for the bind builtin
+type editorBindings struct {
+	*editorKeymaps
+}
+
+func (b editorBindings) Bindings(keymap string) ([]commands.KeyBinding, error) {
+	bindings, err := b.editorKeymaps.Bindings(keymap)
+	list := make([]commands.KeyBinding, len(bindings))
+	for i, kb := range bindings {
+		list[i] = commands.KeyBinding(kb)
+	}
+	return list, err
+}
+
 func (sh *Shell) Start() int {
 	isExit, exitCode := false, 0
 
-	editor := sh.editor
 	parser := sh.parser
+	defer sh.state.Jobs.Release()
 
 	for !isExit {
 		var err error
 
-		// take input
-		rawInput := editor.TakeInput()
+		// tell about background jobs that finished
+		sh.state.Jobs.Notify(os.Stderr)
+
+		if isExit, exitCode = sh.state.PromptCommand(); isExit {
+			break
+		}
+
+		// take input, in the editing mode of set -o
+		sh.editor.SetViMode(sh.state.Options.Flag("vi"))
+		rawInput, err := sh.editor.TakeInput(sh.state.Prompt("PS1"))
+		if errors.Is(err, editor.ErrInterrupted) {
+			// bash uses 128+SIGINT for a line discarded with Ctrl-C
+			sh.state.LastStatus = 130
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			fmt.Println("exit")
+			exitCode = sh.state.LastStatus
+			break
+		}
+
+		// parse input into a syntax tree, the lines after PS2 go
+		// on with it until its quotes and operators are complete
+		list, err := parser.Parse(rawInput)
+		for errors.Is(err, shellparser.ErrIncomplete) {
+			more, readErr := sh.editor.TakeInput(sh.state.Prompt("PS2"))
+			if errors.Is(readErr, io.EOF) {
+				// the error is reported below
+				fmt.Println()
+				break
+			}
+			if readErr != nil {
+				err = readErr
+				break
+			}
+			rawInput = append(rawInput, more...)
+			list, err = parser.Parse(rawInput)
+		}
+		if errors.Is(err, editor.ErrInterrupted) {
+			sh.state.LastStatus = 130
+			continue
+		}
 
-		// parse input into
-		inputStringArr, err := parser.Parse(rawInput)
-		// fmt.Printf("%#v", inputStringArr)
+		if err := sh.editor.History().Add(string(rawInput)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
 
 		if err != nil {
 			fmt.Println(err)
+			// bash uses 2 for syntax errors
+			sh.state.LastStatus = 2
 			continue
 		}
 
 		// prepare and start commands
-		isExit, exitCode = commands.StartCommands(inputStringArr)
+		// ErrAborted only tells the rest of the line was dropped
+		isExit, exitCode, _ = commands.StartCommands(sh.state, list)
 	}
 
 	return exitCode
@@ -0,0 +1,326 @@
+package shellparser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// List is the root of a parsed input, a sequence of
+// and-or lists separated by ";", "&" or newlines
+type List struct {
+	Items []*AndOr
+}
+
+type AndOrOp int
+
+const (
+	OpAnd AndOrOp = iota // &&
+	OpOr                 // ||
+)
+
+// AndOr is pipelines joined with "&&" and "||", Ops[i]
+// decides if Pipelines[i+1] runs after Pipelines[i],
+// Background is true when it was followed by "&"
+type AndOr struct {
+	Pipelines  []*Pipeline
+	Ops        []AndOrOp
+	Background bool
+}
+
+// Pipeline is one or more commands connected with "|"
+type Pipeline struct {
+	Commands []*SimpleCommand
+}
+
+// SimpleCommand is a command name with its arguments and redirections,
+// Assigns are the NAME=value words written before the command name,
+// Compound is set instead of them for an if or a loop and the
+// redirections apply to all of it
+type SimpleCommand struct {
+	Assigns   []*Assignment
+	Words     []*Word
+	Redirects []*Redirect
+	Compound  Compound
+}
+
+// Compound is a command made of lists, an *IfClause or a *LoopClause
+type Compound interface {
+	compound()
+}
+
+// IfClause runs Bodies[i] for the first Conds[i] that succeeds,
+// or Else when none does
+type IfClause struct {
+	Conds  []*List
+	Bodies []*List
+	Else   *List
+}
+
+// LoopClause runs Body as long as Cond succeeds, or until it does
+// when Until is true
+type LoopClause struct {
+	Until bool
+	Cond  *List
+	Body  *List
+}
+
+func (*IfClause) compound()   {}
+func (*LoopClause) compound() {}
+
+// Assignment is a NAME=value word
+type Assignment struct {
+	Name  string
+	Value *Word
+}
+
+type RedirectOp int
+
+const (
+	RedirectInput        RedirectOp = iota // <
+	RedirectOutput                         // >
+	RedirectAppend                         // >>
+	RedirectHeredoc                        // <<
+	RedirectHeredocStrip                   // <<-
+	RedirectHereString                     // <<<
+	RedirectDupInput                       // <&
+	RedirectDupOutput                      // >&
+	RedirectReadWrite                      // <>
+	RedirectClobber                        // >|
+	RedirectAll                            // &>
+	RedirectAppendAll                      // &>>
+)
+
+// Redirect applies Op on file descriptor Fd using Target as the file name,
+// for <& and >& Target is the descriptor to copy or - to close Fd,
+// for here-documents Target is the delimiter and Heredoc the body, expanded
+// like a double quoted word unless the delimiter was quoted
+type Redirect struct {
+	Fd      int
+	Op      RedirectOp
+	Target  *Word
+	Heredoc *Word
+}
+
+// Word is a single shell word made of parts that keep
+// track of how they were quoted in the input
+type Word struct {
+	Parts []WordPart
+}
+
+type WordPart interface {
+	wordPart()
+}
+
+// Literal is a plain piece of text, Quoted is true when it was
+// written inside quotes or escaped with a backslash
+type Literal struct {
+	Value  string
+	Quoted bool
+}
+
+// Param is a parameter expansion like $NAME or ${NAME:-word}, Op is
+// the operator between the name and Arg, Length is true for ${#NAME}
+// and Quoted is true when it was written inside double quotes
+type Param struct {
+	Name   string
+	Op     string
+	Arg    *Word
+	Length bool
+	Quoted bool
+}
+
+// CmdSubst is a command substitution like $(cmd) or `cmd`, Quoted
+// is true when it was written inside double quotes
+type CmdSubst struct {
+	List   *List
+	Quoted bool
+}
+
+func (*Literal) wordPart()  {}
+func (*Param) wordPart()    {}
+func (*CmdSubst) wordPart() {}
+
+func (l *List) String() string {
+	var sb strings.Builder
+	for i, item := range l.Items {
+		if i > 0 {
+			if l.Items[i-1].Background {
+				sb.WriteString(" ")
+			} else {
+				sb.WriteString("; ")
+			}
+		}
+		sb.WriteString(item.String())
+		if item.Background {
+			sb.WriteString(" &")
+		}
+	}
+	return sb.String()
+}
+
+func (op AndOrOp) String() string {
+	if op == OpAnd {
+		return "&&"
+	}
+	return "||"
+}
+
+func (a *AndOr) String() string {
+	var sb strings.Builder
+	for i, p := range a.Pipelines {
+		if i > 0 {
+			sb.WriteString(" " + a.Ops[i-1].String() + " ")
+		}
+		sb.WriteString(p.String())
+	}
+	return sb.String()
+}
+
+func (p *Pipeline) String() string {
+	strs := make([]string, 0, len(p.Commands))
+	for _, c := range p.Commands {
+		strs = append(strs, c.String())
+	}
+	return strings.Join(strs, " | ")
+}
+
+func (c *SimpleCommand) String() string {
+	strs := make([]string, 0, len(c.Assigns)+len(c.Words)+len(c.Redirects)+1)
+	switch compound := c.Compound.(type) {
+	case *IfClause:
+		strs = append(strs, compound.String())
+	case *LoopClause:
+		strs = append(strs, compound.String())
+	}
+	for _, a := range c.Assigns {
+		strs = append(strs, a.Name+"="+a.Value.String())
+	}
+	for _, w := range c.Words {
+		strs = append(strs, w.String())
+	}
+	for _, r := range c.Redirects {
+		strs = append(strs, r.String())
+	}
+	return strings.Join(strs, " ")
+}
+
+func (c *IfClause) String() string {
+	var sb strings.Builder
+	for i, cond := range c.Conds {
+		if i == 0 {
+			sb.WriteString("if ")
+		} else {
+			sb.WriteString("elif ")
+		}
+		sb.WriteString(blockString(cond) + "then " + blockString(c.Bodies[i]))
+	}
+	if c.Else != nil {
+		sb.WriteString("else " + blockString(c.Else))
+	}
+	sb.WriteString("fi")
+	return sb.String()
+}
+
+func (c *LoopClause) String() string {
+	keyword := "while "
+	if c.Until {
+		keyword = "until "
+	}
+	return keyword + blockString(c.Cond) + "do " + blockString(c.Body) + "done"
+}
+
+// blockString is the list ended with the separator it
+// needs before the reserved word that follows it
+func blockString(l *List) string {
+	if len(l.Items) > 0 && l.Items[len(l.Items)-1].Background {
+		return l.String() + " "
+	}
+	return l.String() + "; "
+}
+
+func (op RedirectOp) String() string {
+	switch op {
+	case RedirectInput:
+		return "<"
+	case RedirectOutput:
+		return ">"
+	case RedirectAppend:
+		return ">>"
+	case RedirectHeredoc:
+		return "<<"
+	case RedirectHeredocStrip:
+		return "<<-"
+	case RedirectHereString:
+		return "<<<"
+	case RedirectDupInput:
+		return "<&"
+	case RedirectDupOutput:
+		return ">&"
+	case RedirectReadWrite:
+		return "<>"
+	case RedirectClobber:
+		return ">|"
+	case RedirectAll:
+		return "&>"
+	case RedirectAppendAll:
+		return "&>>"
+	}
+	return "?"
+}
+
+// IsInput reports if the operator redirects the
+// standard input when no file descriptor is written
+func (op RedirectOp) IsInput() bool {
+	switch op {
+	case RedirectInput, RedirectHeredoc, RedirectHeredocStrip, RedirectHereString, RedirectDupInput, RedirectReadWrite:
+		return true
+	}
+	return false
+}
+
+// String leaves out the file descriptor when it's the default of the operator
+func (r *Redirect) String() string {
+	fd := strconv.Itoa(r.Fd)
+	if (r.Op.IsInput() && r.Fd == 0) || (!r.Op.IsInput() && r.Fd == 1) {
+		fd = ""
+	}
+	return fd + r.Op.String() + r.Target.String()
+}
+
+// String rebuilds the word as it could be typed back into the shell
+func (w *Word) String() string {
+	var sb strings.Builder
+	for _, part := range w.Parts {
+		switch part := part.(type) {
+		case *Literal:
+			if part.Quoted {
+				sb.WriteString("'" + strings.ReplaceAll(part.Value, "'", `'\''`) + "'")
+			} else {
+				sb.WriteString(part.Value)
+			}
+		case *Param:
+			if part.Quoted {
+				sb.WriteString(`"` + part.String() + `"`)
+			} else {
+				sb.WriteString(part.String())
+			}
+		case *CmdSubst:
+			if part.Quoted {
+				sb.WriteString(`"$(` + part.List.String() + `)"`)
+			} else {
+				sb.WriteString("$(" + part.List.String() + ")")
+			}
+		}
+	}
+	return sb.String()
+}
+
+func (p *Param) String() string {
+	switch {
+	case p.Length:
+		return "${#" + p.Name + "}"
+	case p.Op == "":
+		return "${" + p.Name + "}"
+	}
+	return "${" + p.Name + p.Op + p.Arg.String() + "}"
+}
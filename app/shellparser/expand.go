@@ -0,0 +1,388 @@
+package shellparser
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Env provides the values of parameters during expansion
+// and runs the commands of command substitutions
+type Env interface {
+	Get(name string) (string, bool)
+	Set(name, value string) error
+	Substitute(list *List) (string, error)
+	GlobOptions() GlobOptions
+}
+
+const defaultIFS = " \t\n"
+
+// ExpandWords turns parsed words into the final argument strings,
+// the results of unquoted expansions are split into fields on IFS
+// and fields with unquoted pattern characters are matched against files
+func ExpandWords(words []*Word, env Env) ([]string, error) {
+	opts := env.GlobOptions()
+	res := make([]string, 0, len(words))
+	for _, w := range words {
+		fields, err := expandFields(w, env)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			matches, err := expandGlob(f, opts)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, matches...)
+		}
+	}
+	return res, nil
+}
+
+// ExpandWord expands a single word, used where no field
+// splitting happens like assignments
+func ExpandWord(w *Word, env Env) (string, error) {
+	var sb strings.Builder
+	for i, part := range w.Parts {
+		switch part := part.(type) {
+		case *Literal:
+			sb.WriteString(literalValue(w, i, env))
+		case *Param:
+			value, err := expandParam(part, env)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(value)
+		case *CmdSubst:
+			value, err := expandSubst(part, env)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(value)
+		}
+	}
+	return sb.String(), nil
+}
+
+// expandSubst runs a command substitution, its output
+// is used without the trailing newlines
+func expandSubst(subst *CmdSubst, env Env) (string, error) {
+	out, err := env.Substitute(subst.List)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out, "\n"), nil
+}
+
+// literalValue is the value of the i-th part of w which has to be a
+// literal, the first one goes through tilde expansion when unquoted
+func literalValue(w *Word, i int, env Env) string {
+	part := w.Parts[i].(*Literal)
+	value := part.Value
+	// a quoted part right after ~ disables the expansion
+	if i == 0 && !part.Quoted && (len(w.Parts) == 1 || value != "~") {
+		value = expandTilde(value, env)
+	}
+	return value
+}
+
+// ~ and ~/path are replaced with $HOME, ~name and ~name/path
+// with the home directory of that user when there is one
+func expandTilde(s string, env Env) string {
+	if s == "~" || strings.HasPrefix(s, "~/") {
+		home, _ := env.Get("HOME")
+		return home + s[1:]
+	}
+	if !strings.HasPrefix(s, "~") {
+		return s
+	}
+	name, _, _ := strings.Cut(s[1:], "/")
+	if u, err := user.Lookup(name); err == nil {
+		return u.HomeDir + s[1+len(name):]
+	}
+	return s
+}
+
+// field is a word after expansion, pattern is the same text with
+// the quoted characters escaped and hasGlob is true when it has
+// unquoted pattern characters
+type field struct {
+	value   string
+	pattern string
+	hasGlob bool
+}
+
+// fieldBuilder collects the fields a word expands to
+type fieldBuilder struct {
+	fields  []field
+	cur     strings.Builder
+	pattern strings.Builder
+	hasGlob bool
+
+	// started is true once the current field exists even
+	// if empty, like after "" or a non whitespace separator
+	started bool
+	// splitOnSpace is true right after a field ended on IFS whitespace,
+	// so that a following non whitespace separator doesn't end another
+	splitOnSpace bool
+}
+
+func (fb *fieldBuilder) write(s string, quoted bool) {
+	fb.cur.WriteString(s)
+	if quoted {
+		fb.pattern.WriteString(QuotePattern(s))
+	} else {
+		fb.pattern.WriteString(s)
+		fb.hasGlob = fb.hasGlob || HasGlobChars(s)
+	}
+	fb.started = true
+	fb.splitOnSpace = false
+}
+
+func (fb *fieldBuilder) endField() {
+	fb.fields = append(fb.fields, field{
+		value:   fb.cur.String(),
+		pattern: fb.pattern.String(),
+		hasGlob: fb.hasGlob,
+	})
+	fb.cur.Reset()
+	fb.pattern.Reset()
+	fb.hasGlob = false
+	fb.started = false
+}
+
+// split writes the result of an unquoted expansion, ending
+// the current field on every IFS character
+func (fb *fieldBuilder) split(value, ifs string) {
+	for _, ch := range value {
+		switch {
+		case !strings.ContainsRune(ifs, ch):
+			fb.write(string(ch), false)
+		case strings.ContainsRune(defaultIFS, ch):
+			if fb.started {
+				fb.endField()
+				fb.splitOnSpace = true
+			}
+		case fb.splitOnSpace:
+			fb.splitOnSpace = false
+		default:
+			fb.endField()
+		}
+	}
+}
+
+func expandFields(w *Word, env Env) ([]field, error) {
+	ifs, found := env.Get("IFS")
+	if !found {
+		ifs = defaultIFS
+	}
+
+	fb := &fieldBuilder{}
+	if err := fb.addWord(w, env, ifs); err != nil {
+		return nil, err
+	}
+
+	if fb.started {
+		fb.endField()
+	}
+	return fb.fields, nil
+}
+
+func (fb *fieldBuilder) addWord(w *Word, env Env, ifs string) error {
+	for i, part := range w.Parts {
+		switch part := part.(type) {
+		case *Literal:
+			value := literalValue(w, i, env)
+			if value != "" || part.Quoted {
+				fb.write(value, part.Quoted)
+			}
+		case *Param:
+			// the word of an unquoted ${NAME:-word} keeps its own quoting
+			if arg, useArg := selectArg(part, env); useArg && !part.Quoted {
+				if err := fb.addWord(arg, env, ifs); err != nil {
+					return err
+				}
+				continue
+			}
+
+			value, err := expandParam(part, env)
+			if err != nil {
+				return err
+			}
+			if part.Quoted {
+				fb.write(value, true)
+			} else {
+				fb.split(value, ifs)
+			}
+		case *CmdSubst:
+			value, err := expandSubst(part, env)
+			if err != nil {
+				return err
+			}
+			if part.Quoted {
+				fb.write(value, true)
+			} else {
+				fb.split(value, ifs)
+			}
+		}
+	}
+	return nil
+}
+
+// selectArg reports if p expands to its word instead of its value,
+// which is the case of ${NAME-word} and ${NAME+word}
+func selectArg(p *Param, env Env) (*Word, bool) {
+	_, isNull := lookupParam(p, env)
+
+	switch p.Op {
+	case "-", ":-":
+		return p.Arg, isNull
+	case "+", ":+":
+		return p.Arg, !isNull
+	}
+	return nil, false
+}
+
+// ParamError is raised by ${NAME?message} when NAME is not set
+type ParamError struct {
+	Name    string
+	Message string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("bash: %s: %s", e.Name, e.Message)
+}
+
+// lookupParam returns the value of p and if it counts as not set,
+// with a colon in the operator an empty value counts as not set too
+func lookupParam(p *Param, env Env) (value string, isNull bool) {
+	value, isSet := env.Get(p.Name)
+	return value, !isSet || (strings.HasPrefix(p.Op, ":") && value == "")
+}
+
+func expandParam(p *Param, env Env) (string, error) {
+	value, isNull := lookupParam(p, env)
+
+	if p.Length {
+		return strconv.Itoa(utf8.RuneCountInString(value)), nil
+	}
+
+	if arg, useArg := selectArg(p, env); useArg {
+		return ExpandWord(arg, env)
+	}
+
+	switch p.Op {
+	case "+", ":+":
+		return "", nil
+
+	case "=", ":=":
+		if !isNull {
+			return value, nil
+		}
+		if !IsValidName(p.Name) {
+			return "", fmt.Errorf("bash: $%s: cannot assign in this way", p.Name)
+		}
+		value, err := ExpandWord(p.Arg, env)
+		if err != nil {
+			return "", err
+		}
+		if err := env.Set(p.Name, value); err != nil {
+			return "", err
+		}
+		return value, nil
+
+	case "?", ":?":
+		if !isNull {
+			return value, nil
+		}
+		message, err := ExpandWord(p.Arg, env)
+		if err != nil {
+			return "", err
+		}
+		if message == "" {
+			message = "parameter null or not set"
+		}
+		return "", &ParamError{Name: p.Name, Message: message}
+
+	case "#", "##", "%", "%%":
+		pattern, err := expandPattern(p.Arg, env)
+		if err != nil {
+			return "", err
+		}
+		return removePattern(value, pattern, p.Op), nil
+	}
+
+	return value, nil
+}
+
+// expandPattern expands a word that is used as a pattern,
+// quoted parts are escaped so they only match themselves
+func expandPattern(w *Word, env Env) (string, error) {
+	var sb strings.Builder
+	for i, part := range w.Parts {
+		switch part := part.(type) {
+		case *Literal:
+			value := literalValue(w, i, env)
+			if part.Quoted {
+				value = QuotePattern(value)
+			}
+			sb.WriteString(value)
+		case *Param:
+			value, err := expandParam(part, env)
+			if err != nil {
+				return "", err
+			}
+			if part.Quoted {
+				value = QuotePattern(value)
+			}
+			sb.WriteString(value)
+		case *CmdSubst:
+			value, err := expandSubst(part, env)
+			if err != nil {
+				return "", err
+			}
+			if part.Quoted {
+				value = QuotePattern(value)
+			}
+			sb.WriteString(value)
+		}
+	}
+	return sb.String(), nil
+}
+
+// removePattern removes the shortest (# and %) or longest (## and %%)
+// prefix (# and ##) or suffix (% and %%) of value matching pattern
+func removePattern(value, pattern, op string) string {
+	runes := []rune(value)
+	n := len(runes)
+
+	switch op {
+	case "#":
+		for i := 0; i <= n; i++ {
+			if MatchPattern(pattern, string(runes[:i])) {
+				return string(runes[i:])
+			}
+		}
+	case "##":
+		for i := n; i >= 0; i-- {
+			if MatchPattern(pattern, string(runes[:i])) {
+				return string(runes[i:])
+			}
+		}
+	case "%":
+		for i := n; i >= 0; i-- {
+			if MatchPattern(pattern, string(runes[i:])) {
+				return string(runes[:i])
+			}
+		}
+	case "%%":
+		for i := 0; i <= n; i++ {
+			if MatchPattern(pattern, string(runes[i:])) {
+				return string(runes[:i])
+			}
+		}
+	}
+	return value
+}
@@ -0,0 +1,341 @@
+package shellparser
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+)
+
+// mapEnv is an Env backed by a map for tests
+type mapEnv map[string]string
+
+func (e mapEnv) Get(name string) (string, bool) {
+	value, found := e[name]
+	return value, found
+}
+
+func (e mapEnv) Set(name, value string) error {
+	e[name] = value
+	return nil
+}
+
+// Substitute fakes running the commands by printing them back
+func (e mapEnv) Substitute(list *List) (string, error) {
+	return "<" + list.String() + ">\n\n", nil
+}
+
+func (e mapEnv) GlobOptions() GlobOptions {
+	return GlobOptions{}
+}
+
+// globEnv is a mapEnv with shopt options set
+type globEnv struct {
+	mapEnv
+	opts GlobOptions
+}
+
+func (e globEnv) GlobOptions() GlobOptions {
+	return e.opts
+}
+
+func expandInput(t testing.TB, input string, env Env) ([]string, error) {
+	t.Helper()
+	list, err := NewParser().Parse([]byte(input))
+	assertNoError(t, err)
+	return ExpandWords(list.Items[0].Pipelines[0].Commands[0].Words, env)
+}
+
+func TestExpandParameters(t *testing.T) {
+	t.Run("Expand should substitute and split parameters", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  []string
+		}{
+			{"echo $HOME", []string{"echo", "/home/user"}},
+			{"echo ${HOME}/bin", []string{"echo", "/home/user/bin"}},
+			{"echo ~ ~/bin '~'", []string{"echo", "/home/user", "/home/user/bin", "~"}},
+			{"echo ~nosuchuser/bin a~", []string{"echo", "~nosuchuser/bin", "a~"}},
+			{"echo '$HOME' \\$HOME", []string{"echo", "$HOME", "$HOME"}},
+			{"echo $SPACED", []string{"echo", "a", "b", "c"}},
+			{`echo "$SPACED"`, []string{"echo", " a  b c "}},
+			{"echo x${SPACED}y", []string{"echo", "x", "a", "b", "c", "y"}},
+			{"echo $EMPTY $UNSET", []string{"echo"}},
+			{`echo "$EMPTY" ''$UNSET`, []string{"echo", "", ""}},
+			{"echo $HOME$", []string{"echo", "/home/user$"}},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				env := mapEnv{"HOME": "/home/user", "SPACED": " a  b c ", "EMPTY": ""}
+				got, err := expandInput(t, entry.input, env)
+				assertNoError(t, err)
+				assertStrings(t, entry.want, got)
+			})
+		}
+	})
+
+	t.Run("Expand should split on non whitespace IFS", func(t *testing.T) {
+		env := mapEnv{"IFS": ": ", "PATHS": "/bin: /usr/bin::/sbin"}
+		got, err := expandInput(t, "echo $PATHS", env)
+		assertNoError(t, err)
+		assertStrings(t, []string{"echo", "/bin", "/usr/bin", "", "/sbin"}, got)
+	})
+
+	t.Run("Expand should handle parameter operators", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  []string
+		}{
+			{"echo ${UNSET:-default} ${EMPTY:-default} ${EMPTY-default}", []string{"echo", "default", "default"}},
+			{`echo "${UNSET:-a   b}" ${UNSET:-'c  d'}`, []string{"echo", "a   b", "c  d"}},
+			{"echo ${FILE:+set} ${EMPTY:+set} ${EMPTY+set}", []string{"echo", "set", "set"}},
+			{"echo ${#FILE} ${#UNSET}", []string{"echo", "16", "0"}},
+			{"echo ${FILE#*/} ${FILE##*/}", []string{"echo", "src/main.tar.gz", "main.tar.gz"}},
+			{"echo ${FILE%.*} ${FILE%%.*}", []string{"echo", "/src/main.tar", "/src/main"}},
+			{`echo ${FILE%"*"} ${FILE%.[a-z][a-z]}`, []string{"echo", "/src/main.tar.gz", "/src/main.tar"}},
+			{"echo ${UNSET:-${FILE##*.}}", []string{"echo", "gz"}},
+			{`echo "${UNSET:-'x'}"`, []string{"echo", "'x'"}},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				env := mapEnv{"FILE": "/src/main.tar.gz", "EMPTY": ""}
+				got, err := expandInput(t, entry.input, env)
+				assertNoError(t, err)
+				assertStrings(t, entry.want, got)
+			})
+		}
+	})
+
+	t.Run("Expand should assign default values", func(t *testing.T) {
+		env := mapEnv{}
+		got, err := expandInput(t, "echo ${NEW:=value} $NEW", env)
+		assertNoError(t, err)
+		assertStrings(t, []string{"echo", "value", "value"}, got)
+	})
+
+	t.Run("Expand should fail on unset parameters with ?", func(t *testing.T) {
+		_, err := expandInput(t, "echo ${UNSET:?is required}", mapEnv{})
+		if err == nil || err.Error() != "bash: UNSET: is required" {
+			t.Errorf("expected an error for UNSET, got %v", err)
+		}
+	})
+
+	t.Run("Parse should reject bad substitutions", func(t *testing.T) {
+		table := []string{"echo ${}", "echo ${A B}", "echo ${#A:-x}", "echo ${A"}
+		parser := NewParser()
+		for _, entry := range table {
+			t.Run(entry, func(t *testing.T) {
+				if _, err := parser.Parse([]byte(entry)); err == nil {
+					t.Errorf("%s should raise an error", entry)
+				}
+			})
+		}
+	})
+}
+
+func TestExpandTildeUser(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	got, err := expandInput(t, "echo ~"+current.Username+" ~"+current.Username+"/bin", mapEnv{"HOME": "/home/user"})
+	assertNoError(t, err)
+	assertStrings(t, []string{"echo", current.HomeDir, current.HomeDir + "/bin"}, got)
+}
+
+func TestExpandCommandSubstitution(t *testing.T) {
+	table := []struct {
+		input string
+		want  []string
+	}{
+		{"echo $(date +%s)", []string{"echo", "<date", "+%s>"}},
+		{`echo "$(date +%s)"`, []string{"echo", "<date +%s>"}},
+		{"echo `date +%s`", []string{"echo", "<date", "+%s>"}},
+		{`echo "x$(a | b && c)y"`, []string{"echo", "x<a | b && c>y"}},
+		{`echo "$(a & b >out; c <in)"`, []string{"echo", "<a & b >out; c <in>"}},
+		{"echo $(echo $(pwd))", []string{"echo", "<echo", "$(pwd)>"}},
+		{"echo `echo \\`pwd\\``", []string{"echo", "<echo", "$(pwd)>"}},
+		{`echo $(echo ")" ')')`, []string{"echo", "<echo", "')'", "')'>"}},
+		{"echo ${UNSET:-$(pwd)}", []string{"echo", "<pwd>"}},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.input, func(t *testing.T) {
+			got, err := expandInput(t, entry.input, mapEnv{})
+			assertNoError(t, err)
+			assertStrings(t, entry.want, got)
+		})
+	}
+
+	t.Run("Parse should reject unclosed substitutions", func(t *testing.T) {
+		table := []string{"echo $(pwd", "echo `pwd", `echo "$(pwd"`}
+		parser := NewParser()
+		for _, entry := range table {
+			t.Run(entry, func(t *testing.T) {
+				if _, err := parser.Parse([]byte(entry)); err == nil {
+					t.Errorf("%s should raise an error", entry)
+				}
+			})
+		}
+	})
+}
+
+func TestExpandQuoted(t *testing.T) {
+	env := mapEnv{"HOME": "/home/user", "SPACED": " a  b "}
+	table := []struct {
+		input string
+		want  string
+	}{
+		{"$ ", "$ "},
+		{`\$ `, "$ "},
+		{"$HOME:$SPACED", "/home/user: a  b "},
+		{"'~' ~ *", "'~' ~ *"},
+		{`\"x\" \\ \w`, `"x" \ \w`},
+		{"$(pwd)> ", "<pwd>> "},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.input, func(t *testing.T) {
+			word, err := ParseQuoted(entry.input)
+			assertNoError(t, err)
+			got, err := ExpandWord(word, env)
+			assertNoError(t, err)
+			if got != entry.want {
+				t.Errorf("got %q, want %q", got, entry.want)
+			}
+		})
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	table := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "main.rs", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"[a-c]x", "bx", true},
+		{"[!a-c]x", "bx", false},
+		{"[]]", "]", true},
+		{"[[:digit:]]*", "7up", true},
+		{"[[:upper:]]", "a", false},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{"[abc", "[abc", true},
+		{"*/*", "a/b", true},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.pattern+" "+entry.s, func(t *testing.T) {
+			if got := MatchPattern(entry.pattern, entry.s); got != entry.want {
+				t.Errorf("MatchPattern(%q, %q) = %v, want %v", entry.pattern, entry.s, got, entry.want)
+			}
+		})
+	}
+}
+
+// makeTree creates the files under a new directory and moves into it
+func makeTree(t *testing.T, files ...string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+}
+
+func TestExpandGlob(t *testing.T) {
+	files := []string{"b.go", "a.go", "c.txt", ".hidden.go", "sub/d.go", "sub/deep/e.go", "x[1]"}
+
+	t.Run("Expand should replace patterns with the sorted matching files", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  []string
+		}{
+			{"ls *.go", []string{"ls", "a.go", "b.go"}},
+			{"ls ?.*", []string{"ls", "a.go", "b.go", "c.txt"}},
+			{"ls [ab].go", []string{"ls", "a.go", "b.go"}},
+			{"ls [!ab].*", []string{"ls", "c.txt"}},
+			{"ls .*.go", []string{"ls", ".hidden.go"}},
+			{"ls */*.go", []string{"ls", "sub/d.go"}},
+			{"ls s*/", []string{"ls", "sub/"}},
+			{"ls '*.go' \\*.go \"*\".go", []string{"ls", "*.go", "*.go", "*.go"}},
+			{"ls x[1]", []string{"ls", "x[1]"}},
+			{"ls x\\[*", []string{"ls", "x[1]"}},
+			{"ls *.rs", []string{"ls", "*.rs"}},
+			{"ls **/*.go", []string{"ls", "sub/d.go"}},
+		}
+
+		makeTree(t, files...)
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				got, err := expandInput(t, entry.input, mapEnv{})
+				assertNoError(t, err)
+				assertStrings(t, entry.want, got)
+			})
+		}
+	})
+
+	t.Run("Expand should glob the result of unquoted parameters only", func(t *testing.T) {
+		makeTree(t, files...)
+		env := mapEnv{"P": "*.go"}
+
+		got, err := expandInput(t, `ls $P "$P"`, env)
+		assertNoError(t, err)
+		assertStrings(t, []string{"ls", "a.go", "b.go", "*.go"}, got)
+	})
+
+	t.Run("Expand should follow the shopt options", func(t *testing.T) {
+		table := []struct {
+			input string
+			opts  GlobOptions
+			want  []string
+		}{
+			{"ls *.rs", GlobOptions{NullGlob: true}, []string{"ls"}},
+			{"ls *.go", GlobOptions{DotGlob: true}, []string{"ls", ".hidden.go", "a.go", "b.go"}},
+			{"ls **/*.go", GlobOptions{GlobStar: true}, []string{"ls", "a.go", "b.go", "sub/d.go", "sub/deep/e.go"}},
+			{"ls sub/**", GlobOptions{GlobStar: true}, []string{"ls", "sub/d.go", "sub/deep", "sub/deep/e.go"}},
+		}
+
+		makeTree(t, files...)
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				got, err := expandInput(t, entry.input, globEnv{mapEnv{}, entry.opts})
+				assertNoError(t, err)
+				assertStrings(t, entry.want, got)
+			})
+		}
+	})
+
+	t.Run("Expand should match relative patterns in Dir", func(t *testing.T) {
+		makeTree(t, files...)
+		dir, _ := os.Getwd()
+		t.Chdir(t.TempDir())
+
+		got, err := expandInput(t, "ls *.go sub/*.go", globEnv{mapEnv{}, GlobOptions{Dir: dir}})
+		assertNoError(t, err)
+		assertStrings(t, []string{"ls", "a.go", "b.go", "sub/d.go"}, got)
+	})
+
+	t.Run("Expand should fail on no match with failglob", func(t *testing.T) {
+		makeTree(t, files...)
+
+		_, err := expandInput(t, "ls *.rs", globEnv{mapEnv{}, GlobOptions{FailGlob: true}})
+		var noMatch *NoMatchError
+		if !errors.As(err, &noMatch) || noMatch.Pattern != "*.rs" {
+			t.Errorf("got error %v want no match for *.rs", err)
+		}
+	})
+}
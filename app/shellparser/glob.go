@@ -0,0 +1,207 @@
+package shellparser
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// GlobOptions changes how patterns are matched against files,
+// they are named after the bash shopt options
+type GlobOptions struct {
+	// patterns that match nothing are removed
+	NullGlob bool
+	// patterns that match nothing are an error
+	FailGlob bool
+	// * and ? also match names starting with a dot
+	DotGlob bool
+	// ** matches any number of directories
+	GlobStar bool
+
+	// Dir is the directory relative patterns are matched
+	// in, the current directory when empty
+	Dir string
+}
+
+// NoMatchError is returned with failglob set when a pattern matches nothing
+type NoMatchError struct {
+	Pattern string
+}
+
+func (e *NoMatchError) Error() string {
+	return fmt.Sprintf("bash: no match: %s", e.Pattern)
+}
+
+// HasGlobChars reports if the pattern has any unescaped special character
+func HasGlobChars(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+// unescapePattern removes the backslashes QuotePattern added
+func unescapePattern(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		sb.WriteByte(pattern[i])
+	}
+	return sb.String()
+}
+
+// Glob returns the sorted paths matching pattern
+func Glob(pattern string, opts GlobOptions) []string {
+	base := ""
+	segments := strings.Split(pattern, "/")
+	if strings.HasPrefix(pattern, "/") {
+		base = "/"
+		segments = segments[1:]
+	}
+
+	matches := globSegments(base, segments, opts)
+	slices.Sort(matches)
+	return slices.Compact(matches)
+}
+
+// globSegments matches what is under base against the
+// remaining segments of the pattern, one directory at a time
+func globSegments(base string, segments []string, opts GlobOptions) []string {
+	if len(segments) == 0 {
+		return []string{base}
+	}
+
+	segment, rest := segments[0], segments[1:]
+
+	// a trailing slash, base is already known to be a directory
+	if segment == "" && len(rest) == 0 {
+		return []string{base + "/"}
+	}
+
+	if !HasGlobChars(segment) {
+		path := joinPath(base, unescapePattern(segment))
+		if _, err := os.Lstat(dirOf(path, opts)); err != nil {
+			return nil
+		}
+		return globSegments(path, rest, opts)
+	}
+
+	if segment == "**" && opts.GlobStar {
+		return globStar(base, rest, opts)
+	}
+
+	entries, err := os.ReadDir(dirOf(base, opts))
+	if err != nil {
+		return nil
+	}
+
+	matches := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !matchName(segment, name, opts) {
+			continue
+		}
+		if len(rest) > 0 && !isDir(dirOf(joinPath(base, name), opts)) {
+			continue
+		}
+		matches = append(matches, globSegments(joinPath(base, name), rest, opts)...)
+	}
+	return matches
+}
+
+// globStar matches ** against base and every directory under it,
+// as the last segment it matches every file and directory under base
+func globStar(base string, rest []string, opts GlobOptions) []string {
+	matches := []string{}
+	if len(rest) > 0 {
+		matches = append(matches, globSegments(base, rest, opts)...)
+	}
+
+	entries, err := os.ReadDir(dirOf(base, opts))
+	if err != nil {
+		return matches
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && !opts.DotGlob {
+			continue
+		}
+
+		path := joinPath(base, name)
+		if len(rest) == 0 {
+			matches = append(matches, path)
+		}
+		// symbolic links to directories are not followed
+		if entry.IsDir() {
+			matches = append(matches, globStar(path, rest, opts)...)
+		}
+	}
+	return matches
+}
+
+// matchName matches a single file name, names starting with a dot
+// need a pattern starting with a dot too unless dotglob is set
+func matchName(pattern, name string, opts GlobOptions) bool {
+	if name == "." || name == ".." {
+		return pattern == name
+	}
+	if strings.HasPrefix(name, ".") && !strings.HasPrefix(pattern, ".") && !opts.DotGlob {
+		return false
+	}
+	return MatchPattern(pattern, name)
+}
+
+func joinPath(base, name string) string {
+	if base == "" {
+		return name
+	}
+	if strings.HasSuffix(base, "/") {
+		return base + name
+	}
+	return base + "/" + name
+}
+
+// dirOf is the path to read for base, which is relative to opts.Dir
+func dirOf(base string, opts GlobOptions) string {
+	switch {
+	case base == "" && opts.Dir == "":
+		return "."
+	case opts.Dir == "" || strings.HasPrefix(base, "/"):
+		return base
+	}
+	return joinPath(opts.Dir, base)
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// expandGlob replaces a field with the files its pattern matches
+func expandGlob(f field, opts GlobOptions) ([]string, error) {
+	if !f.hasGlob {
+		return []string{f.value}, nil
+	}
+
+	matches := Glob(f.pattern, opts)
+	if len(matches) > 0 {
+		return matches, nil
+	}
+
+	switch {
+	case opts.FailGlob:
+		return nil, &NoMatchError{Pattern: f.value}
+	case opts.NullGlob:
+		return nil, nil
+	}
+	return []string{f.value}, nil
+}
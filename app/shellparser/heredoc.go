@@ -0,0 +1,102 @@
+package shellparser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// readHeredocs reads the bodies of the here-documents of the line ending
+// at idx, the lines after it up to their delimiters, idx is left on the
+// newline after the last delimiter
+func (p *Parser) readHeredocs(input []byte, idx *int) {
+	pos := *idx + 1
+	for _, i := range p.heredocs {
+		// without a delimiter the syntax error comes from parsing
+		if i+1 >= len(p.tokens) || p.tokens[i+1].kind != tokenWord {
+			continue
+		}
+		tok := &p.tokens[i]
+		delimiter, quoted := heredocDelimiter(p.tokens[i+1].word)
+
+		var body strings.Builder
+		found := false
+		for pos < len(input) && !found {
+			line := input[pos:]
+			if end := bytes.IndexByte(line, '\n'); end >= 0 {
+				line = line[:end]
+			}
+			pos += len(line) + 1
+			if tok.op == RedirectHeredocStrip {
+				line = bytes.TrimLeft(line, "\t")
+			}
+			if string(line) == delimiter {
+				found = true
+				continue
+			}
+			body.Write(line)
+			body.WriteByte('\n')
+		}
+		if !found {
+			p.err = p.unclosedHeredoc(i)
+			return
+		}
+
+		if quoted {
+			tok.heredoc = &Word{Parts: []WordPart{&Literal{Value: body.String(), Quoted: true}}}
+			continue
+		}
+		word, err := parseHeredoc(body.String())
+		if err != nil {
+			p.err = err
+			return
+		}
+		tok.heredoc = word
+	}
+	p.heredocs = nil
+	*idx = min(pos, len(input)) - 1
+}
+
+// unclosedHeredoc is the error of the here-document at index i
+// in tokens when the input ends before its delimiter
+func (p *Parser) unclosedHeredoc(i int) error {
+	delimiter := ""
+	if i+1 < len(p.tokens) && p.tokens[i+1].kind == tokenWord {
+		delimiter, _ = heredocDelimiter(p.tokens[i+1].word)
+	}
+	return incompleteError(fmt.Sprintf("bash: here-document delimited by end-of-file (wanted `%s')", delimiter))
+}
+
+// heredocDelimiter is the delimiter word after quote removal,
+// quoted is true when any of it was quoted
+func heredocDelimiter(w *Word) (delimiter string, quoted bool) {
+	var sb strings.Builder
+	for _, part := range w.Parts {
+		if lit, ok := part.(*Literal); ok {
+			sb.WriteString(lit.Value)
+			quoted = quoted || lit.Quoted
+		} else {
+			sb.WriteString((&Word{Parts: []WordPart{part}}).String())
+		}
+	}
+	return sb.String(), quoted
+}
+
+// parseHeredoc parses the body of a here-document with an unquoted
+// delimiter, where only backslashes, $ and ` are special
+func parseHeredoc(body string) (*Word, error) {
+	sub := &Parser{wordOnly: true, inDoubleQuotes: true, inHeredoc: true}
+	sub.startWord()
+	sub.lex([]byte(body))
+	if errors.Is(sub.err, ErrIncomplete) {
+		// the body is complete, what it misses never comes,
+		// some of these errors already have the prefix
+		return nil, errors.New("bash: " + strings.TrimPrefix(sub.err.Error(), "bash: "))
+	}
+	if sub.err != nil {
+		return nil, sub.err
+	}
+	sub.flushCurrentPart()
+	return sub.currentWord, nil
+}
@@ -0,0 +1,233 @@
+package shellparser
+
+import (
+	"fmt"
+)
+
+var ErrUnclosedBrace error = incompleteError("unexpected EOF while looking for matching `}'")
+
+// operators allowed after the name in ${NAME<op>word},
+// two chars ones first so they win over their prefixes
+var paramOps = []string{":-", ":=", ":?", ":+", "##", "%%", "-", "=", "?", "+", "#", "%"}
+
+func isNameStart(char byte) bool {
+	return char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+}
+
+func isNameChar(char byte) bool {
+	return isNameStart(char) || (char >= '0' && char <= '9')
+}
+
+func isSpecialParam(char byte) bool {
+	switch char {
+	case '?', '$', '#', '!', '@', '*', '-', '0':
+		return true
+	}
+	return false
+}
+
+// handleDollar adds a parameter expansion or a command substitution to
+// the current word, a $ that doesn't start one is kept as a plain character
+func (p *Parser) handleDollar(input []byte, idx *int, quoted bool) {
+	if *idx+1 >= len(input) {
+		p.writeChar('$', quoted)
+		return
+	}
+
+	next := input[*idx+1]
+	var param *Param
+
+	switch {
+	case next == '(':
+		subst := p.parseCmdSubst(input, idx)
+		if subst != nil {
+			subst.Quoted = quoted
+			p.addPart(subst)
+		}
+		return
+
+	case next == '{':
+		param = p.parseBraceParam(input, idx, quoted)
+		if param == nil {
+			return
+		}
+
+	case isNameStart(next):
+		end := *idx + 1
+		for end < len(input) && isNameChar(input[end]) {
+			end++
+		}
+		param = &Param{Name: string(input[*idx+1 : end])}
+		*idx = end - 1
+
+	case isSpecialParam(next) || (next >= '1' && next <= '9'):
+		param = &Param{Name: string(next)}
+		*idx++
+
+	default:
+		p.writeChar('$', quoted)
+		return
+	}
+
+	param.Quoted = quoted
+	p.addPart(param)
+}
+
+// addPart ends the literal being written and appends part to the word
+func (p *Parser) addPart(part WordPart) {
+	p.startWord()
+	p.flushCurrentPart()
+	p.currentWord.Parts = append(p.currentWord.Parts, part)
+}
+
+// parseBraceParam parses ${...} starting at the $, idx is left
+// on the closing brace, on errors p.err is set and nil returned
+func (p *Parser) parseBraceParam(input []byte, idx *int, quoted bool) *Param {
+	start := *idx + 2
+	end := findClosingBrace(input, start, quoted)
+	if end < 0 {
+		p.err = ErrUnclosedBrace
+		return nil
+	}
+
+	badSubstitution := fmt.Errorf("bash: %s: bad substitution", input[*idx:end+1])
+	body := input[start:end]
+	param := &Param{}
+	pos := 0
+
+	// ${#NAME} but ${#} alone is the number of arguments
+	if len(body) > 1 && body[0] == '#' {
+		param.Length = true
+		pos++
+	}
+
+	switch {
+	case pos < len(body) && isNameStart(body[pos]):
+		nameEnd := pos
+		for nameEnd < len(body) && isNameChar(body[nameEnd]) {
+			nameEnd++
+		}
+		param.Name = string(body[pos:nameEnd])
+		pos = nameEnd
+	case pos < len(body) && body[pos] >= '0' && body[pos] <= '9':
+		nameEnd := pos
+		for nameEnd < len(body) && body[nameEnd] >= '0' && body[nameEnd] <= '9' {
+			nameEnd++
+		}
+		param.Name = string(body[pos:nameEnd])
+		pos = nameEnd
+	case pos < len(body) && isSpecialParam(body[pos]):
+		param.Name = string(body[pos])
+		pos++
+	default:
+		p.err = badSubstitution
+		return nil
+	}
+
+	*idx = end
+	if pos == len(body) {
+		return param
+	}
+
+	if param.Length {
+		p.err = badSubstitution
+		return nil
+	}
+
+	for _, op := range paramOps {
+		if len(body)-pos >= len(op) && string(body[pos:pos+len(op)]) == op {
+			param.Op = op
+			pos += len(op)
+			break
+		}
+	}
+	if param.Op == "" {
+		p.err = badSubstitution
+		return nil
+	}
+
+	arg, err := parseWord(body[pos:], quoted)
+	if err != nil {
+		p.err = err
+		return nil
+	}
+	param.Arg = arg
+	return param
+}
+
+// findClosingBrace returns the index of the "}" closing a ${
+// that starts before start, skipping quoted and nested ones
+func findClosingBrace(input []byte, start int, quoted bool) int {
+	depth := 0
+	inDoubleQuotes := false
+
+	for i := start; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			i++
+		case '\'':
+			if quoted || inDoubleQuotes {
+				continue
+			}
+			for i++; i < len(input) && input[i] != '\''; i++ {
+			}
+		case '"':
+			inDoubleQuotes = !inDoubleQuotes
+		case '$':
+			if i+1 < len(input) && input[i+1] == '{' {
+				depth++
+				i++
+			} else if i+1 < len(input) && input[i+1] == '(' {
+				end := findClosingParen(input, i+2)
+				if end < 0 {
+					return -1
+				}
+				i = end
+			}
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// ParseQuoted parses s as the inside of double quotes, like
+// the prompts are before they are expanded
+func ParseQuoted(s string) (*Word, error) {
+	return parseWord([]byte(s), true)
+}
+
+// parseWord parses the word of a ${NAME<op>word} expansion, it can't
+// be split into several words and when quoted is true the expansion was
+// inside double quotes so single quotes lose their meaning
+func parseWord(input []byte, quoted bool) (*Word, error) {
+	sub := &Parser{wordOnly: true, inDoubleQuotes: quoted}
+	sub.startWord()
+	sub.lex(input)
+
+	if sub.err != nil {
+		return nil, sub.err
+	}
+	if sub.state != stateNormal {
+		return nil, ErrUnclosedQuotes
+	}
+	sub.flushCurrentPart()
+
+	word := sub.currentWord
+	if quoted {
+		for _, part := range word.Parts {
+			switch part := part.(type) {
+			case *Literal:
+				part.Quoted = true
+			case *Param:
+				part.Quoted = true
+			case *CmdSubst:
+				part.Quoted = true
+			}
+		}
+	}
+	return word, nil
+}
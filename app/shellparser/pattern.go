@@ -0,0 +1,154 @@
+package shellparser
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MatchPattern reports whether s matches the shell pattern, "*" matches
+// any string, "?" any character, "[...]" a bracket expression and a
+// backslash makes the next character match itself
+func MatchPattern(pattern, s string) bool {
+	return matchRunes([]rune(pattern), []rune(s))
+}
+
+func matchRunes(pattern, s []rune) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// consecutive stars are the same as one
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range len(s) + 1 {
+				if matchRunes(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			matched, size := matchBracket(pattern, s[0])
+			if size == 0 {
+				// not a valid bracket expression, a literal "["
+				if s[0] != '[' {
+					return false
+				}
+				size = 1
+			} else if !matched {
+				return false
+			}
+			pattern, s = pattern[size:], s[1:]
+			continue
+
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+var charClasses = map[string]func(rune) bool{
+	"alnum":  func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) },
+	"alpha":  unicode.IsLetter,
+	"blank":  func(r rune) bool { return r == ' ' || r == '\t' },
+	"cntrl":  unicode.IsControl,
+	"digit":  unicode.IsDigit,
+	"graph":  func(r rune) bool { return unicode.IsGraphic(r) && !unicode.IsSpace(r) },
+	"lower":  unicode.IsLower,
+	"print":  unicode.IsPrint,
+	"punct":  unicode.IsPunct,
+	"space":  unicode.IsSpace,
+	"upper":  unicode.IsUpper,
+	"xdigit": func(r rune) bool { return strings.ContainsRune("0123456789abcdefABCDEF", r) },
+}
+
+// matchBracket matches char against the bracket expression at the
+// start of pattern, size is how many runes it takes and 0 if the
+// expression is not closed
+func matchBracket(pattern []rune, char rune) (matched bool, size int) {
+	i := 1
+	negate := false
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		negate = true
+		i++
+	}
+
+	// a "]" right after the opening is a normal character
+	first := true
+	for ; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == ']' && !first {
+			return matched != negate, i + 1
+		}
+		first = false
+
+		if c == '[' && i+1 < len(pattern) && pattern[i+1] == ':' {
+			end := strings.Index(string(pattern[i+2:]), ":]")
+			if end >= 0 {
+				name := string(pattern[i+2:])[:end]
+				if class, ok := charClasses[name]; ok && class(char) {
+					matched = true
+				}
+				i += 2 + len([]rune(name)) + 1
+				continue
+			}
+		}
+
+		if c == '\\' && i+1 < len(pattern) {
+			i++
+			c = pattern[i]
+		}
+
+		// range like a-z, a "-" before the closing "]" is literal
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi := pattern[i+2]
+			if hi == '\\' && i+3 < len(pattern) {
+				hi = pattern[i+3]
+				i++
+			}
+			if c <= char && char <= hi {
+				matched = true
+			}
+			i += 2
+			continue
+		}
+
+		if c == char {
+			matched = true
+		}
+	}
+	return false, 0
+}
+
+// QuotePattern escapes every character that has a meaning in patterns
+func QuotePattern(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
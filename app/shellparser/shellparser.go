@@ -2,17 +2,35 @@ package shellparser
 
 import (
 	"errors"
-	"os"
+	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
 )
 
 type Parser struct {
-	tokens       []string
+	tokens       []token
 	currentToken strings.Builder
+	currentWord  *Word
+	partQuoted   bool
 	state        int
 	err          error
+
+	// position in tokens while building the syntax tree
+	pos int
+
+	// indexes in tokens of the here-documents whose body
+	// starts on the line after the current one
+	heredocs []int
+
+	// set when parsing the inside of an expansion like ${NAME:-word}, where
+	// only quotes, backslashes and $ are special, inDoubleQuotes when
+	// that expansion itself is inside double quotes, inHeredoc for the
+	// body of a here-document where double quotes aren't special either
+	wordOnly       bool
+	inDoubleQuotes bool
+	inHeredoc      bool
 }
 
 const (
@@ -21,15 +39,57 @@ const (
 	stateDoubleQuote
 )
 
-// refactor later to be pause and open new line ">" instead of error to take more input from shell
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenPipe
+	tokenRedirect
+	tokenAnd       // &&
+	tokenOr        // ||
+	tokenSeparator // ; & or newline
+)
+
+type token struct {
+	kind tokenKind
+	word *Word
+
+	// only for redirections
+	fd int
+	op RedirectOp
+	// body of a here-document
+	heredoc *Word
+
+	// the separator as written, for error messages
+	text string
+}
+
+// ErrIncomplete is matched by the errors of an input that goes on on the
+// next line, the shell reads more lines for it instead of reporting them
+var ErrIncomplete = errors.New("incomplete input")
+
+// incompleteError is an error of an input missing its end
+type incompleteError string
+
+func (e incompleteError) Error() string {
+	return string(e)
+}
+
+func (e incompleteError) Is(target error) bool {
+	return target == ErrIncomplete
+}
+
 var (
-	ErrUnclosedQuotes    = errors.New("unclosed quotes")
-	ErrBackslashAtEnd    = errors.New("backslash at end of input")
-	ErrDanglingBackslash = errors.New("dangling backslash in double quotes")
+	ErrUnclosedQuotes    error = incompleteError("unclosed quotes")
+	ErrBackslashAtEnd    error = incompleteError("backslash at end of input")
+	ErrDanglingBackslash error = incompleteError("dangling backslash in double quotes")
+	ErrUnexpectedEOF     error = incompleteError("bash: syntax error: unexpected end of file")
 
 	// real error
 	ErrUnexpectedTokenRedirect = errors.New("bash: syntax error near unexpected token `newline'")
 	ErrUnexpectedTokenPipe     = errors.New("bash: syntax error near unexpected token `|'")
+	ErrUnexpectedTokenAnd      = errors.New("bash: syntax error near unexpected token `&&'")
+	ErrUnexpectedTokenOr       = errors.New("bash: syntax error near unexpected token `||'")
 )
 
 func NewParser() *Parser {
@@ -39,13 +99,36 @@ func NewParser() *Parser {
 func (p *Parser) cleanParser() {
 	p.tokens = nil
 	p.currentToken.Reset()
+	p.currentWord = nil
+	p.partQuoted = false
 	p.state = stateNormal
 	p.err = nil
+	p.pos = 0
+	p.heredocs = nil
 }
 
-func (p *Parser) Parse(input []byte) ([]string, error) {
+func (p *Parser) Parse(input []byte) (*List, error) {
 	defer p.cleanParser()
 
+	p.lex(input)
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	if p.state != stateNormal {
+		return nil, ErrUnclosedQuotes
+	}
+
+	p.flushCurrentWord()
+	if len(p.heredocs) > 0 {
+		return nil, p.unclosedHeredoc(p.heredocs[0])
+	}
+	return p.parseList()
+}
+
+// lex splits input into tokens
+func (p *Parser) lex(input []byte) {
 	for i := 0; i < len(input) && p.err == nil; i++ {
 		char := input[i]
 		switch p.state {
@@ -57,46 +140,84 @@ func (p *Parser) Parse(input []byte) ([]string, error) {
 			p.handleDoubleQuoteState(char, input, &i)
 		}
 	}
-
-	if p.err != nil {
-		return nil, p.err
-	}
-
-	if p.state != stateNormal {
-		return nil, ErrUnclosedQuotes
-	}
-
-	p.flushCurrentToken()
-	return p.tokens, nil
 }
 
 func (p *Parser) handleNormalState(char byte, input []byte, idx *int) {
+	if p.wordOnly {
+		p.handleWordOnly(char, input, idx)
+		return
+	}
+
 	switch {
 	case char == '>':
 		p.handleOutputRedirect(input, idx)
 	case char == '<':
 		p.handleInputRedirect(input, idx)
 
-	case unicode.IsSpace(rune(char)):
-		p.handleWhitespace()
+	case char != '\n' && unicode.IsSpace(rune(char)):
+		p.flushCurrentWord()
 	case char == '\'':
+		p.startQuote()
 		p.state = stateSingleQuote
 	case char == '"':
+		p.startQuote()
 		p.state = stateDoubleQuote
 
 	case char == '\\':
 		p.handleBackslashEscape(input, idx)
 
+	case char == '$':
+		p.handleDollar(input, idx, false)
+	case char == '`':
+		p.handleBacktick(input, idx, false)
+
 	case char == '|':
-		if (len(p.tokens) == 0 && p.currentToken.Len() == 0) || (len(p.tokens) > 0 && p.tokens[len(p.tokens)-1] == "|") {
-			p.err = ErrUnexpectedTokenPipe
-			return
+		p.flushCurrentWord()
+		if p.nextCharIs(input, *idx, '|') {
+			p.tokens = append(p.tokens, token{kind: tokenOr})
+			*idx++
+		} else {
+			p.tokens = append(p.tokens, token{kind: tokenPipe})
+		}
+
+	case char == '&' && p.nextCharIs(input, *idx, '>'):
+		p.handleAllRedirect(input, idx)
+
+	case char == '&' && p.nextCharIs(input, *idx, '&'):
+		p.flushCurrentWord()
+		p.tokens = append(p.tokens, token{kind: tokenAnd})
+		*idx++
+
+	case char == ';' || char == '&' || char == '\n':
+		p.flushCurrentWord()
+		p.tokens = append(p.tokens, token{kind: tokenSeparator, text: string(char)})
+		if char == '\n' && len(p.heredocs) > 0 {
+			p.readHeredocs(input, idx)
 		}
-		p.flushCurrentToken()
-		p.tokens = append(p.tokens, "|")
 
 	default:
-		p.currentToken.WriteByte(char)
+		p.writeChar(char, false)
+	}
+}
+
+func (p *Parser) handleWordOnly(char byte, input []byte, idx *int) {
+	switch {
+	case char == '\'' && !p.inDoubleQuotes:
+		p.startQuote()
+		p.state = stateSingleQuote
+	case char == '"' && !p.inHeredoc:
+		p.startQuote()
+		p.state = stateDoubleQuote
+	case char == '\\' && p.inDoubleQuotes:
+		p.handleDoubleQuoteBackslash(input, idx)
+	case char == '\\':
+		p.handleBackslashEscape(input, idx)
+	case char == '$':
+		p.handleDollar(input, idx, p.inDoubleQuotes)
+	case char == '`':
+		p.handleBacktick(input, idx, p.inDoubleQuotes)
+	default:
+		p.writeChar(char, p.inDoubleQuotes)
 	}
 }
 
@@ -104,7 +225,7 @@ func (p *Parser) handleSingleQuoteSate(char byte) {
 	if char == '\'' {
 		p.state = stateNormal
 	} else {
-		p.currentToken.WriteByte(char)
+		p.writeChar(char, true)
 	}
 }
 
@@ -114,35 +235,28 @@ func (p *Parser) handleDoubleQuoteState(char byte, input []byte, idx *int) {
 		p.state = stateNormal
 	case '\\':
 		p.handleDoubleQuoteBackslash(input, idx)
+	case '$':
+		p.handleDollar(input, idx, true)
+	case '`':
+		p.handleBacktick(input, idx, true)
 	default:
-		p.currentToken.WriteByte(char)
-	}
-}
-
-func (p *Parser) handleWhitespace() {
-	if p.currentToken.Len() > 0 {
-		out := p.currentToken.String()
-		if out[0] == '~' {
-			out = os.Getenv("HOME") + out[1:]
-		}
-		p.tokens = append(p.tokens, out)
-		p.currentToken.Reset()
+		p.writeChar(char, true)
 	}
 }
 
 func (p *Parser) handleBackslashEscape(input []byte, idx *int) {
-	if *idx+1 >= len(input) {
+	// the line ends with a backslash, the last newline is
+	// the one the line editor adds and not part of the input
+	if *idx+1 >= len(input) || (*idx+2 == len(input) && input[*idx+1] == '\n') {
 		p.err = ErrBackslashAtEnd
 		return
 	}
 
 	nextChar := input[*idx+1]
-	if nextChar == '\n' {
-		*idx++
-	} else {
-		p.currentToken.WriteByte(nextChar)
-		*idx++
+	if nextChar != '\n' {
+		p.writeChar(nextChar, true)
 	}
+	*idx++
 }
 
 func (p *Parser) handleDoubleQuoteBackslash(input []byte, idx *int) {
@@ -151,80 +265,490 @@ func (p *Parser) handleDoubleQuoteBackslash(input []byte, idx *int) {
 		return
 	}
 	nextChar := input[*idx+1]
-	switch nextChar {
-	case '"', '$', '`', '\\':
-		p.currentToken.WriteByte(nextChar)
-		*idx++
-	case '\n':
-		*idx++
+	switch {
+	case nextChar == '$' || nextChar == '`' || nextChar == '\\' || (nextChar == '"' && !p.inHeredoc):
+		p.writeChar(nextChar, true)
+	case nextChar == '\n':
 	default:
-		p.currentToken.WriteByte('\\')
-		p.currentToken.WriteByte(nextChar)
-		*idx++
+		p.writeChar('\\', true)
+		p.writeChar(nextChar, true)
 	}
+	*idx++
 }
 
-func (p *Parser) flushCurrentToken() {
-	if p.currentToken.Len() > 0 {
-		p.tokens = append(p.tokens, p.currentToken.String())
+func (p *Parser) nextCharIs(input []byte, idx int, char byte) bool {
+	return idx+1 < len(input) && input[idx+1] == char
+}
+
+func (p *Parser) startWord() {
+	if p.currentWord == nil {
+		p.currentWord = &Word{}
+	}
+}
+
+// startQuote opens a quoted part even if nothing is written
+// into it, so that empty quotes still produce an empty argument
+func (p *Parser) startQuote() {
+	p.startWord()
+	if !p.partQuoted {
+		p.flushCurrentPart()
+		p.partQuoted = true
+	}
+}
+
+// writeChar adds char to the current word, starting a new
+// part whenever the quoting changes
+func (p *Parser) writeChar(char byte, quoted bool) {
+	p.startWord()
+	if p.partQuoted != quoted {
+		p.flushCurrentPart()
+		p.partQuoted = quoted
+	}
+	p.currentToken.WriteByte(char)
+}
+
+func (p *Parser) flushCurrentPart() {
+	if p.currentToken.Len() > 0 || p.partQuoted {
+		p.currentWord.Parts = append(p.currentWord.Parts, &Literal{
+			Value:  p.currentToken.String(),
+			Quoted: p.partQuoted,
+		})
 		p.currentToken.Reset()
 	}
 }
 
-func isStringFileDescriptor(s string) bool {
-	_, err := strconv.Atoi(s)
-	return err == nil
+func (p *Parser) flushCurrentWord() {
+	if p.currentWord == nil {
+		return
+	}
+
+	p.flushCurrentPart()
+	p.tokens = append(p.tokens, token{kind: tokenWord, word: p.currentWord})
+	p.currentWord = nil
+	p.partQuoted = false
 }
 
-// > or >>
+// takeFileDescriptor consumes the current word if it is an unquoted
+// number written right before a redirection operator like "2>"
+func (p *Parser) takeFileDescriptor(defaultFd int) int {
+	if p.currentWord == nil || len(p.currentWord.Parts) > 0 || p.partQuoted {
+		p.flushCurrentWord()
+		return defaultFd
+	}
+
+	fd, err := strconv.Atoi(p.currentToken.String())
+	if err != nil || fd < 0 {
+		p.flushCurrentWord()
+		return defaultFd
+	}
+
+	p.currentToken.Reset()
+	p.currentWord = nil
+	return fd
+}
+
+// >, >>, >& or >|
 func (p *Parser) handleOutputRedirect(input []byte, idx *int) {
+	fd := p.takeFileDescriptor(1)
+	op := RedirectOutput
 
-	if p.raiseUnexpectedTokenRedirection(len(input), *idx) {
-		return
+	switch {
+	case p.nextCharIs(input, *idx, '>'):
+		op = RedirectAppend
+		*idx++
+	case p.nextCharIs(input, *idx, '&'):
+		op = RedirectDupOutput
+		*idx++
+	case p.nextCharIs(input, *idx, '|'):
+		op = RedirectClobber
+		*idx++
 	}
 
-	redirectString := "1>"
+	p.tokens = append(p.tokens, token{kind: tokenRedirect, fd: fd, op: op})
+}
 
-	cur := p.currentToken.String()
-	if isStringFileDescriptor(cur) {
-		if cur == "2" {
-			redirectString = "2>"
-		}
-		p.currentToken.Reset()
-	} else {
-		p.flushCurrentToken()
+// &> or &>> sending both the standard output and error to a file
+func (p *Parser) handleAllRedirect(input []byte, idx *int) {
+	p.flushCurrentWord()
+	op := RedirectAll
+	*idx++
+
+	if p.nextCharIs(input, *idx, '>') {
+		op = RedirectAppendAll
+		*idx++
 	}
 
-	// append
-	if input[*idx+1] == '>' {
-		redirectString += ">"
+	p.tokens = append(p.tokens, token{kind: tokenRedirect, fd: 1, op: op})
+}
+
+// <, <& and <>, << and <<- whose body comes after the line, or <<<
+func (p *Parser) handleInputRedirect(input []byte, idx *int) {
+	fd := p.takeFileDescriptor(0)
+	op := RedirectInput
+
+	switch {
+	case p.nextCharIs(input, *idx, '&'):
+		op = RedirectDupInput
+		*idx++
+	case p.nextCharIs(input, *idx, '>'):
+		op = RedirectReadWrite
+		*idx++
+	case p.nextCharIs(input, *idx, '<') && p.nextCharIs(input, *idx+1, '<'):
+		op = RedirectHereString
+		*idx += 2
+	case p.nextCharIs(input, *idx, '<') && p.nextCharIs(input, *idx+1, '-'):
+		op = RedirectHeredocStrip
+		*idx += 2
+	case p.nextCharIs(input, *idx, '<'):
+		op = RedirectHeredoc
 		*idx++
-		if p.raiseUnexpectedTokenRedirection(len(input), *idx) {
-			return
+	}
+
+	if op == RedirectHeredoc || op == RedirectHeredocStrip {
+		p.heredocs = append(p.heredocs, len(p.tokens))
+	}
+	p.tokens = append(p.tokens, token{kind: tokenRedirect, fd: fd, op: op})
+}
+
+func (p *Parser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func unexpectedToken(tok *token) error {
+	if tok == nil {
+		return ErrUnexpectedTokenRedirect
+	}
+	switch tok.kind {
+	case tokenPipe:
+		return ErrUnexpectedTokenPipe
+	case tokenAnd:
+		return ErrUnexpectedTokenAnd
+	case tokenOr:
+		return ErrUnexpectedTokenOr
+	case tokenSeparator:
+		if tok.text == "\n" {
+			return ErrUnexpectedTokenRedirect
 		}
+		return fmt.Errorf("bash: syntax error near unexpected token `%s'", tok.text)
+	case tokenRedirect:
+		return fmt.Errorf("bash: syntax error near unexpected token `%s'", tok.op)
 	}
+	return fmt.Errorf("bash: syntax error near unexpected token `%s'", tok.word)
+}
 
-	p.tokens = append(p.tokens, redirectString)
+// reservedWords start and end the compound commands,
+// only as the first word of a command
+var reservedWords = []string{"if", "then", "elif", "else", "fi", "while", "until", "do", "done"}
+
+// reservedWord returns the reserved word tok is written as, if any
+func reservedWord(tok *token) string {
+	if tok == nil || tok.kind != tokenWord || len(tok.word.Parts) != 1 {
+		return ""
+	}
+	literal, ok := tok.word.Parts[0].(*Literal)
+	if !ok || literal.Quoted || !slices.Contains(reservedWords, literal.Value) {
+		return ""
+	}
+	return literal.Value
 }
 
-// <
-func (p *Parser) handleInputRedirect(input []byte, idx *int) {
-	if p.raiseUnexpectedTokenRedirection(len(input), *idx) {
-		return
+// endsBlock reports if tok is a reserved word ending a list inside a
+// compound command, like then or done
+func endsBlock(tok *token) bool {
+	word := reservedWord(tok)
+	return word != "" && word != "if" && word != "while" && word != "until"
+}
+
+// list: compound_list
+// where the input ends, a reserved word left is one closing nothing
+func (p *Parser) parseList() (*List, error) {
+	list, err := p.parseCompoundList()
+	if err != nil {
+		return nil, err
 	}
-	if isStringFileDescriptor(p.currentToken.String()) {
-		// remove file descriptor
-		p.currentToken.Reset()
+	if tok := p.peek(); tok != nil {
+		return nil, unexpectedToken(tok)
+	}
+	return list, nil
+}
+
+// compound_list: and_or (separator and_or)* separator*
+// up to the end of the input or the reserved word ending a block,
+// an and-or list followed by "&" runs in the background
+func (p *Parser) parseCompoundList() (*List, error) {
+	list := &List{}
+
+	// empty lines are a valid input
+	p.skipNewlines()
+
+	for p.peek() != nil && !endsBlock(p.peek()) {
+		andOr, err := p.parseAndOr()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, andOr)
+
+		tok := p.peek()
+		if tok == nil {
+			break
+		}
+		if tok.kind != tokenSeparator {
+			return nil, unexpectedToken(tok)
+		}
+		andOr.Background = tok.text == "&"
+		p.pos++
+		p.skipNewlines()
+	}
+
+	return list, nil
+}
+
+// and_or: pipeline (('&&' | '||') newline* pipeline)*
+func (p *Parser) parseAndOr() (*AndOr, error) {
+	andOr := &AndOr{}
+	for {
+		pipeline, err := p.parsePipeline()
+		if err != nil {
+			return nil, err
+		}
+		andOr.Pipelines = append(andOr.Pipelines, pipeline)
+
+		tok := p.peek()
+		switch {
+		case tok != nil && tok.kind == tokenAnd:
+			andOr.Ops = append(andOr.Ops, OpAnd)
+		case tok != nil && tok.kind == tokenOr:
+			andOr.Ops = append(andOr.Ops, OpOr)
+		default:
+			return andOr, nil
+		}
+		p.pos++
+		if err := p.skipToNextLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// skipToNextLine skips the newlines after an operator that needs more,
+// the input is incomplete if they are all that's left of it
+func (p *Parser) skipToNextLine() error {
+	p.skipNewlines()
+	if p.peek() == nil {
+		return ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func (p *Parser) skipNewlines() {
+	for tok := p.peek(); tok != nil && tok.kind == tokenSeparator && tok.text == "\n"; tok = p.peek() {
+		p.pos++
+	}
+}
+
+// pipeline: command ('|' command)*
+func (p *Parser) parsePipeline() (*Pipeline, error) {
+	pipeline := &Pipeline{}
+	for {
+		cmd, err := p.parseSimpleCommand()
+		if err != nil {
+			return nil, err
+		}
+		pipeline.Commands = append(pipeline.Commands, cmd)
+
+		tok := p.peek()
+		if tok == nil || tok.kind != tokenPipe {
+			return pipeline, nil
+		}
+		p.pos++
+		if err := p.skipToNextLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// command: (word | redirect)+ | compound_command redirect*
+func (p *Parser) parseSimpleCommand() (*SimpleCommand, error) {
+	switch word := reservedWord(p.peek()); word {
+	case "":
+	case "if", "while", "until":
+		return p.parseCompoundCommand(word)
+	default:
+		return nil, unexpectedToken(p.peek())
+	}
+
+	cmd := &SimpleCommand{}
+	for tok := p.peek(); tok != nil; tok = p.peek() {
+		switch tok.kind {
+		case tokenWord:
+			if assign := asAssignment(tok.word); assign != nil && len(cmd.Words) == 0 {
+				cmd.Assigns = append(cmd.Assigns, assign)
+			} else {
+				cmd.Words = append(cmd.Words, tok.word)
+			}
+			p.pos++
+		case tokenRedirect:
+			redirect, err := p.parseRedirect()
+			if err != nil {
+				return nil, err
+			}
+			cmd.Redirects = append(cmd.Redirects, redirect)
+		default:
+			if cmd.isEmpty() {
+				return nil, unexpectedToken(tok)
+			}
+			return cmd, nil
+		}
+	}
+
+	if cmd.isEmpty() {
+		return nil, unexpectedToken(nil)
+	}
+	return cmd, nil
+}
+
+// redirect: redirect_operator word
+func (p *Parser) parseRedirect() (*Redirect, error) {
+	tok := p.peek()
+	p.pos++
+	target := p.peek()
+	if target == nil || target.kind != tokenWord {
+		return nil, unexpectedToken(target)
+	}
+	p.pos++
+	return &Redirect{Fd: tok.fd, Op: tok.op, Target: target.word, Heredoc: tok.heredoc}, nil
+}
+
+// compound_command: if_clause | while_clause | until_clause
+// if_clause: 'if' block 'then' block ('elif' block 'then' block)* ('else' block)? 'fi'
+// while_clause: ('while' | 'until') block 'do' block 'done'
+// the input is incomplete until the reserved word closing it
+func (p *Parser) parseCompoundCommand(word string) (*SimpleCommand, error) {
+	p.pos++
+	cmd := &SimpleCommand{}
+	var err error
+	if word == "if" {
+		cmd.Compound, err = p.parseIfClause()
 	} else {
-		p.flushCurrentToken()
+		cmd.Compound, err = p.parseLoopClause(word == "until")
+	}
+	if err != nil {
+		return nil, err
 	}
-	p.tokens = append(p.tokens, "0<")
+
+	// only redirections can follow the reserved word closing it
+	for tok := p.peek(); tok != nil && (tok.kind == tokenRedirect || tok.kind == tokenWord); tok = p.peek() {
+		if tok.kind == tokenWord {
+			return nil, unexpectedToken(tok)
+		}
+		redirect, err := p.parseRedirect()
+		if err != nil {
+			return nil, err
+		}
+		cmd.Redirects = append(cmd.Redirects, redirect)
+	}
+	return cmd, nil
 }
 
-func (p *Parser) raiseUnexpectedTokenRedirection(inputSize, idx int) bool {
-	if idx+1 >= inputSize {
-		p.err = ErrUnexpectedTokenRedirect
-		return true
+func (p *Parser) parseIfClause() (*IfClause, error) {
+	clause := &IfClause{}
+	for word := "if"; word != "fi"; {
+		if word == "else" {
+			var err error
+			clause.Else, word, err = p.parseBlock("fi")
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		cond, _, err := p.parseBlock("then")
+		if err != nil {
+			return nil, err
+		}
+		body, next, err := p.parseBlock("elif", "else", "fi")
+		if err != nil {
+			return nil, err
+		}
+		clause.Conds = append(clause.Conds, cond)
+		clause.Bodies = append(clause.Bodies, body)
+		word = next
+	}
+	return clause, nil
+}
+
+func (p *Parser) parseLoopClause(until bool) (*LoopClause, error) {
+	cond, _, err := p.parseBlock("do")
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := p.parseBlock("done")
+	if err != nil {
+		return nil, err
+	}
+	return &LoopClause{Until: until, Cond: cond, Body: body}, nil
+}
+
+// block: compound_list
+// it can't be empty and has to be ended by one of the reserved words
+// in ends, which is returned, the input is incomplete without it
+func (p *Parser) parseBlock(ends ...string) (*List, string, error) {
+	list, err := p.parseCompoundList()
+	if err != nil {
+		return nil, "", err
+	}
+	tok := p.peek()
+	if tok == nil {
+		return nil, "", ErrUnexpectedEOF
+	}
+	word := reservedWord(tok)
+	if len(list.Items) == 0 || !slices.Contains(ends, word) {
+		return nil, "", unexpectedToken(tok)
+	}
+	p.pos++
+	return list, word, nil
+}
+
+func (c *SimpleCommand) isEmpty() bool {
+	return len(c.Assigns) == 0 && len(c.Words) == 0 && len(c.Redirects) == 0
+}
+
+// asAssignment splits a word like NAME=value, the name
+// and the "=" have to be unquoted to count as one
+func asAssignment(w *Word) *Assignment {
+	if len(w.Parts) == 0 {
+		return nil
+	}
+	first, ok := w.Parts[0].(*Literal)
+	if !ok || first.Quoted {
+		return nil
+	}
+
+	name, value, found := strings.Cut(first.Value, "=")
+	if !found || !IsValidName(name) {
+		return nil
+	}
+
+	parts := []WordPart{}
+	if value != "" {
+		parts = append(parts, &Literal{Value: value})
+	}
+	parts = append(parts, w.Parts[1:]...)
+	return &Assignment{Name: name, Value: &Word{Parts: parts}}
+}
+
+// IsValidName reports if name can be used as a variable name
+func IsValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, ch := range name {
+		isLetter := ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+		if !isLetter && (i == 0 || ch < '0' || ch > '9') {
+			return false
+		}
 	}
-	return false
+	return true
 }
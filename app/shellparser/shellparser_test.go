@@ -1,7 +1,9 @@
 package shellparser
 
 import (
+	"errors"
 	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -28,6 +30,244 @@ func TestParseInput(t *testing.T) {
 	})
 }
 
+func TestParsePipelines(t *testing.T) {
+	t.Run("Parse should split commands on pipes", func(t *testing.T) {
+		input := "cat file | grep -v x | wc -l"
+		want := []string{"cat", "file", "|", "grep", "-v", "x", "|", "wc", "-l"}
+		parser := NewParser()
+
+		got, err := parser.Parse([]byte(input))
+		assertNoError(t, err)
+		assertParsedStrings(t, want, got)
+		if len(got.Items) != 1 || len(got.Items[0].Pipelines[0].Commands) != 3 {
+			t.Errorf("expected one pipeline of 3 commands, got %v", got)
+		}
+	})
+
+	t.Run("Parse should keep quoted operators as words", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  []string
+		}{
+			{"echo '|' \\| \"1>\"", []string{"echo", "|", "|", "1>"}},
+			{"echo '' \"\"", []string{"echo", "", ""}},
+			{"echo ''2>file", []string{"echo", "2", "1>", "file"}},
+		}
+
+		parser := NewParser()
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				got, err := parser.Parse([]byte(entry.input))
+				assertNoError(t, err)
+				assertParsedStrings(t, entry.want, got)
+				if len(got.Items[0].Pipelines[0].Commands) != 1 {
+					t.Errorf("quoted pipe should not split the command")
+				}
+			})
+		}
+	})
+
+	t.Run("Parse should reject here-documents with unfinished expansions", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  string
+		}{
+			{"cat <<EOF\n$(ls\nEOF\n", "bash: unexpected EOF while looking for matching `)'"},
+			{"cat <<EOF\n${A\nEOF\n", "bash: unexpected EOF while looking for matching `}'"},
+			{"cat <<EOF\n`ls\nEOF\n", "bash: unexpected EOF while looking for matching ``'"},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				_, err := NewParser().Parse([]byte(entry.input))
+				if err == nil || errors.Is(err, ErrIncomplete) || err.Error() != entry.want {
+					t.Errorf("Wanted %q, Got %v", entry.want, err)
+				}
+			})
+		}
+	})
+
+	t.Run("Should raise unexpected token error", func(t *testing.T) {
+		table := []string{"|", "| ls", "ls |", "ls | | wc", "ls > | wc"}
+		parser := NewParser()
+		for _, entry := range table {
+			t.Run(entry, func(t *testing.T) {
+				got, err := parser.Parse([]byte(entry))
+				if err == nil {
+					t.Errorf("%s should raise an error", entry)
+				}
+				if got != nil {
+					t.Errorf("got '%v' should be empty", got)
+				}
+			})
+		}
+	})
+}
+
+func TestParseLists(t *testing.T) {
+	t.Run("Parse should handle ;, && and || operators", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  []string
+		}{
+			{"make && ./run || echo failed", []string{"make", "&&", "./run", "||", "echo", "failed"}},
+			{"cd dir; ls", []string{"cd", "dir", ";", "ls"}},
+			{"cd dir;ls;", []string{"cd", "dir", ";", "ls"}},
+			{"a|b&&c||d|e", []string{"a", "|", "b", "&&", "c", "||", "d", "|", "e"}},
+			{"true &&\nfalse\n", []string{"true", "&&", "false"}},
+			{"echo 'a && b' c\\;d\\&\\&", []string{"echo", "a && b", "c;d&&"}},
+			{"echo a&b", []string{"echo", "a", "&", "b"}},
+			{"sleep 1 & sleep 2 &", []string{"sleep", "1", "&", "sleep", "2", "&"}},
+			{"make && ./run &\nls", []string{"make", "&&", "./run", "&", "ls"}},
+			{"\n", []string{}},
+		}
+
+		parser := NewParser()
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				got, err := parser.Parse([]byte(entry.input))
+				assertNoError(t, err)
+				assertParsedStrings(t, entry.want, got)
+			})
+		}
+	})
+
+	t.Run("Parse should group pipelines by list separators", func(t *testing.T) {
+		parser := NewParser()
+		got, err := parser.Parse([]byte("a && b; c || d\n"))
+		assertNoError(t, err)
+
+		if len(got.Items) != 2 {
+			t.Fatalf("expected 2 and-or lists, got %d", len(got.Items))
+		}
+		for _, andOr := range got.Items {
+			if len(andOr.Pipelines) != 2 || len(andOr.Ops) != 1 {
+				t.Errorf("expected 2 pipelines joined by one operator, got %v", andOr)
+			}
+		}
+	})
+
+	t.Run("Parse should reject here-documents with unfinished expansions", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  string
+		}{
+			{"cat <<EOF\n$(ls\nEOF\n", "bash: unexpected EOF while looking for matching `)'"},
+			{"cat <<EOF\n${A\nEOF\n", "bash: unexpected EOF while looking for matching `}'"},
+			{"cat <<EOF\n`ls\nEOF\n", "bash: unexpected EOF while looking for matching ``'"},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				_, err := NewParser().Parse([]byte(entry.input))
+				if err == nil || errors.Is(err, ErrIncomplete) || err.Error() != entry.want {
+					t.Errorf("Wanted %q, Got %v", entry.want, err)
+				}
+			})
+		}
+	})
+
+	t.Run("Should raise unexpected token error", func(t *testing.T) {
+		table := []string{";", "; ls", "ls;;", "&& ls", "ls &&", "ls || || wc", "ls ||\n", "&", "ls & &", "ls &;"}
+		parser := NewParser()
+		for _, entry := range table {
+			t.Run(entry, func(t *testing.T) {
+				got, err := parser.Parse([]byte(entry))
+				if err == nil {
+					t.Errorf("%s should raise an error", entry)
+				}
+				if got != nil {
+					t.Errorf("got '%v' should be empty", got)
+				}
+			})
+		}
+	})
+}
+
+func TestParseParameters(t *testing.T) {
+	t.Run("Parse should only expand parameters outside single quotes", func(t *testing.T) {
+		table := []struct {
+			input  string
+			params int
+		}{
+			{"echo $?", 1},
+			{`echo "status: $?"`, 1},
+			{"echo '$?'", 0},
+			{`echo \$?`, 0},
+			{`echo "\$?"`, 0},
+			{"echo $?$?", 2},
+			{"echo $ $a", 1},
+		}
+
+		parser := NewParser()
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				got, err := parser.Parse([]byte(entry.input))
+				assertNoError(t, err)
+
+				params := 0
+				for _, w := range got.Items[0].Pipelines[0].Commands[0].Words {
+					for _, part := range w.Parts {
+						if _, ok := part.(*Param); ok {
+							params++
+						}
+					}
+				}
+				if params != entry.params {
+					t.Errorf("expected %d parameters, got %d", entry.params, params)
+				}
+			})
+		}
+	})
+}
+
+func TestParseAssignments(t *testing.T) {
+	table := []struct {
+		input   string
+		assigns []string
+		words   []string
+	}{
+		{"FOO=bar", []string{"FOO=bar"}, nil},
+		{"FOO= ./prog", []string{"FOO="}, []string{"./prog"}},
+		{"A=1 B='x y' env", []string{"A=1", "B=x y"}, []string{"env"}},
+		{"echo FOO=bar", nil, []string{"echo", "FOO=bar"}},
+		{"'FOO'=bar", nil, []string{"FOO=bar"}},
+		{"1FOO=bar", nil, []string{"1FOO=bar"}},
+		{"A=1 >out B=2 cmd C=3", []string{"A=1", "B=2"}, []string{"cmd", "C=3"}},
+	}
+
+	parser := NewParser()
+
+	for _, entry := range table {
+		t.Run(entry.input, func(t *testing.T) {
+			got, err := parser.Parse([]byte(entry.input))
+			assertNoError(t, err)
+
+			cmd := got.Items[0].Pipelines[0].Commands[0]
+			assigns := []string{}
+			for _, a := range cmd.Assigns {
+				assigns = append(assigns, a.Name+"="+wordText(a.Value))
+			}
+			words := []string{}
+			for _, w := range cmd.Words {
+				words = append(words, wordText(w))
+			}
+
+			if entry.assigns == nil {
+				entry.assigns = []string{}
+			}
+			if entry.words == nil {
+				entry.words = []string{}
+			}
+			assertStrings(t, entry.assigns, assigns)
+			assertStrings(t, entry.words, words)
+		})
+	}
+}
+
 func TestParseRedirectionOperators(t *testing.T) {
 	t.Run("Parse should handle > operator", func(t *testing.T) {
 		table := []struct {
@@ -64,7 +304,7 @@ func TestParseRedirectionOperators(t *testing.T) {
 		}{
 			{"cat < input.txt", []string{"cat", "0<", "input.txt"}},
 			{"sort <data.txt", []string{"sort", "0<", "data.txt"}},
-			{"command 2<input.txt", []string{"command", "0<", "input.txt"}},
+			{"command 2<input.txt", []string{"command", "2<", "input.txt"}},
 			{"grep pattern <file.txt", []string{"grep", "pattern", "0<", "file.txt"}},
 			{"awk '{print $1}' <data.txt", []string{"awk", "{print $1}", "0<", "data.txt"}},
 		}
@@ -103,8 +343,95 @@ func TestParseRedirectionOperators(t *testing.T) {
 		}
 	})
 
+	t.Run("Parse should handle duplication, read-write, clobber and &> operators", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  []string
+		}{
+			{"cmd > log 2>&1", []string{"cmd", "1>", "log", "2>&", "1"}},
+			{"echo error >&2", []string{"echo", "error", "1>&", "2"}},
+			{"cmd 3>&1 1>&2 2>&3 3>&-", []string{"cmd", "3>&", "1", "1>&", "2", "2>&", "3", "3>&", "-"}},
+			{"cat <&3 3<file", []string{"cat", "0<&", "3", "3<", "file"}},
+			{"cat 0<&-", []string{"cat", "0<&", "-"}},
+			{"cat <>file 4<> other", []string{"cat", "0<>", "file", "4<>", "other"}},
+			{"echo hi >| file", []string{"echo", "hi", "1>|", "file"}},
+			{"cmd &> all", []string{"cmd", "1&>", "all"}},
+			{"cmd&>>all", []string{"cmd", "1&>>", "all"}},
+			{"cmd 2&>all", []string{"cmd", "2", "1&>", "all"}},
+			{"sleep 1 & echo hi", []string{"sleep", "1", "&", "echo", "hi"}},
+		}
+
+		parser := NewParser()
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				got, err := parser.Parse([]byte(entry.input))
+				assertNoError(t, err)
+				assertParsedStrings(t, entry.want, got)
+			})
+		}
+	})
+
+	t.Run("Parse should handle here-documents and here-strings", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  []string
+			body  string
+		}{
+			{"cat <<EOF\nhello\nEOF\n", []string{"cat", "0<<", "EOF"}, "hello\n"},
+			{"cat << EOF; echo hi\na\n  b\nEOF\n", []string{"cat", "0<<", "EOF", ";", "echo", "hi"}, "a\n  b\n"},
+			{"cat <<-'EOF'\n\t\ta\n\tEOF\n", []string{"cat", "0<<-", "EOF"}, "a\n"},
+			{"cat <<E | wc\n\nE\n", []string{"cat", "0<<", "E", "|", "wc"}, "\n"},
+			{"cat 3<<EOF\nEOF\n", []string{"cat", "3<<", "EOF"}, ""},
+			{"cat <<< word", []string{"cat", "0<<<", "word"}, ""},
+		}
+
+		parser := NewParser()
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				got, err := parser.Parse([]byte(entry.input))
+				assertNoError(t, err)
+				assertParsedStrings(t, entry.want, got)
+				if r := got.Items[0].Pipelines[0].Commands[0].Redirects[0]; r.Heredoc != nil && wordText(r.Heredoc) != entry.body {
+					t.Errorf("got body %q, want %q", wordText(r.Heredoc), entry.body)
+				}
+			})
+		}
+	})
+
+	t.Run("Parse should read the bodies of several here-documents in order", func(t *testing.T) {
+		got, err := NewParser().Parse([]byte("cat <<A <<B\na\nA\nb\nB\necho done\n"))
+		assertNoError(t, err)
+		assertParsedStrings(t, []string{"cat", "0<<", "A", "0<<", "B", ";", "echo", "done"}, got)
+		redirects := got.Items[0].Pipelines[0].Commands[0].Redirects
+		if wordText(redirects[0].Heredoc) != "a\n" || wordText(redirects[1].Heredoc) != "b\n" {
+			t.Errorf("got bodies %q and %q", wordText(redirects[0].Heredoc), wordText(redirects[1].Heredoc))
+		}
+	})
+
+	t.Run("Parse should reject here-documents with unfinished expansions", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  string
+		}{
+			{"cat <<EOF\n$(ls\nEOF\n", "bash: unexpected EOF while looking for matching `)'"},
+			{"cat <<EOF\n${A\nEOF\n", "bash: unexpected EOF while looking for matching `}'"},
+			{"cat <<EOF\n`ls\nEOF\n", "bash: unexpected EOF while looking for matching ``'"},
+		}
+
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				_, err := NewParser().Parse([]byte(entry.input))
+				if err == nil || errors.Is(err, ErrIncomplete) || err.Error() != entry.want {
+					t.Errorf("Wanted %q, Got %v", entry.want, err)
+				}
+			})
+		}
+	})
+
 	t.Run("Should raise unexpected token error", func(t *testing.T) {
-		table := []string{">", "1>", "2>", ">>", "1>>", "2>>", "<", "0<"}
+		table := []string{">", "1>", "2>", ">>", "1>>", "2>>", "<", "0<", "<<\n", "<<<", ">&", "2>&", "<&", "<>", ">|", "&>", "&>>"}
 		parser := NewParser()
 		for _, entry := range table {
 			t.Run(entry, func(t *testing.T) {
@@ -112,7 +439,7 @@ func TestParseRedirectionOperators(t *testing.T) {
 				if err == nil {
 					t.Errorf("%s alone should raise an error", entry)
 				}
-				if len(got) > 0 {
+				if got != nil {
 					t.Errorf("got '%v' should be empty", got)
 				}
 			})
@@ -121,13 +448,160 @@ func TestParseRedirectionOperators(t *testing.T) {
 
 }
 
-func assertParsedStrings(t testing.TB, want, got []string) {
+func TestParseIncompleteInput(t *testing.T) {
+	t.Run("Parse should ask for more lines", func(t *testing.T) {
+		table := []string{
+			"echo 'a\n", "echo \"a\n", "echo a \\\n", "echo \"a \\",
+			"ls |\n", "ls &&\n", "ls ||", "ls | \n\n",
+			"echo $(ls\n", "echo `ls\n", "echo ${A\n",
+			"cat <<EOF\n", "cat <<EOF\nbody\n", "cat <<-EOF\n EOF\n", "cat <<EOF",
+			"if true; then\n", "if true\n", "if\n", "if a; then b; else\n", "if a; then if b; then c; fi\n",
+			"while true; do echo a\n", "until false\n", "while a; do b; done |\n",
+		}
+		parser := NewParser()
+		for _, entry := range table {
+			t.Run(entry, func(t *testing.T) {
+				_, err := parser.Parse([]byte(entry))
+				if !errors.Is(err, ErrIncomplete) {
+					t.Errorf("%q should be incomplete, got %v", entry, err)
+				}
+			})
+		}
+	})
+
+	t.Run("Parse should reject complete syntax errors", func(t *testing.T) {
+		table := []string{
+			"| ls\n", "ls ;;\n", "echo $(ls |)\n", "echo `ls &&`\n", "ls >\n",
+			"fi\n", "then echo\n", "if true; then fi\n", "while a; done\n", "if a; then b; fi c\n", "echo | done\n",
+		}
+		parser := NewParser()
+		for _, entry := range table {
+			t.Run(entry, func(t *testing.T) {
+				_, err := parser.Parse([]byte(entry))
+				if err == nil || errors.Is(err, ErrIncomplete) {
+					t.Errorf("%q should be a syntax error, got %v", entry, err)
+				}
+			})
+		}
+	})
+
+	t.Run("Parse should join the lines that continue", func(t *testing.T) {
+		table := []struct {
+			input string
+			want  []string
+		}{
+			{"echo 'a\nb'\n", []string{"echo", "a\nb"}},
+			{"echo a \\\nb\n", []string{"echo", "a", "b"}},
+			{"ls |\nwc\n", []string{"ls", "|", "wc"}},
+			{"ls &&\n\nwc\n", []string{"ls", "&&", "wc"}},
+		}
+		parser := NewParser()
+		for _, entry := range table {
+			t.Run(entry.input, func(t *testing.T) {
+				got, err := parser.Parse([]byte(entry.input))
+				assertNoError(t, err)
+				assertParsedStrings(t, entry.want, got)
+			})
+		}
+	})
+}
+
+func TestParseCompoundCommands(t *testing.T) {
+	table := []struct {
+		input string
+		want  string
+	}{
+		{"if true; then echo a; fi\n", "if true; then echo a; fi"},
+		{"if a\nthen\n  b\nelif c; then d; else e; fi\n", "if a; then b; elif c; then d; else e; fi"},
+		{"while read l; do echo $l; done <f\n", "while read l; do echo ${l}; done <f"},
+		{"until a && b; do c & done | wc\n", "until a && b; do c & done | wc"},
+		{"if a; then while b; do c; done; fi; d\n", "if a; then while b; do c; done; fi; d"},
+		{"echo if then fi\n", "echo if then fi"},
+		{"'if' a\n", "'if' a"},
+	}
+
+	parser := NewParser()
+	for _, entry := range table {
+		t.Run(entry.input, func(t *testing.T) {
+			got, err := parser.Parse([]byte(entry.input))
+			assertNoError(t, err)
+			if got.String() != entry.want {
+				t.Errorf("Wanted %q, Got %q", entry.want, got.String())
+			}
+		})
+	}
+
+	t.Run("Parse should split an if into its lists", func(t *testing.T) {
+		got, err := parser.Parse([]byte("if a; then b; fi\n"))
+		assertNoError(t, err)
+		clause, ok := got.Items[0].Pipelines[0].Commands[0].Compound.(*IfClause)
+		if !ok || len(clause.Conds) != 1 || clause.Else != nil {
+			t.Fatalf("Wanted an if clause, Got %v", got)
+		}
+		assertParsedStrings(t, []string{"a"}, clause.Conds[0])
+		assertParsedStrings(t, []string{"b"}, clause.Bodies[0])
+	})
+}
+
+func assertParsedStrings(t testing.TB, want []string, list *List) {
+	t.Helper()
+	assertStrings(t, want, flattenList(list))
+}
+
+func assertStrings(t testing.TB, want, got []string) {
 	t.Helper()
 	if !reflect.DeepEqual(want, got) {
 		t.Errorf("Wanted %v, Got %v", want, got)
 	}
 }
 
+// flattenList writes the tree back as tokens, redirections become
+// "<fd><op>" followed by their target and operators are kept as is,
+// every and-or list except the first one starts with ";"
+func flattenList(list *List) []string {
+	if list == nil {
+		return nil
+	}
+
+	res := []string{}
+	for i, andOr := range list.Items {
+		if i > 0 && !list.Items[i-1].Background {
+			res = append(res, ";")
+		}
+		for j, pipeline := range andOr.Pipelines {
+			if j > 0 {
+				res = append(res, andOr.Ops[j-1].String())
+			}
+			for k, cmd := range pipeline.Commands {
+				if k > 0 {
+					res = append(res, "|")
+				}
+				for _, w := range cmd.Words {
+					res = append(res, wordText(w))
+				}
+				for _, r := range cmd.Redirects {
+					res = append(res, strconv.Itoa(r.Fd)+r.Op.String(), wordText(r.Target))
+				}
+			}
+		}
+		if andOr.Background {
+			res = append(res, "&")
+		}
+	}
+	return res
+}
+
+// wordText joins the parts of a word without expanding them
+func wordText(w *Word) string {
+	text := ""
+	for _, part := range w.Parts {
+		if lit, ok := part.(*Literal); ok {
+			text += lit.Value
+		}
+	}
+	return text
+}
+
 func assertNoError(t testing.TB, err error) {
 	if err != nil {
 		t.Error(err.Error())
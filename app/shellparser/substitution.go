@@ -0,0 +1,105 @@
+package shellparser
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnclosedParen    error = incompleteError("unexpected EOF while looking for matching `)'")
+	ErrUnclosedBacktick error = incompleteError("unexpected EOF while looking for matching ``'")
+)
+
+// parseCmdSubst parses $(...) starting at the $, idx is left on
+// the closing parenthesis, on errors p.err is set and nil returned
+func (p *Parser) parseCmdSubst(input []byte, idx *int) *CmdSubst {
+	start := *idx + 2
+	end := findClosingParen(input, start)
+	if end < 0 {
+		p.err = ErrUnclosedParen
+		return nil
+	}
+
+	list, err := NewParser().Parse(input[start:end])
+	if err != nil {
+		p.err = substError(err, ")")
+		return nil
+	}
+
+	*idx = end
+	return &CmdSubst{List: list}
+}
+
+// findClosingParen returns the index of the ")" closing a $(
+// that starts before start, skipping quoted and nested ones
+func findClosingParen(input []byte, start int) int {
+	depth := 0
+	inDoubleQuotes := false
+
+	for i := start; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			i++
+		case '\'':
+			if inDoubleQuotes {
+				continue
+			}
+			for i++; i < len(input) && input[i] != '\''; i++ {
+			}
+		case '"':
+			inDoubleQuotes = !inDoubleQuotes
+		case '(':
+			if !inDoubleQuotes {
+				depth++
+			}
+		case ')':
+			if inDoubleQuotes {
+				continue
+			}
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// handleBacktick adds the old style `...` command substitution to the
+// current word, inside it a backslash only escapes $, ` and \ (and "
+// when the backticks are inside double quotes)
+func (p *Parser) handleBacktick(input []byte, idx *int, quoted bool) {
+	inner := []byte{}
+	i := *idx + 1
+	for ; i < len(input) && input[i] != '`'; i++ {
+		if input[i] == '\\' && i+1 < len(input) {
+			if next := input[i+1]; next == '$' || next == '`' || next == '\\' || (quoted && next == '"') {
+				i++
+			}
+		}
+		inner = append(inner, input[i])
+	}
+
+	if i >= len(input) {
+		p.err = ErrUnclosedBacktick
+		return
+	}
+
+	list, err := NewParser().Parse(inner)
+	if err != nil {
+		p.err = substError(err, "`")
+		return
+	}
+
+	*idx = i
+	p.addPart(&CmdSubst{List: list, Quoted: quoted})
+}
+
+// substError makes the errors of the commands of a substitution final,
+// they can't go on past the closing ) or `
+func substError(err error, closing string) error {
+	if errors.Is(err, ErrIncomplete) {
+		return fmt.Errorf("bash: syntax error near unexpected token `%s'", closing)
+	}
+	return err
+}